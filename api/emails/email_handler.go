@@ -16,9 +16,9 @@ type emailHandler struct {
 	emailService IEmailService
 }
 
-// NewEmailHandler will initialize emailHandler object
-func NewEmailHandler() *emailHandler {
-	emailService := NewEmailService()
+// NewEmailHandler will initialize emailHandler object, the chat is sent with mailer
+func NewEmailHandler(userRepo mongodb.UserRepository, messageRepo mongodb.MessageRepository, mailer common.Mailer) *emailHandler {
+	emailService := NewEmailService(userRepo, messageRepo, mailer)
 	return &emailHandler{emailService: emailService}
 }
 
@@ -38,10 +38,11 @@ func (h *emailHandler) MailChat(w http.ResponseWriter, r *http.Request) {
 		// c.JSON(http.StatusBadRequest, err)
 		return
 	}
-	msg, err := h.emailService.MailChat(userMongo)
+	msg, err := h.emailService.MailChat(r.Context(), userMongo)
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
@@ -2,6 +2,7 @@ package emails
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/pranotobudi/myslack-happy-backend/common"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,7 +22,7 @@ var (
 
 type mockEmailService struct{}
 
-func (m *mockEmailService) MailChat(userMongo mongodb.User) (string, error) {
+func (m *mockEmailService) MailChat(ctx context.Context, userMongo mongodb.User) (string, error) {
 	return mailChatServiceFunc(userMongo)
 }
 
@@ -61,7 +63,7 @@ func TestMailChat(t *testing.T) {
 		t.Run(tc.Name, func(t *testing.T) {
 			mailChatServiceFunc = tc.mockFunc
 
-			emailHandler := NewEmailHandler()
+			emailHandler := NewEmailHandler(memdb.New(), memdb.New(), nil)
 			emailHandler.emailService = &mockEmailService{}
 			rr := httptest.NewRecorder()
 			req, _ := http.NewRequest(http.MethodPost, "http://localhost:8080/mailChat", bytes.NewBuffer(tc.Body))
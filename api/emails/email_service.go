@@ -2,22 +2,31 @@ package emails
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"log"
+	"path/filepath"
 
 	"github.com/pranotobudi/myslack-happy-backend/api/messages"
 	"github.com/pranotobudi/myslack-happy-backend/api/users"
 	"github.com/pranotobudi/myslack-happy-backend/common"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgformat"
 )
 
 type IEmailService interface {
-	MailChat(userMongo mongodb.User) (string, error)
+	MailChat(ctx context.Context, userMongo mongodb.User) (string, error)
 }
 
+// emailTemplate is the template of the chat email, relative to the working directory of the server
+const emailTemplate = "./template/email.gohtml"
+
 type emailService struct {
-	repo mongodb.IMongoDB
+	userService    users.IUserService
+	messageService messages.IMessageService
+	mailer         common.Mailer
+	templatePath   string
 }
 type EmailChat struct {
 	Email string
@@ -37,14 +46,19 @@ func (e EmailRoom) String() string {
 	return fmt.Sprintf("RoomId: %v\n Messages:\n%v\n", e.RoomId, e.Messages)
 }
 
-// NewEmailService will return emailService object
-func NewEmailService() *emailService {
-	r := mongodb.NewMongoDB()
-	return &emailService{repo: r}
+// NewEmailService will return emailService object, the chat is read from userRepo and messageRepo and sent with mailer
+func NewEmailService(userRepo mongodb.UserRepository, messageRepo mongodb.MessageRepository, mailer common.Mailer) *emailService {
+	return &emailService{
+		userService:    users.NewUserService(userRepo),
+		messageService: messages.NewMessageService(messageRepo),
+		mailer:         mailer,
+		templatePath:   emailTemplate,
+	}
 }
 
-// UserMailChat will send email of chat with each room and its messages to the current user
-func (s *emailService) MailChat(userMongo mongodb.User) (string, error) {
+// MailChat will send email of chat with each room and its messages to the current user,
+// it fails when the email can not be rendered or sent
+func (s *emailService) MailChat(ctx context.Context, userMongo mongodb.User) (string, error) {
 	// remove all user rooms first
 	// update := bson.D{{"$set", bson.M{"rooms": []string{}}}}
 	// err := s.repo.UpdateUser(filter, update, opts)
@@ -54,9 +68,7 @@ func (s *emailService) MailChat(userMongo mongodb.User) (string, error) {
 	// paths := []string{
 	// 	"./template/email.html",
 	// }
-	messageService := messages.NewMessageService()
-	userService := users.NewUserService()
-	user, err := userService.GetUser(userMongo.Email)
+	user, err := s.userService.GetUser(ctx, userMongo.Email)
 	if err != nil {
 		return "", err
 	}
@@ -66,7 +78,7 @@ func (s *emailService) MailChat(userMongo mongodb.User) (string, error) {
 	emailChat.Email = user.Email
 
 	for _, roomId := range user.Rooms {
-		message, err := messageService.GetMessages(roomId)
+		message, err := s.messageService.GetMessages(ctx, roomId)
 		if err != nil {
 			return "", err
 		}
@@ -78,17 +90,41 @@ func (s *emailService) MailChat(userMongo mongodb.User) (string, error) {
 	}
 	// log.Println("EMAILCHAT STRUCT: ", emailChat)
 
+	body, err := renderEmail(s.templatePath, emailChat)
+	if err != nil {
+		log.Println("failed to render chat email: ", err)
+		return "", fmt.Errorf("failed to render chat email: %w", err)
+	}
+	toEmail := []string{emailChat.Email}
+	if err := s.mailer(toEmail, "Chat Messages Archive!", body); err != nil {
+		log.Println("failed to send chat email: ", err)
+		return "", fmt.Errorf("failed to send chat email: %w", err)
+	}
+
+	return "email sent succesfully to your email", nil
+}
+
+// renderEmail will execute the email template at path with emailChat
+func renderEmail(path string, emailChat EmailChat) (string, error) {
 	// t := template.Must(template.New("html-tmpl").ParseFiles(paths...))
-	t := template.Must(template.ParseFiles("./template/email.gohtml"))
+	t, err := template.New(filepath.Base(path)).Funcs(template.FuncMap{"messageHTML": messageHTML}).ParseFiles(path)
+	if err != nil {
+		return "", err
+	}
 	buf := new(bytes.Buffer)
 	// err = t.Execute(os.Stdout, emailChat)
 	err = t.Execute(buf, emailChat)
 	if err != nil {
-		// panic(err)
-		log.Println("LOADING TEMPLATE ERROR.")
+		return "", err
 	}
-	toEmail := []string{emailChat.Email}
-	common.SendEmail(toEmail, buf.String())
+	return buf.String(), nil
+}
 
-	return "email sent succesfully to your email", nil
+// messageHTML will return the rendered form of the message, so formatting survives in the email.
+// messages stored before rendering existed are rendered on the fly
+func messageHTML(message mongodb.Message) template.HTML {
+	if message.MessageHTML == "" {
+		return template.HTML(msgformat.Render(message.Message))
+	}
+	return template.HTML(message.MessageHTML)
 }
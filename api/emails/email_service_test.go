@@ -1 +1,80 @@
 package emails
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRenderEmail(t *testing.T) {
+	emailChat := EmailChat{
+		Email: "budi@gmail.com",
+		Rooms: []EmailRoom{
+			{
+				RoomId: "61cc50877ea033031b1a950e",
+				Messages: []mongodb.Message{
+					{Username: "budi", Message: "*hello*", MessageHTML: "<strong>hello</strong>"},
+					// stored before message_html existed
+					{Username: "lumion", Message: "_hi_ <script>alert(1)</script>"},
+				},
+			},
+		},
+	}
+
+	body, err := renderEmail("../../template/email.gohtml", emailChat)
+
+	assert.Nil(t, err)
+	assert.Contains(t, body, "<strong>hello</strong>")
+	assert.Contains(t, body, "<em>hi</em> &lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.NotContains(t, body, "<script>")
+}
+
+func TestMailChatService(t *testing.T) {
+	tt := []struct {
+		Name         string
+		templatePath string
+		mailerErr    error
+		SentWant     int
+		ErrWant      string
+	}{
+		{Name: "Sent", templatePath: "../../template/email.gohtml", SentWant: 1},
+		{Name: "Template missing", templatePath: "missing.gohtml", ErrWant: "failed to render chat email"},
+		{Name: "Mailer failed", templatePath: "../../template/email.gohtml", mailerErr: errors.New("smtp down"), SentWant: 1, ErrWant: "smtp down"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := context.Background()
+			db := memdb.New()
+			if _, err := db.AddUsers(ctx, []interface{}{bson.M{"email": "ocean@example.com", "rooms": bson.A{"room1"}}}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.AddMessage(ctx, bson.M{"room_id": "room1", "message": "hello", "seq": int64(1)}); err != nil {
+				t.Fatal(err)
+			}
+			var sent []string
+			mailer := func(toAddress []string, subject string, body string) error {
+				sent = append(sent, body)
+				return tc.mailerErr
+			}
+			emailService := NewEmailService(db, db, mailer)
+			emailService.templatePath = tc.templatePath
+
+			_, err := emailService.MailChat(ctx, mongodb.User{Email: "ocean@example.com"})
+
+			assert.Len(t, sent, tc.SentWant, "nothing is sent when the email can not be rendered")
+			if tc.ErrWant == "" {
+				assert.Nil(t, err)
+				assert.Contains(t, sent[0], "hello")
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tc.ErrWant)
+			}
+		})
+	}
+}
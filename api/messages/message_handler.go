@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
 )
 
 type IMessageHandler interface {
@@ -18,10 +19,10 @@ type messageHandler struct {
 }
 
 // NewMessageHandler initialize messageHandler object
-func NewMessageHandler() *messageHandler {
+func NewMessageHandler(repo mongodb.MessageRepository) *messageHandler {
 
 	// func NewMessageHandler(messageService IMessageService) *messageHandler {
-	messageService := NewMessageService()
+	messageService := NewMessageService(repo)
 	return &messageHandler{service: messageService}
 }
 
@@ -37,10 +38,11 @@ func (h *messageHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
 		// w.Write([]byte(fmt.Sprintf("%v", roomId)))
 		return
 	}
-	messages, err := h.service.GetMessages(roomId)
+	messages, err := h.service.GetMessages(r.Context(), roomId)
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		return
@@ -1,6 +1,7 @@
 package messages
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/pranotobudi/myslack-happy-backend/common"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -19,7 +21,7 @@ var (
 
 type mockMessageService struct{}
 
-func (m *mockMessageService) GetMessages(roomId string) ([]mongodb.Message, error) {
+func (m *mockMessageService) GetMessages(ctx context.Context, roomId string) ([]mongodb.Message, error) {
 	return getMessagesServiceFunc(roomId)
 }
 func TestGetMessagesHandler(t *testing.T) {
@@ -43,12 +45,19 @@ func TestGetMessagesHandler(t *testing.T) {
 			},
 			CodeWant: http.StatusInternalServerError,
 		},
+		{
+			Name: "GetMessages Failed database unavailable",
+			mockFunc: func(roomId string) ([]mongodb.Message, error) {
+				return nil, mongodb.ErrUnavailable
+			},
+			CodeWant: http.StatusServiceUnavailable,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getMessagesServiceFunc = tc.mockFunc
 
-			messageHandler := NewMessageHandler()
+			messageHandler := NewMessageHandler(memdb.New())
 			messageHandler.service = &mockMessageService{}
 			rr := httptest.NewRecorder()
 			req, _ := http.NewRequest(http.MethodGet, "http://localhost:8080/messages?room_id=61f61d94fc663b6f4c8f3172", nil)
@@ -1,27 +1,27 @@
 package messages
 
 import (
+	"context"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 type IMessageService interface {
-	GetMessages(roomId string) ([]mongodb.Message, error)
+	GetMessages(ctx context.Context, roomId string) ([]mongodb.Message, error)
 }
 type messageService struct {
-	repo mongodb.IMongoDB
+	repo mongodb.MessageRepository
 }
 
 // NewMessageService will initialize messageService object
-func NewMessageService() *messageService {
-	r := mongodb.NewMongoDB()
-	return &messageService{repo: r}
+func NewMessageService(repo mongodb.MessageRepository) *messageService {
+	return &messageService{repo: repo}
 }
 
 // GetMessages will get messages based on the filter argument
-func (s *messageService) GetMessages(roomId string) ([]mongodb.Message, error) {
+func (s *messageService) GetMessages(ctx context.Context, roomId string) ([]mongodb.Message, error) {
 	filter := bson.M{"room_id": roomId}
-	messages, err := s.repo.GetMessages(filter)
+	messages, err := s.repo.GetMessages(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package messages
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -13,10 +14,10 @@ var (
 )
 
 type mockMessageRepo struct {
-	mongodb.IMongoDB
+	mongodb.MessageRepository
 }
 
-func (m *mockMessageRepo) GetMessages(filter interface{}) ([]mongodb.Message, error) {
+func (m *mockMessageRepo) GetMessages(ctx context.Context, filter interface{}) ([]mongodb.Message, error) {
 	return getMessagesRepoFunc(filter)
 }
 func TestGetMessagesService(t *testing.T) {
@@ -47,10 +48,9 @@ func TestGetMessagesService(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getMessagesRepoFunc = tc.mockFunc
-			messageService := NewMessageService()
-			messageService.repo = &mockMessageRepo{}
+			messageService := NewMessageService(&mockMessageRepo{})
 
-			messages, err := messageService.GetMessages(tc.roomId)
+			messages, err := messageService.GetMessages(context.Background(), tc.roomId)
 
 			if tc.IsSuccess {
 				assert.NotNil(t, messages)
@@ -0,0 +1,103 @@
+package pins
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+type IPinHandler interface {
+	AddPin(w http.ResponseWriter, r *http.Request)
+	RemovePin(w http.ResponseWriter, r *http.Request)
+	GetPins(w http.ResponseWriter, r *http.Request)
+}
+type pinHandler struct {
+	pinService IPinService
+}
+
+// NewPinHandler will initialize pinHandler object
+func NewPinHandler(pinRepo mongodb.PinRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, broadcaster Broadcaster, roomConfig config.Room) *pinHandler {
+	pinService := NewPinService(pinRepo, messageRepo, userRepo, broadcaster, roomConfig)
+	return &pinHandler{pinService: pinService}
+}
+
+// AddPin will pin message {messageId} to room {id} for the user_id query parameter
+func (h *pinHandler) AddPin(w http.ResponseWriter, r *http.Request) {
+	roomId := chi.URLParam(r, "id")
+	messageId := chi.URLParam(r, "messageId")
+	userId := r.URL.Query().Get("user_id")
+
+	message, err := h.pinService.AddPin(r.Context(), roomId, messageId, userId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusCreated, "success", "pin message successfull", message)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RemovePin will unpin message {messageId} from room {id} for the user_id query parameter
+func (h *pinHandler) RemovePin(w http.ResponseWriter, r *http.Request) {
+	roomId := chi.URLParam(r, "id")
+	messageId := chi.URLParam(r, "messageId")
+	userId := r.URL.Query().Get("user_id")
+
+	if err := h.pinService.RemovePin(r.Context(), roomId, messageId, userId); err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "unpin message successfull", nil)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetPins will return the pinned messages of room {id} for the user_id query parameter, the latest pin first
+func (h *pinHandler) GetPins(w http.ResponseWriter, r *http.Request) {
+	roomId := chi.URLParam(r, "id")
+	userId := r.URL.Query().Get("user_id")
+
+	messages, err := h.pinService.GetPins(r.Context(), roomId, userId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "get pins successfull", messages)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errorCode will map an error of IPinService to a http status code
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, mongodb.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, mongodb.ErrRoomNotFound), errors.Is(err, mongodb.ErrPinNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, mongodb.ErrPinExists), errors.Is(err, mongodb.ErrPinLimit):
+		return http.StatusConflict
+	default:
+		return common.ErrorCode(err, http.StatusInternalServerError)
+	}
+}
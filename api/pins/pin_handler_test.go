@@ -0,0 +1,216 @@
+package pins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	addPinFunc    func(roomId string, messageId string, userId string) (*mongodb.Message, error)
+	removePinFunc func(roomId string, messageId string, userId string) error
+	getPinsFunc   func(roomId string, userId string) ([]mongodb.Message, error)
+)
+
+type mockService struct{}
+
+func (m *mockService) AddPin(ctx context.Context, roomId string, messageId string, userId string) (*mongodb.Message, error) {
+	return addPinFunc(roomId, messageId, userId)
+}
+func (m *mockService) RemovePin(ctx context.Context, roomId string, messageId string, userId string) error {
+	return removePinFunc(roomId, messageId, userId)
+}
+func (m *mockService) GetPins(ctx context.Context, roomId string, userId string) ([]mongodb.Message, error) {
+	return getPinsFunc(roomId, userId)
+}
+
+// newPinRequest will build a request with the chi url parameters set, as the router would
+func newPinRequest(method string) *http.Request {
+	req, _ := http.NewRequest(method, "/rooms/"+testRoomID+"/pins/"+testMessageID+"?user_id="+testUserID, nil)
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", testRoomID)
+	routeContext.URLParams.Add("messageId", testMessageID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+}
+
+func TestAddPin(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(roomId string, messageId string, userId string) (*mongodb.Message, error)
+		CodeWant int
+	}{
+		{
+			Name: "AddPin Success",
+			mockFunc: func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				return &mongodb.Message{ID: messageId, RoomID: roomId}, nil
+			},
+			CodeWant: http.StatusCreated,
+		},
+		{
+			Name: "AddPin Failed not a room member",
+			mockFunc: func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+		{
+			Name: "AddPin Failed message not found",
+			mockFunc: func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				return nil, ErrMessageNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+		{
+			Name: "AddPin Failed too many pins",
+			mockFunc: func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				return nil, mongodb.ErrPinLimit
+			},
+			CodeWant: http.StatusConflict,
+		},
+		{
+			Name: "AddPin Failed",
+			mockFunc: func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				return nil, errors.New("add pin failed")
+			},
+			CodeWant: http.StatusInternalServerError,
+		},
+		{
+			Name: "AddPin Failed deadline exceeded",
+			mockFunc: func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				return nil, fmt.Errorf("find message: %w", context.DeadlineExceeded)
+			},
+			CodeWant: http.StatusGatewayTimeout,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			addPinFunc = func(roomId string, messageId string, userId string) (*mongodb.Message, error) {
+				assert.Equal(t, testRoomID, roomId)
+				assert.Equal(t, testMessageID, messageId)
+				assert.Equal(t, testUserID, userId)
+				return tc.mockFunc(roomId, messageId, userId)
+			}
+
+			pinHandler := &pinHandler{pinService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			pinHandler.AddPin(rr, newPinRequest(http.MethodPost))
+
+			// check header StatusCode
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			// check response (JSON format) StatusCode
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestRemovePin(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(roomId string, messageId string, userId string) error
+		CodeWant int
+	}{
+		{
+			Name: "RemovePin Success",
+			mockFunc: func(roomId string, messageId string, userId string) error {
+				return nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name: "RemovePin Failed not pinned",
+			mockFunc: func(roomId string, messageId string, userId string) error {
+				return mongodb.ErrPinNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			removePinFunc = tc.mockFunc
+
+			pinHandler := &pinHandler{pinService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			pinHandler.RemovePin(rr, newPinRequest(http.MethodDelete))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestGetPins(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(roomId string, userId string) ([]mongodb.Message, error)
+		CodeWant int
+	}{
+		{
+			Name: "GetPins Success",
+			mockFunc: func(roomId string, userId string) ([]mongodb.Message, error) {
+				assert.Equal(t, testUserID, userId)
+				return []mongodb.Message{{ID: testMessageID}}, nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name: "GetPins Failed not a room member",
+			mockFunc: func(roomId string, userId string) ([]mongodb.Message, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+		{
+			Name: "GetPins Failed room not found",
+			mockFunc: func(roomId string, userId string) ([]mongodb.Message, error) {
+				return nil, mongodb.ErrRoomNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+		{
+			Name: "GetPins Failed database unavailable",
+			mockFunc: func(roomId string, userId string) ([]mongodb.Message, error) {
+				return nil, fmt.Errorf("%w: server selection error", mongodb.ErrUnavailable)
+			},
+			CodeWant: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getPinsFunc = tc.mockFunc
+
+			pinHandler := &pinHandler{pinService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			pinHandler.GetPins(rr, newPinRequest(http.MethodGet))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
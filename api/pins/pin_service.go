@@ -0,0 +1,131 @@
+package pins
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found in the room")
+)
+
+// Broadcaster sends a frame to every participant of a room, *msgserver.Hub is one
+type Broadcaster interface {
+	BroadcastEvent(roomId string, frame interface{})
+}
+
+type IPinService interface {
+	AddPin(ctx context.Context, roomId string, messageId string, userId string) (*mongodb.Message, error)
+	RemovePin(ctx context.Context, roomId string, messageId string, userId string) error
+	GetPins(ctx context.Context, roomId string, userId string) ([]mongodb.Message, error)
+}
+type pinService struct {
+	pinRepo     mongodb.PinRepository
+	messageRepo mongodb.MessageRepository
+	userRepo    mongodb.UserRepository
+	broadcaster Broadcaster
+	config      config.Room
+	now         func() time.Time
+}
+
+// NewPinService will initialize pinService object, the members are checked in userRepo and pin events are sent through broadcaster
+func NewPinService(pinRepo mongodb.PinRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, broadcaster Broadcaster, roomConfig config.Room) *pinService {
+	return &pinService{
+		pinRepo:     pinRepo,
+		messageRepo: messageRepo,
+		userRepo:    userRepo,
+		broadcaster: broadcaster,
+		config:      roomConfig,
+		now:         time.Now,
+	}
+}
+
+// AddPin will pin a message of the room, userId must be a member of the room
+func (s *pinService) AddPin(ctx context.Context, roomId string, messageId string, userId string) (*mongodb.Message, error) {
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, roomId); err != nil {
+		return nil, err
+	}
+	message, err := s.roomMessage(ctx, roomId, messageId)
+	if err != nil {
+		return nil, err
+	}
+
+	pin := mongodb.Pin{MessageID: messageId, UserID: userId, PinnedAt: s.now()}
+	if err := s.pinRepo.AddPin(ctx, roomId, pin, s.config.MaxPins); err != nil {
+		return nil, err
+	}
+	s.broadcaster.BroadcastEvent(roomId, msgserver.NewPinAddedEvent(*message, userId))
+	return message, nil
+}
+
+// RemovePin will unpin a message of the room, userId must be a member of the room
+func (s *pinService) RemovePin(ctx context.Context, roomId string, messageId string, userId string) error {
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, roomId); err != nil {
+		return err
+	}
+	if err := s.pinRepo.RemovePin(ctx, roomId, messageId); err != nil {
+		return err
+	}
+	s.broadcaster.BroadcastEvent(roomId, msgserver.NewPinRemovedEvent(roomId, messageId, userId))
+	return nil
+}
+
+// GetPins will get the pinned messages of the room, the latest pin first, userId must be a member of the room.
+// pins of deleted messages are left out
+func (s *pinService) GetPins(ctx context.Context, roomId string, userId string) ([]mongodb.Message, error) {
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, roomId); err != nil {
+		return nil, err
+	}
+	pins, err := s.pinRepo.GetPins(ctx, roomId)
+	if err != nil {
+		return nil, err
+	}
+	var ids []primitive.ObjectID
+	for _, pin := range pins {
+		if objID, err := primitive.ObjectIDFromHex(pin.MessageID); err == nil {
+			ids = append(ids, objID)
+		}
+	}
+	messages := []mongodb.Message{}
+	if len(ids) == 0 {
+		return messages, nil
+	}
+
+	found, err := s.messageRepo.GetMessages(ctx, bson.M{"_id": bson.M{"$in": ids}, "room_id": roomId})
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]mongodb.Message)
+	for _, message := range found {
+		byId[message.ID] = message
+	}
+	for i := len(pins) - 1; i >= 0; i-- {
+		if message, ok := byId[pins[i].MessageID]; ok {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// roomMessage will get the message, it must have been posted to the room
+func (s *pinService) roomMessage(ctx context.Context, roomId string, messageId string) (*mongodb.Message, error) {
+	objID, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	messages, err := s.messageRepo.GetMessages(ctx, bson.M{"_id": objID, "room_id": roomId})
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	return &messages[0], nil
+}
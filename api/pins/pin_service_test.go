@@ -0,0 +1,251 @@
+package pins
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUserID    = "61cfa908eca4dd2b9d11d9ee"
+	testRoomID    = "61cc50877ea033031b1a950e"
+	testMessageID = "61f61d94fc663b6f4c8f3190"
+)
+
+var (
+	getUserRepoFunc     func(filter interface{}) (*mongodb.User, error)
+	getMessagesRepoFunc func(filter interface{}) ([]mongodb.Message, error)
+	addPinRepoFunc      func(roomId string, pin mongodb.Pin, maxPins int) error
+	removePinRepoFunc   func(roomId string, messageId string) error
+	getPinsRepoFunc     func(roomId string) ([]mongodb.Pin, error)
+)
+
+type mockPinRepo struct {
+	mongodb.PinRepository
+	mongodb.MessageRepository
+	mongodb.UserRepository
+}
+
+func (m *mockPinRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockPinRepo) GetMessages(ctx context.Context, filter interface{}) ([]mongodb.Message, error) {
+	return getMessagesRepoFunc(filter)
+}
+func (m *mockPinRepo) AddPin(ctx context.Context, roomId string, pin mongodb.Pin, maxPins int) error {
+	return addPinRepoFunc(roomId, pin, maxPins)
+}
+func (m *mockPinRepo) RemovePin(ctx context.Context, roomId string, messageId string) error {
+	return removePinRepoFunc(roomId, messageId)
+}
+func (m *mockPinRepo) GetPins(ctx context.Context, roomId string) ([]mongodb.Pin, error) {
+	return getPinsRepoFunc(roomId)
+}
+
+type roomEvent struct {
+	roomId string
+	frame  interface{}
+}
+
+// mockBroadcaster records the events
+type mockBroadcaster struct {
+	events []roomEvent
+}
+
+func (b *mockBroadcaster) BroadcastEvent(roomId string, frame interface{}) {
+	b.events = append(b.events, roomEvent{roomId: roomId, frame: frame})
+}
+
+func newTestPinService() (*pinService, *mockBroadcaster) {
+	broadcaster := &mockBroadcaster{}
+	repo := &mockPinRepo{}
+	return &pinService{
+		pinRepo:     repo,
+		messageRepo: repo,
+		userRepo:    repo,
+		broadcaster: broadcaster,
+		config:      config.Room{MaxPins: 2},
+		now:         time.Now,
+	}, broadcaster
+}
+
+func memberOf(rooms ...string) func(filter interface{}) (*mongodb.User, error) {
+	return func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: testUserID, Rooms: rooms}, nil
+	}
+}
+
+func TestAddPinService(t *testing.T) {
+	roomMessage := func(filter interface{}) ([]mongodb.Message, error) {
+		return []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}}, nil
+	}
+
+	tt := []struct {
+		Name            string
+		getUserMockFunc func(filter interface{}) (*mongodb.User, error)
+		getMessagesFunc func(filter interface{}) ([]mongodb.Message, error)
+		addPinErr       error
+		ErrWant         error
+	}{
+		{
+			Name:            "AddPin Success",
+			getUserMockFunc: memberOf(testRoomID),
+			getMessagesFunc: roomMessage,
+		},
+		{
+			Name:            "AddPin Failed not a room member",
+			getUserMockFunc: memberOf("otherroom"),
+			getMessagesFunc: roomMessage,
+			ErrWant:         mongodb.ErrNotMember,
+		},
+		{
+			Name:            "AddPin Failed message of another room",
+			getUserMockFunc: memberOf(testRoomID),
+			getMessagesFunc: func(filter interface{}) ([]mongodb.Message, error) {
+				return nil, nil
+			},
+			ErrWant: ErrMessageNotFound,
+		},
+		{
+			Name:            "AddPin Failed too many pins",
+			getUserMockFunc: memberOf(testRoomID),
+			getMessagesFunc: roomMessage,
+			addPinErr:       mongodb.ErrPinLimit,
+			ErrWant:         mongodb.ErrPinLimit,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = tc.getUserMockFunc
+			getMessagesRepoFunc = tc.getMessagesFunc
+			var gotMax int
+			addPinRepoFunc = func(roomId string, pin mongodb.Pin, maxPins int) error {
+				gotMax = maxPins
+				assert.Equal(t, testMessageID, pin.MessageID)
+				assert.Equal(t, testUserID, pin.UserID)
+				return tc.addPinErr
+			}
+			pinService, broadcaster := newTestPinService()
+
+			message, err := pinService.AddPin(context.Background(), testRoomID, testMessageID, testUserID)
+
+			if tc.ErrWant != nil {
+				assert.Equal(t, tc.ErrWant, err)
+				assert.Nil(t, message)
+				assert.Empty(t, broadcaster.events)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, testMessageID, message.ID)
+			assert.Equal(t, 2, gotMax)
+			assert.Equal(t, 1, len(broadcaster.events))
+			event := broadcaster.events[0].frame.(msgserver.PinEvent)
+			assert.Equal(t, "pin_added", event.Type)
+			assert.Equal(t, testMessageID, event.Message.ID)
+		})
+	}
+}
+
+func TestRemovePinService(t *testing.T) {
+	tt := []struct {
+		Name         string
+		removePinErr error
+		ErrWant      error
+	}{
+		{Name: "RemovePin Success"},
+		{Name: "RemovePin Failed not pinned", removePinErr: mongodb.ErrPinNotFound, ErrWant: mongodb.ErrPinNotFound},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = memberOf(testRoomID)
+			removePinRepoFunc = func(roomId string, messageId string) error {
+				return tc.removePinErr
+			}
+			pinService, broadcaster := newTestPinService()
+
+			err := pinService.RemovePin(context.Background(), testRoomID, testMessageID, testUserID)
+
+			if tc.ErrWant != nil {
+				assert.Equal(t, tc.ErrWant, err)
+				assert.Empty(t, broadcaster.events)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(broadcaster.events))
+			assert.Equal(t, msgserver.NewPinRemovedEvent(testRoomID, testMessageID, testUserID), broadcaster.events[0].frame)
+		})
+	}
+}
+
+func TestGetPinsService(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Pins     []mongodb.Pin
+		Messages []mongodb.Message
+		Rooms    []string
+		PinsErr  error
+		ErrWant  error
+		IdsWant  []string
+	}{
+		{
+			Name:  "GetPins latest first, deleted messages left out",
+			Rooms: []string{testRoomID},
+			Pins: []mongodb.Pin{
+				{MessageID: "61f61d94fc663b6f4c8f3191"},
+				{MessageID: "61f61d94fc663b6f4c8f3192"},
+				{MessageID: "61f61d94fc663b6f4c8f3193"},
+			},
+			Messages: []mongodb.Message{{ID: "61f61d94fc663b6f4c8f3191"}, {ID: "61f61d94fc663b6f4c8f3193"}},
+			IdsWant:  []string{"61f61d94fc663b6f4c8f3193", "61f61d94fc663b6f4c8f3191"},
+		},
+		{
+			Name:    "GetPins no pins",
+			Rooms:   []string{testRoomID},
+			IdsWant: []string{},
+		},
+		{
+			Name:    "GetPins Failed not a room member",
+			Rooms:   []string{"otherroom"},
+			Pins:    []mongodb.Pin{{MessageID: "61f61d94fc663b6f4c8f3191"}},
+			ErrWant: mongodb.ErrNotMember,
+		},
+		{
+			Name:    "GetPins Failed",
+			Rooms:   []string{testRoomID},
+			PinsErr: errors.New("get pins failed"),
+			ErrWant: errors.New("get pins failed"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = memberOf(tc.Rooms...)
+			getPinsRepoFunc = func(roomId string) ([]mongodb.Pin, error) {
+				return tc.Pins, tc.PinsErr
+			}
+			getMessagesRepoFunc = func(filter interface{}) ([]mongodb.Message, error) {
+				return tc.Messages, nil
+			}
+			pinService, _ := newTestPinService()
+
+			messages, err := pinService.GetPins(context.Background(), testRoomID, testUserID)
+
+			if tc.ErrWant != nil {
+				assert.Equal(t, tc.ErrWant, err)
+				assert.Nil(t, messages)
+				return
+			}
+			assert.Nil(t, err)
+			ids := []string{}
+			for _, message := range messages {
+				ids = append(ids, message.ID)
+			}
+			assert.Equal(t, tc.IdsWant, ids)
+		})
+	}
+}
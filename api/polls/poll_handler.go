@@ -0,0 +1,117 @@
+package polls
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+type IPollHandler interface {
+	CreatePoll(w http.ResponseWriter, r *http.Request)
+	Vote(w http.ResponseWriter, r *http.Request)
+	GetPoll(w http.ResponseWriter, r *http.Request)
+}
+type pollHandler struct {
+	pollService IPollService
+}
+
+// NewPollHandler will initialize pollHandler object, the poll message is posted by poster and tally updates sent through broadcaster
+func NewPollHandler(pollRepo mongodb.PollRepository, userRepo mongodb.UserRepository, poster MessagePoster, broadcaster Broadcaster) *pollHandler {
+	pollService := NewPollService(pollRepo, userRepo, poster, broadcaster)
+	return &pollHandler{pollService: pollService}
+}
+
+// CreatePoll will create a poll in room {id} by the user_id query parameter, the body is NewPoll
+func (h *pollHandler) CreatePoll(w http.ResponseWriter, r *http.Request) {
+	roomId := chi.URLParam(r, "id")
+	userId := r.URL.Query().Get("user_id")
+
+	var newPoll NewPoll
+	if err := json.NewDecoder(r.Body).Decode(&newPoll); err != nil {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	results, err := h.pollService.CreatePoll(r.Context(), roomId, userId, newPoll)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusCreated, "success", "create poll successfull", results)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Vote will store the vote of the user_id query parameter in poll {id}, the body is NewVote
+func (h *pollHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	pollId := chi.URLParam(r, "id")
+	userId := r.URL.Query().Get("user_id")
+
+	var newVote NewVote
+	if err := json.NewDecoder(r.Body).Decode(&newVote); err != nil {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	results, err := h.pollService.Vote(r.Context(), pollId, userId, newVote)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "vote successfull", results)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetPoll will return poll {id} with its tally to the user_id query parameter
+func (h *pollHandler) GetPoll(w http.ResponseWriter, r *http.Request) {
+	pollId := chi.URLParam(r, "id")
+	userId := r.URL.Query().Get("user_id")
+
+	results, err := h.pollService.GetPoll(r.Context(), pollId, userId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "get poll successfull", results)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errorCode will map an error of IPollService to a http status code
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidPoll), errors.Is(err, ErrInvalidVote):
+		return http.StatusBadRequest
+	case errors.Is(err, mongodb.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, mongodb.ErrPollNotFound):
+		return http.StatusNotFound
+	default:
+		return common.ErrorCode(err, http.StatusInternalServerError)
+	}
+}
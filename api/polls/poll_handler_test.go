@@ -0,0 +1,180 @@
+package polls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	createPollFunc func(roomId string, userId string, newPoll NewPoll) (*PollResults, error)
+	voteFunc       func(pollId string, userId string, newVote NewVote) (*PollResults, error)
+	getPollFunc    func(pollId string, userId string) (*PollResults, error)
+)
+
+type mockService struct{}
+
+func (m *mockService) CreatePoll(ctx context.Context, roomId string, userId string, newPoll NewPoll) (*PollResults, error) {
+	return createPollFunc(roomId, userId, newPoll)
+}
+func (m *mockService) Vote(ctx context.Context, pollId string, userId string, newVote NewVote) (*PollResults, error) {
+	return voteFunc(pollId, userId, newVote)
+}
+func (m *mockService) GetPoll(ctx context.Context, pollId string, userId string) (*PollResults, error) {
+	return getPollFunc(pollId, userId)
+}
+
+// newPollRequest will build a request with the chi url parameter id set, as the router would
+func newPollRequest(method string, url string, id string, body string) *http.Request {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+}
+
+func TestCreatePoll(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		Body     string
+		mockFunc func(roomId string, userId string, newPoll NewPoll) (*PollResults, error)
+		CodeWant int
+	}{
+		{
+			Name: "CreatePoll Success",
+			Body: `{"question":"Lunch?","options":["pizza","sushi"],"multiple":true}`,
+			mockFunc: func(roomId string, userId string, newPoll NewPoll) (*PollResults, error) {
+				assert.Equal(t, testRoomID, roomId)
+				assert.Equal(t, NewPoll{Question: "Lunch?", Options: []string{"pizza", "sushi"}, Multiple: true}, newPoll)
+				return &PollResults{}, nil
+			},
+			CodeWant: http.StatusCreated,
+		},
+		{
+			Name:     "CreatePoll Failed invalid body",
+			Body:     `{"options":"pizza"}`,
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "CreatePoll Failed invalid poll",
+			Body: `{"question":"Lunch?"}`,
+			mockFunc: func(roomId string, userId string, newPoll NewPoll) (*PollResults, error) {
+				return nil, fmt.Errorf("%w: a poll has 2 to 10 options", ErrInvalidPoll)
+			},
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "CreatePoll Failed not a member",
+			Body: `{"question":"Lunch?"}`,
+			mockFunc: func(roomId string, userId string, newPoll NewPoll) (*PollResults, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			createPollFunc = tc.mockFunc
+
+			pollHandler := &pollHandler{pollService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			pollHandler.CreatePoll(rr, newPollRequest(http.MethodPost, "/rooms/"+testRoomID+"/polls?user_id="+testUserID, testRoomID, tc.Body))
+
+			// check header StatusCode
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			// check response (JSON format) StatusCode
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestVote(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		Body     string
+		mockFunc func(pollId string, userId string, newVote NewVote) (*PollResults, error)
+		CodeWant int
+	}{
+		{
+			Name: "Vote Success",
+			Body: `{"option_ids":["1"]}`,
+			mockFunc: func(pollId string, userId string, newVote NewVote) (*PollResults, error) {
+				assert.Equal(t, testPollID, pollId)
+				assert.Equal(t, testUserID, userId)
+				assert.Equal(t, []string{"1"}, newVote.OptionIDs)
+				return &PollResults{}, nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name: "Vote Failed invalid vote",
+			Body: `{"option_ids":["1","2"]}`,
+			mockFunc: func(pollId string, userId string, newVote NewVote) (*PollResults, error) {
+				return nil, fmt.Errorf("%w: only one option can be chosen", ErrInvalidVote)
+			},
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "Vote Failed poll not found",
+			Body: `{"option_ids":["1"]}`,
+			mockFunc: func(pollId string, userId string, newVote NewVote) (*PollResults, error) {
+				return nil, mongodb.ErrPollNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+		{
+			Name: "Vote Failed",
+			Body: `{"option_ids":["1"]}`,
+			mockFunc: func(pollId string, userId string, newVote NewVote) (*PollResults, error) {
+				return nil, errors.New("store failed")
+			},
+			CodeWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			voteFunc = tc.mockFunc
+
+			pollHandler := &pollHandler{pollService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			pollHandler.Vote(rr, newPollRequest(http.MethodPost, "/polls/"+testPollID+"/votes?user_id="+testUserID, testPollID, tc.Body))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestGetPoll(t *testing.T) {
+	getPollFunc = func(pollId string, userId string) (*PollResults, error) {
+		return &PollResults{Poll: mongodb.Poll{ID: pollId}}, nil
+	}
+
+	pollHandler := &pollHandler{pollService: &mockService{}}
+	rr := httptest.NewRecorder()
+
+	pollHandler.GetPoll(rr, newPollRequest(http.MethodGet, "/polls/"+testPollID+"?user_id="+testUserID, testPollID, ""))
+
+	assert.EqualValues(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,270 @@
+package polls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+)
+
+var (
+	ErrInvalidPoll = errors.New("invalid poll")
+	ErrInvalidVote = errors.New("invalid vote")
+)
+
+// limits of a poll
+const (
+	MinOptions        = 2
+	MaxOptions        = 10
+	MaxQuestionLength = 300
+	MaxOptionLength   = 100
+)
+
+// NewPoll is the body of POST /rooms/{id}/polls
+type NewPoll struct {
+	Question  string   `json:"question"`
+	Options   []string `json:"options"`
+	Multiple  bool     `json:"multiple"`
+	Anonymous bool     `json:"anonymous"`
+}
+
+// NewVote is the body of POST /polls/{id}/votes, a single choice poll takes exactly one option
+type NewVote struct {
+	OptionIDs []string `json:"option_ids"`
+}
+
+// OptionResult is the tally of one option, Voters is left out for anonymous polls
+type OptionResult struct {
+	ID     string   `json:"id"`
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+// PollResults is a poll with its tally, Voters counts the users who voted
+type PollResults struct {
+	Poll    mongodb.Poll   `json:"poll"`
+	Options []OptionResult `json:"options"`
+	Voters  int            `json:"voters"`
+}
+
+// MessagePoster posts a message to its room like a websocket message, *msgserver.Poster is one
+type MessagePoster interface {
+	PostMessage(ctx context.Context, clientMsg mongodb.ClientMessage) (string, error)
+}
+
+// Broadcaster sends a frame to every participant of a room, *msgserver.Hub is one
+type Broadcaster interface {
+	BroadcastEvent(roomId string, frame interface{})
+}
+
+type IPollService interface {
+	CreatePoll(ctx context.Context, roomId string, userId string, newPoll NewPoll) (*PollResults, error)
+	Vote(ctx context.Context, pollId string, userId string, newVote NewVote) (*PollResults, error)
+	GetPoll(ctx context.Context, pollId string, userId string) (*PollResults, error)
+}
+type pollService struct {
+	pollRepo    mongodb.PollRepository
+	userRepo    mongodb.UserRepository
+	poster      MessagePoster
+	broadcaster Broadcaster
+	now         func() time.Time
+}
+
+// NewPollService will initialize pollService object, the poll message is posted by poster and tally updates sent through broadcaster
+func NewPollService(pollRepo mongodb.PollRepository, userRepo mongodb.UserRepository, poster MessagePoster, broadcaster Broadcaster) *pollService {
+	return &pollService{pollRepo: pollRepo, userRepo: userRepo, poster: poster, broadcaster: broadcaster, now: time.Now}
+}
+
+// cleanupTimeout bounds repairing a poll whose announcement failed, the request context may be what expired
+const cleanupTimeout = 5 * time.Second
+
+// CreatePoll will store the poll and post the message announcing it to the room, userId must be a member of the room.
+// the poll is deleted again when the message can not be posted, so no poll is left without its message.
+// once posted the message carries the poll_id, so a poll whose link to the message failed is kept
+func (s *pollService) CreatePoll(ctx context.Context, roomId string, userId string, newPoll NewPoll) (*PollResults, error) {
+	poll, err := validatePoll(newPoll)
+	if err != nil {
+		return nil, err
+	}
+	user, err := mongodb.RoomMember(ctx, s.userRepo, userId, roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	poll.RoomID = roomId
+	poll.UserID = userId
+	poll.CreatedAt = s.now()
+	id, err := s.pollRepo.AddPoll(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+	poll.ID = id
+
+	clientMsg := mongodb.ClientMessage{
+		Message:   poll.Question,
+		UserID:    userId,
+		Username:  user.Username,
+		UserImage: user.UserImage,
+		RoomID:    roomId,
+		Timestamp: poll.CreatedAt,
+		// a retry of a failed post can not announce the poll twice
+		ClientMsgID: "poll-" + id,
+		PollID:      id,
+	}
+	messageId, err := s.poster.PostMessage(ctx, clientMsg)
+	if err != nil {
+		log.Println("CreatePoll - failed to post poll message: ", err)
+		s.deletePoll(id)
+		return nil, err
+	}
+	if err := s.pollRepo.SetPollMessage(ctx, id, messageId); err != nil {
+		log.Println("CreatePoll - failed to link poll message, retrying: ", err)
+		s.linkPollMessage(id, messageId)
+	}
+	poll.MessageID = messageId
+	return tally(poll, nil), nil
+}
+
+// Vote will store the vote of the user, replacing the vote cast before, and broadcast the new tally to the room
+func (s *pollService) Vote(ctx context.Context, pollId string, userId string, newVote NewVote) (*PollResults, error) {
+	poll, err := s.pollRepo.GetPoll(ctx, pollId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, poll.RoomID); err != nil {
+		return nil, err
+	}
+	if err := validateVote(*poll, newVote.OptionIDs); err != nil {
+		return nil, err
+	}
+
+	vote := mongodb.PollVote{PollID: pollId, UserID: userId, OptionIDs: newVote.OptionIDs, VotedAt: s.now()}
+	if err := s.pollRepo.SetPollVote(ctx, vote); err != nil {
+		return nil, err
+	}
+	votes, err := s.pollRepo.GetPollVotes(ctx, pollId)
+	if err != nil {
+		return nil, err
+	}
+	results := tally(*poll, votes)
+	s.broadcaster.BroadcastEvent(poll.RoomID, msgserver.NewPollUpdatedEvent(pollId, results))
+	return results, nil
+}
+
+// GetPoll will get the poll with its tally, userId must be a member of the poll's room
+func (s *pollService) GetPoll(ctx context.Context, pollId string, userId string) (*PollResults, error) {
+	poll, err := s.pollRepo.GetPoll(ctx, pollId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, poll.RoomID); err != nil {
+		return nil, err
+	}
+	votes, err := s.pollRepo.GetPollVotes(ctx, pollId)
+	if err != nil {
+		return nil, err
+	}
+	return tally(*poll, votes), nil
+}
+
+// validatePoll will clean newPoll and turn it into a poll, options get the ids "1", "2", ...
+func validatePoll(newPoll NewPoll) (mongodb.Poll, error) {
+	question := strings.TrimSpace(newPoll.Question)
+	if question == "" || utf8.RuneCountInString(question) > MaxQuestionLength {
+		return mongodb.Poll{}, fmt.Errorf("%w: the question must have 1 to %v characters", ErrInvalidPoll, MaxQuestionLength)
+	}
+	if len(newPoll.Options) < MinOptions || len(newPoll.Options) > MaxOptions {
+		return mongodb.Poll{}, fmt.Errorf("%w: a poll has %v to %v options", ErrInvalidPoll, MinOptions, MaxOptions)
+	}
+
+	poll := mongodb.Poll{Question: question, Multiple: newPoll.Multiple, Anonymous: newPoll.Anonymous}
+	seen := make(map[string]bool)
+	for i, text := range newPoll.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > MaxOptionLength {
+			return mongodb.Poll{}, fmt.Errorf("%w: an option must have 1 to %v characters", ErrInvalidPoll, MaxOptionLength)
+		}
+		if seen[text] {
+			return mongodb.Poll{}, fmt.Errorf("%w: option %q is given twice", ErrInvalidPoll, text)
+		}
+		seen[text] = true
+		poll.Options = append(poll.Options, mongodb.PollOption{ID: strconv.Itoa(i + 1), Text: text})
+	}
+	return poll, nil
+}
+
+// validateVote will check that the options exist in the poll, are not repeated and fit its choice type
+func validateVote(poll mongodb.Poll, optionIds []string) error {
+	if len(optionIds) == 0 {
+		return fmt.Errorf("%w: choose an option", ErrInvalidVote)
+	}
+	if !poll.Multiple && len(optionIds) > 1 {
+		return fmt.Errorf("%w: only one option can be chosen", ErrInvalidVote)
+	}
+	options := make(map[string]bool)
+	for _, option := range poll.Options {
+		options[option.ID] = true
+	}
+	chosen := make(map[string]bool)
+	for _, id := range optionIds {
+		if !options[id] {
+			return fmt.Errorf("%w: unknown option %q", ErrInvalidVote, id)
+		}
+		if chosen[id] {
+			return fmt.Errorf("%w: option %q is chosen twice", ErrInvalidVote, id)
+		}
+		chosen[id] = true
+	}
+	return nil
+}
+
+// deletePoll will delete a poll which could not be announced, a failure is only logged
+func (s *pollService) deletePoll(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := s.pollRepo.DeletePoll(ctx, id); err != nil {
+		log.Println("CreatePoll - failed to delete poll ", id, ": ", err)
+	}
+}
+
+// linkPollMessage will link the poll to the message announcing it once more, a failure is only logged
+// since the message still refers to the poll by its poll_id
+func (s *pollService) linkPollMessage(id string, messageId string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := s.pollRepo.SetPollMessage(ctx, id, messageId); err != nil {
+		log.Println("CreatePoll - failed to link poll ", id, " to message ", messageId, ": ", err)
+	}
+}
+
+// tally will count the votes per option, the voters are only listed when the poll is not anonymous
+func tally(poll mongodb.Poll, votes []mongodb.PollVote) *PollResults {
+	results := &PollResults{Poll: poll, Options: []OptionResult{}}
+	index := make(map[string]int)
+	for i, option := range poll.Options {
+		index[option.ID] = i
+		results.Options = append(results.Options, OptionResult{ID: option.ID, Text: option.Text})
+	}
+	for _, vote := range votes {
+		results.Voters++
+		for _, id := range vote.OptionIDs {
+			i, ok := index[id]
+			if !ok {
+				continue
+			}
+			results.Options[i].Votes++
+			if !poll.Anonymous {
+				results.Options[i].Voters = append(results.Options[i].Voters, vote.UserID)
+			}
+		}
+	}
+	return results
+}
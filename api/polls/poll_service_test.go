@@ -0,0 +1,325 @@
+package polls
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUserID = "61cfa908eca4dd2b9d11d9ee"
+	testRoomID = "61cc50877ea033031b1a950e"
+	testPollID = "61f61d94fc663b6f4c8f3199"
+)
+
+var (
+	getUserRepoFunc        func(filter interface{}) (*mongodb.User, error)
+	addPollRepoFunc        func(poll mongodb.Poll) (string, error)
+	getPollRepoFunc        func(id string) (*mongodb.Poll, error)
+	deletePollRepoFunc     func(id string) error
+	setPollMessageRepoFunc func(pollId string, messageId string) error
+	setPollVoteRepoFunc    func(vote mongodb.PollVote) error
+	getPollVotesRepoFunc   func(pollId string) ([]mongodb.PollVote, error)
+)
+
+type mockPollRepo struct {
+	mongodb.PollRepository
+	mongodb.UserRepository
+}
+
+func (m *mockPollRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockPollRepo) AddPoll(ctx context.Context, poll mongodb.Poll) (string, error) {
+	return addPollRepoFunc(poll)
+}
+func (m *mockPollRepo) GetPoll(ctx context.Context, id string) (*mongodb.Poll, error) {
+	return getPollRepoFunc(id)
+}
+func (m *mockPollRepo) DeletePoll(ctx context.Context, id string) error {
+	return deletePollRepoFunc(id)
+}
+func (m *mockPollRepo) SetPollMessage(ctx context.Context, pollId string, messageId string) error {
+	return setPollMessageRepoFunc(pollId, messageId)
+}
+func (m *mockPollRepo) SetPollVote(ctx context.Context, vote mongodb.PollVote) error {
+	return setPollVoteRepoFunc(vote)
+}
+func (m *mockPollRepo) GetPollVotes(ctx context.Context, pollId string) ([]mongodb.PollVote, error) {
+	return getPollVotesRepoFunc(pollId)
+}
+
+// mockPoster records the posted messages
+type mockPoster struct {
+	posted []mongodb.ClientMessage
+	err    error
+}
+
+func (p *mockPoster) PostMessage(ctx context.Context, clientMsg mongodb.ClientMessage) (string, error) {
+	p.posted = append(p.posted, clientMsg)
+	return "61f61d94fc663b6f4c8f3190", p.err
+}
+
+// mockBroadcaster records the broadcast frames
+type mockBroadcaster struct {
+	rooms  []string
+	frames []interface{}
+}
+
+func (b *mockBroadcaster) BroadcastEvent(roomId string, frame interface{}) {
+	b.rooms = append(b.rooms, roomId)
+	b.frames = append(b.frames, frame)
+}
+
+func memberOf(rooms ...string) func(filter interface{}) (*mongodb.User, error) {
+	return func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: testUserID, Username: "budi", Rooms: rooms}, nil
+	}
+}
+
+func TestCreatePollService(t *testing.T) {
+	tt := []struct {
+		Name    string
+		NewPoll NewPoll
+		Rooms   []string
+		postErr error
+		// linkErrs are returned by the successive links of the poll to its message
+		linkErrs []error
+		ErrWant  error
+		// DeletedWant is the poll deleted because it could not be announced
+		DeletedWant string
+	}{
+		{
+			Name:    "CreatePoll Success",
+			NewPoll: NewPoll{Question: " Lunch? ", Options: []string{"pizza", " sushi "}, Anonymous: true},
+			Rooms:   []string{testRoomID},
+		},
+		{
+			Name:    "CreatePoll Failed empty question",
+			NewPoll: NewPoll{Question: " ", Options: []string{"pizza", "sushi"}},
+			Rooms:   []string{testRoomID},
+			ErrWant: ErrInvalidPoll,
+		},
+		{
+			Name:    "CreatePoll Failed one option",
+			NewPoll: NewPoll{Question: "Lunch?", Options: []string{"pizza"}},
+			Rooms:   []string{testRoomID},
+			ErrWant: ErrInvalidPoll,
+		},
+		{
+			Name:    "CreatePoll Failed same option twice",
+			NewPoll: NewPoll{Question: "Lunch?", Options: []string{"pizza", "pizza "}},
+			Rooms:   []string{testRoomID},
+			ErrWant: ErrInvalidPoll,
+		},
+		{
+			Name:    "CreatePoll Failed not a member",
+			NewPoll: NewPoll{Question: "Lunch?", Options: []string{"pizza", "sushi"}},
+			Rooms:   []string{"otherroom"},
+			ErrWant: mongodb.ErrNotMember,
+		},
+		{
+			Name:        "CreatePoll Failed post message",
+			NewPoll:     NewPoll{Question: "Lunch?", Options: []string{"pizza", "sushi"}},
+			Rooms:       []string{testRoomID},
+			postErr:     errors.New("insert failed"),
+			ErrWant:     errors.New("insert failed"),
+			DeletedWant: testPollID,
+		},
+		{
+			Name:     "CreatePoll Success link message retried",
+			NewPoll:  NewPoll{Question: " Lunch? ", Options: []string{"pizza", " sushi "}, Anonymous: true},
+			Rooms:    []string{testRoomID},
+			linkErrs: []error{mongodb.ErrUnavailable, nil},
+		},
+		{
+			// the posted message refers to the poll, so the poll is kept
+			Name:     "CreatePoll Success link message failed",
+			NewPoll:  NewPoll{Question: " Lunch? ", Options: []string{"pizza", " sushi "}, Anonymous: true},
+			Rooms:    []string{testRoomID},
+			linkErrs: []error{mongodb.ErrUnavailable, mongodb.ErrUnavailable},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = memberOf(tc.Rooms...)
+			addPollRepoFunc = func(poll mongodb.Poll) (string, error) {
+				return testPollID, nil
+			}
+			linked := ""
+			links := 0
+			setPollMessageRepoFunc = func(pollId string, messageId string) error {
+				assert.Equal(t, testPollID, pollId)
+				linked = messageId
+				links++
+				if links <= len(tc.linkErrs) {
+					return tc.linkErrs[links-1]
+				}
+				return nil
+			}
+			deleted := ""
+			deletePollRepoFunc = func(id string) error {
+				deleted = id
+				return nil
+			}
+			poster := &mockPoster{err: tc.postErr}
+			pollService := &pollService{pollRepo: &mockPollRepo{}, userRepo: &mockPollRepo{}, poster: poster, broadcaster: &mockBroadcaster{}, now: time.Now}
+
+			results, err := pollService.CreatePoll(context.Background(), testRoomID, testUserID, tc.NewPoll)
+
+			if tc.ErrWant != nil {
+				if !errors.Is(err, tc.ErrWant) {
+					assert.Equal(t, tc.ErrWant, err)
+				}
+				assert.Nil(t, results)
+				assert.Equal(t, tc.DeletedWant, deleted)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Empty(t, deleted)
+			assert.Equal(t, "Lunch?", results.Poll.Question)
+			assert.Equal(t, []mongodb.PollOption{{ID: "1", Text: "pizza"}, {ID: "2", Text: "sushi"}}, results.Poll.Options)
+			assert.True(t, results.Poll.Anonymous)
+			// the poll is announced by a message of the room
+			if assert.Len(t, poster.posted, 1) {
+				assert.Equal(t, testPollID, poster.posted[0].PollID)
+				assert.Equal(t, "poll-"+testPollID, poster.posted[0].ClientMsgID)
+				assert.Equal(t, "budi", poster.posted[0].Username)
+			}
+			assert.Equal(t, "61f61d94fc663b6f4c8f3190", linked)
+			// a failed link is retried once
+			linksWant := 1
+			if len(tc.linkErrs) > 0 {
+				linksWant = 2
+			}
+			assert.Equal(t, linksWant, links)
+			assert.Equal(t, "61f61d94fc663b6f4c8f3190", results.Poll.MessageID)
+		})
+	}
+}
+
+func TestVoteService(t *testing.T) {
+	single := mongodb.Poll{ID: testPollID, RoomID: testRoomID, Options: []mongodb.PollOption{{ID: "1", Text: "pizza"}, {ID: "2", Text: "sushi"}, {ID: "3", Text: "salad"}}}
+	multiple := single
+	multiple.Multiple = true
+	anonymous := multiple
+	anonymous.Anonymous = true
+	others := []mongodb.PollVote{{PollID: testPollID, UserID: "u2", OptionIDs: []string{"2"}}}
+
+	tt := []struct {
+		Name        string
+		Poll        mongodb.Poll
+		OptionIDs   []string
+		Rooms       []string
+		ResultsWant []OptionResult
+		ErrWant     error
+	}{
+		{
+			Name:      "Vote Success single choice",
+			Poll:      single,
+			OptionIDs: []string{"2"},
+			Rooms:     []string{testRoomID},
+			ResultsWant: []OptionResult{
+				{ID: "1", Text: "pizza"},
+				{ID: "2", Text: "sushi", Votes: 2, Voters: []string{"u2", testUserID}},
+				{ID: "3", Text: "salad"},
+			},
+		},
+		{
+			Name:      "Vote Success multiple choice anonymous",
+			Poll:      anonymous,
+			OptionIDs: []string{"1", "2"},
+			Rooms:     []string{testRoomID},
+			ResultsWant: []OptionResult{
+				{ID: "1", Text: "pizza", Votes: 1},
+				{ID: "2", Text: "sushi", Votes: 2},
+				{ID: "3", Text: "salad"},
+			},
+		},
+		{
+			Name:      "Vote Failed many options in single choice",
+			Poll:      single,
+			OptionIDs: []string{"1", "2"},
+			Rooms:     []string{testRoomID},
+			ErrWant:   ErrInvalidVote,
+		},
+		{
+			Name:      "Vote Failed unknown option",
+			Poll:      multiple,
+			OptionIDs: []string{"1", "4"},
+			Rooms:     []string{testRoomID},
+			ErrWant:   ErrInvalidVote,
+		},
+		{
+			Name:      "Vote Failed same option twice",
+			Poll:      multiple,
+			OptionIDs: []string{"1", "1"},
+			Rooms:     []string{testRoomID},
+			ErrWant:   ErrInvalidVote,
+		},
+		{
+			Name:      "Vote Failed no option",
+			Poll:      multiple,
+			OptionIDs: []string{},
+			Rooms:     []string{testRoomID},
+			ErrWant:   ErrInvalidVote,
+		},
+		{
+			Name:      "Vote Failed not a member",
+			Poll:      single,
+			OptionIDs: []string{"1"},
+			Rooms:     []string{"otherroom"},
+			ErrWant:   mongodb.ErrNotMember,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = memberOf(tc.Rooms...)
+			getPollRepoFunc = func(id string) (*mongodb.Poll, error) {
+				poll := tc.Poll
+				return &poll, nil
+			}
+			var votes []mongodb.PollVote
+			setPollVoteRepoFunc = func(vote mongodb.PollVote) error {
+				votes = append(append([]mongodb.PollVote{}, others...), vote)
+				return nil
+			}
+			getPollVotesRepoFunc = func(pollId string) ([]mongodb.PollVote, error) {
+				return votes, nil
+			}
+			broadcaster := &mockBroadcaster{}
+			pollService := &pollService{pollRepo: &mockPollRepo{}, userRepo: &mockPollRepo{}, poster: &mockPoster{}, broadcaster: broadcaster, now: time.Now}
+
+			results, err := pollService.Vote(context.Background(), testPollID, testUserID, NewVote{OptionIDs: tc.OptionIDs})
+
+			if tc.ErrWant != nil {
+				assert.True(t, errors.Is(err, tc.ErrWant), err)
+				assert.Nil(t, results)
+				assert.Empty(t, broadcaster.frames)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.ResultsWant, results.Options)
+			assert.Equal(t, 2, results.Voters)
+			// the room sees the new tally right away
+			assert.Equal(t, []string{testRoomID}, broadcaster.rooms)
+			assert.Equal(t, []interface{}{msgserver.NewPollUpdatedEvent(testPollID, results)}, broadcaster.frames)
+		})
+	}
+}
+
+func TestGetPollService(t *testing.T) {
+	getPollRepoFunc = func(id string) (*mongodb.Poll, error) {
+		return nil, mongodb.ErrPollNotFound
+	}
+	pollService := &pollService{pollRepo: &mockPollRepo{}, userRepo: &mockPollRepo{}, poster: &mockPoster{}, broadcaster: &mockBroadcaster{}, now: time.Now}
+
+	results, err := pollService.GetPoll(context.Background(), testPollID, testUserID)
+	assert.Equal(t, mongodb.ErrPollNotFound, err)
+	assert.Nil(t, results)
+}
@@ -0,0 +1,114 @@
+package reminders
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+type IReminderHandler interface {
+	SetReminder(w http.ResponseWriter, r *http.Request)
+	GetReminders(w http.ResponseWriter, r *http.Request)
+	DeleteReminder(w http.ResponseWriter, r *http.Request)
+}
+type reminderHandler struct {
+	reminderService IReminderService
+}
+
+// NewReminderHandler will initialize reminderHandler object
+func NewReminderHandler(reminderRepo mongodb.ReminderRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, schedulerConfig config.Scheduler) *reminderHandler {
+	reminderService := NewReminderService(reminderRepo, messageRepo, userRepo, schedulerConfig)
+	return &reminderHandler{reminderService: reminderService}
+}
+
+// SetReminder will remind the user_id query parameter about message {messageId}, the body is NewReminder
+func (h *reminderHandler) SetReminder(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+	userId := r.URL.Query().Get("user_id")
+
+	var newReminder NewReminder
+	if err := json.NewDecoder(r.Body).Decode(&newReminder); err != nil {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	reminder, err := h.reminderService.SetReminder(r.Context(), userId, messageId, newReminder)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusCreated, "success", "set reminder successfull", reminder)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetReminders will return the reminders of the user_id query parameter which are not delivered yet
+func (h *reminderHandler) GetReminders(w http.ResponseWriter, r *http.Request) {
+	userId := r.URL.Query().Get("user_id")
+	if userId == "" {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, errors.New("user_id is required"))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	reminders, err := h.reminderService.GetReminders(r.Context(), userId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "get reminders successfull", reminders)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteReminder will delete the reminder of the user_id query parameter on message {messageId}
+func (h *reminderHandler) DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+	userId := r.URL.Query().Get("user_id")
+
+	if err := h.reminderService.DeleteReminder(r.Context(), userId, messageId); err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "delete reminder successfull", nil)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errorCode will map an error of IReminderService to a http status code
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidTime):
+		return http.StatusBadRequest
+	case errors.Is(err, mongodb.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, mongodb.ErrReminderNotFound):
+		return http.StatusNotFound
+	default:
+		return common.ErrorCode(err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,192 @@
+package reminders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	setReminderFunc    func(userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error)
+	getRemindersFunc   func(userId string) ([]mongodb.Reminder, error)
+	deleteReminderFunc func(userId string, messageId string) error
+)
+
+type mockService struct{}
+
+func (m *mockService) SetReminder(ctx context.Context, userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error) {
+	return setReminderFunc(userId, messageId, newReminder)
+}
+func (m *mockService) GetReminders(ctx context.Context, userId string) ([]mongodb.Reminder, error) {
+	return getRemindersFunc(userId)
+}
+func (m *mockService) DeleteReminder(ctx context.Context, userId string, messageId string) error {
+	return deleteReminderFunc(userId, messageId)
+}
+
+// newReminderRequest will build a request with the chi url parameters set, as the router would
+func newReminderRequest(method string, url string, body string) *http.Request {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("messageId", testMessageID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+}
+
+func TestSetReminder(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		Body     string
+		mockFunc func(userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error)
+		CodeWant int
+	}{
+		{
+			Name: "SetReminder Success",
+			Body: `{"in":"1h"}`,
+			mockFunc: func(userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error) {
+				assert.Equal(t, NewReminder{In: "1h"}, newReminder)
+				return &mongodb.Reminder{ID: "r1"}, nil
+			},
+			CodeWant: http.StatusCreated,
+		},
+		{
+			Name:     "SetReminder Failed invalid body",
+			Body:     `{"at":"tomorrow"}`,
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "SetReminder Failed invalid time",
+			Body: `{"in":"-1h"}`,
+			mockFunc: func(userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error) {
+				return nil, fmt.Errorf("%w: must be in the future", ErrInvalidTime)
+			},
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "SetReminder Failed can not see message",
+			Body: `{"in":"1h"}`,
+			mockFunc: func(userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			setReminderFunc = tc.mockFunc
+
+			reminderHandler := &reminderHandler{reminderService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			reminderHandler.SetReminder(rr, newReminderRequest(http.MethodPost, "/messages/"+testMessageID+"/reminder?user_id="+testUserID, tc.Body))
+
+			// check header StatusCode
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			// check response (JSON format) StatusCode
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestGetReminders(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		Query    string
+		mockFunc func(userId string) ([]mongodb.Reminder, error)
+		CodeWant int
+	}{
+		{
+			Name:  "GetReminders Success",
+			Query: "?user_id=" + testUserID,
+			mockFunc: func(userId string) ([]mongodb.Reminder, error) {
+				return []mongodb.Reminder{{ID: "r1", UserID: userId}}, nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name:     "GetReminders Failed missing user",
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name:  "GetReminders Failed",
+			Query: "?user_id=" + testUserID,
+			mockFunc: func(userId string) ([]mongodb.Reminder, error) {
+				return nil, errors.New("find failed")
+			},
+			CodeWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getRemindersFunc = tc.mockFunc
+
+			reminderHandler := &reminderHandler{reminderService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			reminderHandler.GetReminders(rr, newReminderRequest(http.MethodGet, "/me/reminders"+tc.Query, ""))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestDeleteReminder(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(userId string, messageId string) error
+		CodeWant int
+	}{
+		{
+			Name: "DeleteReminder Success",
+			mockFunc: func(userId string, messageId string) error {
+				return nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name: "DeleteReminder Failed not found",
+			mockFunc: func(userId string, messageId string) error {
+				return mongodb.ErrReminderNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			deleteReminderFunc = tc.mockFunc
+
+			reminderHandler := &reminderHandler{reminderService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			reminderHandler.DeleteReminder(rr, newReminderRequest(http.MethodDelete, "/messages/"+testMessageID+"/reminder?user_id="+testUserID, ""))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"sync"
+
+	"github.com/pranotobudi/myslack-happy-backend/clock"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgformat"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errors recorded on a reminder which can not be delivered
+var (
+	errMessageDeleted = errors.New("message was deleted")
+	errNoEmail        = errors.New("user is offline and has no email")
+)
+
+// Notifier sends a frame to every live connection of the users and tells who had one, *msgserver.Hub is one
+type Notifier interface {
+	NotifyDelivered(userIds []string, frame interface{}) []string
+}
+
+// reminderEmail is sent to a user who is offline when the reminder is due
+var reminderEmail = template.Must(template.New("reminder").Parse(`<html>
+<body>
+  <p>Hi {{.Username}}, you asked to be reminded about this message:</p>
+  <blockquote><b>{{.Message.Username}}</b>: {{.MessageHTML}}</blockquote>
+</body>
+</html>`))
+
+// Scheduler delivers the due reminders to the live connections of their users, by email when they are offline
+type Scheduler struct {
+	reminderRepo mongodb.ReminderRepository
+	messageRepo  mongodb.MessageRepository
+	userRepo     mongodb.UserRepository
+	notifier     Notifier
+	mailer       common.Mailer
+	clock        clock.Clock
+	config       config.Scheduler
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewScheduler will initialize Scheduler object, offline users are emailed with mailer
+func NewScheduler(reminderRepo mongodb.ReminderRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, notifier Notifier, mailer common.Mailer, clk clock.Clock, schedulerConfig config.Scheduler) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		reminderRepo: reminderRepo,
+		messageRepo:  messageRepo,
+		userRepo:     userRepo,
+		notifier:     notifier,
+		mailer:       mailer,
+		clock:        clk,
+		config:       schedulerConfig,
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+}
+
+// Run will deliver the due reminders every interval until Shutdown
+func (s *Scheduler) Run() {
+	log.Println("reminder scheduler running, interval: ", s.config.Interval)
+	defer close(s.done)
+	for {
+		s.deliverDue()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.clock.After(s.config.Interval):
+		}
+	}
+}
+
+// Shutdown will stop Run once the reminder being delivered, if any, is done
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(s.cancel)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliverDue will deliver every reminder which is due, it returns how many were claimed
+func (s *Scheduler) deliverDue() int {
+	claimed := 0
+	for s.ctx.Err() == nil {
+		if !s.deliverNext() {
+			break
+		}
+		claimed++
+	}
+	return claimed
+}
+
+// deliverNext will claim and deliver the earliest due reminder, it returns false when none was claimed.
+// Shutdown does not cancel a reminder being delivered, the lease bounds it instead
+func (s *Scheduler) deliverNext() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Lease)
+	defer cancel()
+
+	now := s.clock.Now()
+	reminder, err := s.reminderRepo.ClaimReminder(ctx, now, now.Add(-s.config.Lease))
+	if err == mongodb.ErrReminderNotFound {
+		return false
+	}
+	if err != nil {
+		log.Println("reminder scheduler - failed to claim reminder: ", err)
+		return false
+	}
+	s.deliver(ctx, *reminder)
+	return true
+}
+
+// deliver will deliver the reminder and record the outcome.
+// a reminder which can not be delivered, also by email, fails, on other errors it stays claimed and is retried once the lease expired
+func (s *Scheduler) deliver(ctx context.Context, reminder mongodb.Reminder) {
+	deliveredVia, err := s.send(ctx, reminder)
+	failure := ""
+	switch {
+	case err == errMessageDeleted, err == errNoEmail, errors.Is(err, mongodb.ErrNotMember), common.IsPermanentMailError(err):
+		log.Println("reminder scheduler - reminder failed: ", reminder.ID, " error: ", err)
+		failure = err.Error()
+	case err != nil:
+		log.Println("reminder scheduler - failed to deliver reminder, retry after lease: ", reminder.ID, " error: ", err)
+		return
+	}
+	if err := s.reminderRepo.FinishReminder(ctx, reminder.ID, deliveredVia, failure); err != nil {
+		log.Println("reminder scheduler - failed to finish reminder: ", reminder.ID, " error: ", err)
+	}
+}
+
+// send will push the reminder event to the live connections of the user, or email it when there is none.
+// it returns how the reminder was delivered
+func (s *Scheduler) send(ctx context.Context, reminder mongodb.Reminder) (string, error) {
+	objID, err := primitive.ObjectIDFromHex(reminder.MessageID)
+	if err != nil {
+		return "", errMessageDeleted
+	}
+	messages, err := s.messageRepo.GetMessages(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", errMessageDeleted
+	}
+	message := messages[0]
+
+	// a user who left the room meanwhile can not see the message anymore
+	user, err := mongodb.RoomMember(ctx, s.userRepo, reminder.UserID, message.RoomID)
+	if err != nil {
+		return "", err
+	}
+
+	delivered := s.notifier.NotifyDelivered([]string{reminder.UserID}, msgserver.NewReminderEvent(reminder.ID, message))
+	if len(delivered) > 0 {
+		return mongodb.DeliveredViaWebsocket, nil
+	}
+
+	if user.Email == "" {
+		return "", errNoEmail
+	}
+	body, err := renderReminder(*user, message)
+	if err != nil {
+		return "", err
+	}
+	if err := s.mailer([]string{user.Email}, "Reminder: a message on myslack", body); err != nil {
+		return "", err
+	}
+	return mongodb.DeliveredViaEmail, nil
+}
+
+// renderReminder will render the reminder email of the message for the user
+func renderReminder(user mongodb.User, message mongodb.Message) (string, error) {
+	messageHTML := message.MessageHTML
+	if messageHTML == "" {
+		messageHTML = msgformat.Render(message.Message)
+	}
+	data := struct {
+		Username    string
+		Message     mongodb.Message
+		MessageHTML template.HTML
+	}{user.Username, message, template.HTML(messageHTML)}
+
+	buf := new(bytes.Buffer)
+	if err := reminderEmail.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,186 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	claimReminderRepoFunc  func(now time.Time, staleBefore time.Time) (*mongodb.Reminder, error)
+	finishReminderRepoFunc func(id string, deliveredVia string, failure string) error
+)
+
+func (m *mockReminderRepo) ClaimReminder(ctx context.Context, now time.Time, staleBefore time.Time) (*mongodb.Reminder, error) {
+	return claimReminderRepoFunc(now, staleBefore)
+}
+func (m *mockReminderRepo) FinishReminder(ctx context.Context, id string, deliveredVia string, failure string) error {
+	return finishReminderRepoFunc(id, deliveredVia, failure)
+}
+
+// mockNotifier tells every user in online had a live connection
+type mockNotifier struct {
+	online map[string]bool
+	frames []interface{}
+}
+
+func (n *mockNotifier) NotifyDelivered(userIds []string, frame interface{}) []string {
+	n.frames = append(n.frames, frame)
+	var delivered []string
+	for _, userId := range userIds {
+		if n.online[userId] {
+			delivered = append(delivered, userId)
+		}
+	}
+	return delivered
+}
+
+func TestSchedulerDeliverDue(t *testing.T) {
+	rejected := &textproto.Error{Code: 550, Msg: "mailbox unavailable"}
+	due := mongodb.Reminder{ID: "r1", UserID: testUserID, MessageID: testMessageID, RoomID: testRoomID, Status: mongodb.ReminderSending}
+	message := mongodb.Message{ID: testMessageID, RoomID: testRoomID, Username: "ani", Message: "standup at *10*"}
+
+	tt := []struct {
+		Name             string
+		Messages         []mongodb.Message
+		User             mongodb.User
+		Online           bool
+		mailErr          error
+		Finished         bool
+		DeliveredViaWant string
+		FailureWant      string
+		MailWant         bool
+	}{
+		{
+			Name:             "Delivered to the live connections",
+			Messages:         []mongodb.Message{message},
+			User:             mongodb.User{ID: testUserID, Email: "budi@example.com", Rooms: []string{testRoomID}},
+			Online:           true,
+			Finished:         true,
+			DeliveredViaWant: mongodb.DeliveredViaWebsocket,
+		},
+		{
+			Name:             "Delivered by email when offline",
+			Messages:         []mongodb.Message{message},
+			User:             mongodb.User{ID: testUserID, Username: "budi", Email: "budi@example.com", Rooms: []string{testRoomID}},
+			Finished:         true,
+			DeliveredViaWant: mongodb.DeliveredViaEmail,
+			MailWant:         true,
+		},
+		{
+			Name:        "Failed offline without email",
+			Messages:    []mongodb.Message{message},
+			User:        mongodb.User{ID: testUserID, Rooms: []string{testRoomID}},
+			Finished:    true,
+			FailureWant: errNoEmail.Error(),
+		},
+		{
+			Name:        "Failed message deleted",
+			User:        mongodb.User{ID: testUserID, Rooms: []string{testRoomID}},
+			Online:      true,
+			Finished:    true,
+			FailureWant: errMessageDeleted.Error(),
+		},
+		{
+			Name:        "Failed user left the room",
+			Messages:    []mongodb.Message{message},
+			User:        mongodb.User{ID: testUserID, Rooms: []string{"otherroom"}},
+			Online:      true,
+			Finished:    true,
+			FailureWant: mongodb.ErrNotMember.Error(),
+		},
+		{
+			Name:     "Email failed, retried after the lease",
+			Messages: []mongodb.Message{message},
+			User:     mongodb.User{ID: testUserID, Email: "budi@example.com", Rooms: []string{testRoomID}},
+			mailErr:  errors.New("smtp unavailable"),
+			MailWant: true,
+		},
+		{
+			Name:        "Failed mail not configured",
+			Messages:    []mongodb.Message{message},
+			User:        mongodb.User{ID: testUserID, Email: "budi@example.com", Rooms: []string{testRoomID}},
+			mailErr:     common.ErrMailNotConfigured,
+			Finished:    true,
+			FailureWant: common.ErrMailNotConfigured.Error(),
+			MailWant:    true,
+		},
+		{
+			Name:        "Failed email rejected",
+			Messages:    []mongodb.Message{message},
+			User:        mongodb.User{ID: testUserID, Email: "budi@example.com", Rooms: []string{testRoomID}},
+			mailErr:     rejected,
+			Finished:    true,
+			FailureWant: rejected.Error(),
+			MailWant:    true,
+		},
+		{
+			Name:     "Email deferred, retried after the lease",
+			Messages: []mongodb.Message{message},
+			User:     mongodb.User{ID: testUserID, Email: "budi@example.com", Rooms: []string{testRoomID}},
+			mailErr:  &textproto.Error{Code: 421, Msg: "service not available"},
+			MailWant: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			clk := fixedClock(testNow)
+			claimed := false
+			claimReminderRepoFunc = func(now time.Time, staleBefore time.Time) (*mongodb.Reminder, error) {
+				assert.Equal(t, testNow, now)
+				assert.Equal(t, testNow.Add(-time.Minute), staleBefore)
+				if claimed {
+					return nil, mongodb.ErrReminderNotFound
+				}
+				claimed = true
+				reminder := due
+				return &reminder, nil
+			}
+			getMessagesRepoFunc = func(filter interface{}) ([]mongodb.Message, error) {
+				return tc.Messages, nil
+			}
+			getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+				user := tc.User
+				return &user, nil
+			}
+			finished := false
+			finishReminderRepoFunc = func(id string, deliveredVia string, failure string) error {
+				finished = true
+				assert.Equal(t, "r1", id)
+				assert.Equal(t, tc.DeliveredViaWant, deliveredVia)
+				assert.Equal(t, tc.FailureWant, failure)
+				return nil
+			}
+			mailed := ""
+			mailer := func(toAddress []string, subject string, body string) error {
+				assert.Equal(t, []string{tc.User.Email}, toAddress)
+				mailed = body
+				return tc.mailErr
+			}
+			notifier := &mockNotifier{online: map[string]bool{testUserID: tc.Online}}
+
+			repo := &mockReminderRepo{}
+			scheduler := NewScheduler(repo, repo, repo, notifier, mailer, clk, config.Scheduler{Interval: time.Second, Lease: time.Minute})
+
+			assert.Equal(t, 1, scheduler.deliverDue())
+			assert.Equal(t, tc.Finished, finished)
+			assert.Equal(t, tc.MailWant, mailed != "")
+			if tc.MailWant {
+				// the message is rendered like in the archive email
+				assert.True(t, strings.Contains(mailed, "<strong>10</strong>"), mailed)
+			}
+			if tc.DeliveredViaWant != "" {
+				assert.Equal(t, msgserver.NewReminderEvent("r1", message), notifier.frames[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/clock"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidTime     = errors.New("invalid reminder time")
+)
+
+// NewReminder is the body of POST /messages/{messageId}/reminder, either In or At is set.
+// In is a duration like "1h" or "30m", a client offering "tomorrow" sends the time it means in At
+type NewReminder struct {
+	In string    `json:"in,omitempty"`
+	At time.Time `json:"at,omitempty"`
+}
+
+type IReminderService interface {
+	SetReminder(ctx context.Context, userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error)
+	GetReminders(ctx context.Context, userId string) ([]mongodb.Reminder, error)
+	DeleteReminder(ctx context.Context, userId string, messageId string) error
+}
+type reminderService struct {
+	reminderRepo mongodb.ReminderRepository
+	messageRepo  mongodb.MessageRepository
+	userRepo     mongodb.UserRepository
+	clock        clock.Clock
+	config       config.Scheduler
+}
+
+// NewReminderService will initialize reminderService object, how far ahead a reminder may be set is limited by schedulerConfig
+func NewReminderService(reminderRepo mongodb.ReminderRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, schedulerConfig config.Scheduler) *reminderService {
+	return &reminderService{
+		reminderRepo: reminderRepo,
+		messageRepo:  messageRepo,
+		userRepo:     userRepo,
+		clock:        clock.System{},
+		config:       schedulerConfig,
+	}
+}
+
+// SetReminder will remind the user about the message, replacing the reminder set before on the same message.
+// the user must be a member of the message's room
+func (s *reminderService) SetReminder(ctx context.Context, userId string, messageId string, newReminder NewReminder) (*mongodb.Reminder, error) {
+	now := s.clock.Now()
+	remindAt, err := s.remindAt(now, newReminder)
+	if err != nil {
+		return nil, err
+	}
+
+	objID, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	messages, err := s.messageRepo.GetMessages(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	message := messages[0]
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, message.RoomID); err != nil {
+		return nil, err
+	}
+
+	reminder := mongodb.Reminder{
+		UserID:    userId,
+		MessageID: messageId,
+		RoomID:    message.RoomID,
+		RemindAt:  remindAt,
+		CreatedAt: now,
+		Status:    mongodb.ReminderPending,
+	}
+	return s.reminderRepo.SetReminder(ctx, reminder)
+}
+
+// GetReminders will get the reminders of the user which are not delivered yet, failed ones included
+func (s *reminderService) GetReminders(ctx context.Context, userId string) ([]mongodb.Reminder, error) {
+	return s.reminderRepo.GetReminders(ctx, userId)
+}
+
+// DeleteReminder will delete the reminder of the user on the message
+func (s *reminderService) DeleteReminder(ctx context.Context, userId string, messageId string) error {
+	return s.reminderRepo.DeleteReminder(ctx, userId, messageId)
+}
+
+// remindAt will return when newReminder is due, it must be in the future but not farther than MaxAhead
+func (s *reminderService) remindAt(now time.Time, newReminder NewReminder) (time.Time, error) {
+	remindAt := newReminder.At
+	if newReminder.In != "" {
+		if !newReminder.At.IsZero() {
+			return time.Time{}, fmt.Errorf("%w: set either in or at", ErrInvalidTime)
+		}
+		in, err := time.ParseDuration(newReminder.In)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidTime, err)
+		}
+		remindAt = now.Add(in)
+	}
+	if !remindAt.After(now) {
+		return time.Time{}, fmt.Errorf("%w: must be in the future", ErrInvalidTime)
+	}
+	if remindAt.After(now.Add(s.config.MaxAhead)) {
+		return time.Time{}, fmt.Errorf("%w: must be within %v", ErrInvalidTime, s.config.MaxAhead)
+	}
+	return remindAt, nil
+}
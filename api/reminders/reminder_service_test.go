@@ -0,0 +1,140 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUserID    = "61cfa908eca4dd2b9d11d9ee"
+	testRoomID    = "61cc50877ea033031b1a950e"
+	testMessageID = "61f61d94fc663b6f4c8f3190"
+)
+
+var (
+	getUserRepoFunc     func(filter interface{}) (*mongodb.User, error)
+	getMessagesRepoFunc func(filter interface{}) ([]mongodb.Message, error)
+	setReminderRepoFunc func(reminder mongodb.Reminder) (*mongodb.Reminder, error)
+)
+
+type mockReminderRepo struct {
+	mongodb.ReminderRepository
+	mongodb.MessageRepository
+	mongodb.UserRepository
+}
+
+func (m *mockReminderRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockReminderRepo) GetMessages(ctx context.Context, filter interface{}) ([]mongodb.Message, error) {
+	return getMessagesRepoFunc(filter)
+}
+func (m *mockReminderRepo) SetReminder(ctx context.Context, reminder mongodb.Reminder) (*mongodb.Reminder, error) {
+	return setReminderRepoFunc(reminder)
+}
+
+// fixedClock always tells the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time)
+}
+
+var testNow = time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+func TestSetReminderService(t *testing.T) {
+	tt := []struct {
+		Name         string
+		NewReminder  NewReminder
+		Messages     []mongodb.Message
+		Rooms        []string
+		RemindAtWant time.Time
+		ErrWant      error
+	}{
+		{
+			Name:         "SetReminder Success in 1 hour",
+			NewReminder:  NewReminder{In: "1h"},
+			Messages:     []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}},
+			Rooms:        []string{testRoomID},
+			RemindAtWant: testNow.Add(time.Hour),
+		},
+		{
+			Name:         "SetReminder Success tomorrow",
+			NewReminder:  NewReminder{At: time.Date(2022, 2, 2, 9, 0, 0, 0, time.UTC)},
+			Messages:     []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}},
+			Rooms:        []string{testRoomID},
+			RemindAtWant: time.Date(2022, 2, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:        "SetReminder Failed invalid duration",
+			NewReminder: NewReminder{In: "soon"},
+			ErrWant:     ErrInvalidTime,
+		},
+		{
+			Name:        "SetReminder Failed both in and at",
+			NewReminder: NewReminder{In: "1h", At: testNow.Add(time.Hour)},
+			ErrWant:     ErrInvalidTime,
+		},
+		{
+			Name:        "SetReminder Failed in the past",
+			NewReminder: NewReminder{In: "-1h"},
+			ErrWant:     ErrInvalidTime,
+		},
+		{
+			Name:        "SetReminder Failed too far ahead",
+			NewReminder: NewReminder{In: "72h"},
+			ErrWant:     ErrInvalidTime,
+		},
+		{
+			Name:        "SetReminder Failed message not found",
+			NewReminder: NewReminder{In: "1h"},
+			Rooms:       []string{testRoomID},
+			ErrWant:     ErrMessageNotFound,
+		},
+		{
+			Name:        "SetReminder Failed message of another room",
+			NewReminder: NewReminder{In: "1h"},
+			Messages:    []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}},
+			Rooms:       []string{"otherroom"},
+			ErrWant:     mongodb.ErrNotMember,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getMessagesRepoFunc = func(filter interface{}) ([]mongodb.Message, error) {
+				return tc.Messages, nil
+			}
+			getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+				return &mongodb.User{ID: testUserID, Rooms: tc.Rooms}, nil
+			}
+			setReminderRepoFunc = func(reminder mongodb.Reminder) (*mongodb.Reminder, error) {
+				reminder.ID = "r1"
+				return &reminder, nil
+			}
+			repo := &mockReminderRepo{}
+			reminderService := NewReminderService(repo, repo, repo, config.Scheduler{MaxAhead: 48 * time.Hour})
+			reminderService.clock = fixedClock(testNow)
+
+			reminder, err := reminderService.SetReminder(context.Background(), testUserID, testMessageID, tc.NewReminder)
+
+			if tc.ErrWant != nil {
+				assert.True(t, errors.Is(err, tc.ErrWant), err)
+				assert.Nil(t, reminder)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.RemindAtWant, reminder.RemindAt)
+			assert.Equal(t, testRoomID, reminder.RoomID)
+			assert.Equal(t, mongodb.ReminderPending, reminder.Status)
+		})
+	}
+}
@@ -22,18 +22,19 @@ type roomHandler struct {
 }
 
 // NewRoomHandler will initialize roomHandler object
-func NewRoomHandler() *roomHandler {
-	roomService := NewRoomService()
+func NewRoomHandler(repo mongodb.RoomRepository) *roomHandler {
+	roomService := NewRoomService(repo)
 	return &roomHandler{roomService: roomService}
 }
 
 // GetRooms will return all rooms available
 func (h *roomHandler) GetRooms(w http.ResponseWriter, r *http.Request) {
 	// rooms, err := mongo.GetRooms()
-	rooms, err := h.roomService.GetRooms()
+	rooms, err := h.roomService.GetRooms(r.Context())
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
@@ -53,10 +54,11 @@ func (h *roomHandler) GetRooms(w http.ResponseWriter, r *http.Request) {
 func (h *roomHandler) GetAnyRoom(w http.ResponseWriter, r *http.Request) {
 	// request: userId
 	// response: user snapshot to load main page
-	roomPtr, err := h.roomService.GetAnyRoom()
+	roomPtr, err := h.roomService.GetAnyRoom(r.Context())
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
@@ -89,10 +91,11 @@ func (h *roomHandler) AddRoom(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Println("JSON roomName: ", room.Name)
 	// roomId, err := mongo.AddRoom(room.Name)
-	roomId, err := h.roomService.AddRoom(room.Name)
+	roomId, err := h.roomService.AddRoom(r.Context(), room.Name)
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, errors.New("add room failed"))
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, errors.New("add room failed"))
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", roomId)))
 		// c.JSON(http.StatusInternalServerError, roomId)
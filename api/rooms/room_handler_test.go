@@ -2,6 +2,7 @@ package rooms
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/pranotobudi/myslack-happy-backend/common"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,13 +27,13 @@ type mockService struct{}
 // 	mock.Mock
 // }
 
-func (m *mockService) GetRooms() ([]mongodb.Room, error) {
+func (m *mockService) GetRooms(ctx context.Context) ([]mongodb.Room, error) {
 	return getRoomsFunc()
 }
-func (m *mockService) GetAnyRoom() (*mongodb.Room, error) {
+func (m *mockService) GetAnyRoom(ctx context.Context) (*mongodb.Room, error) {
 	return getAnyRoomFunc()
 }
-func (m *mockService) AddRoom(name string) (string, error) {
+func (m *mockService) AddRoom(ctx context.Context, name string) (string, error) {
 	return addRoomFunc(name)
 }
 
@@ -56,13 +58,27 @@ func TestGetRooms(t *testing.T) {
 			},
 			CodeWant: http.StatusInternalServerError,
 		},
+		{
+			Name: "GetRooms Failed deadline exceeded",
+			mockFunc: func() ([]mongodb.Room, error) {
+				return nil, context.DeadlineExceeded
+			},
+			CodeWant: http.StatusGatewayTimeout,
+		},
+		{
+			Name: "GetRooms Failed database unavailable",
+			mockFunc: func() ([]mongodb.Room, error) {
+				return nil, mongodb.ErrUnavailable
+			},
+			CodeWant: http.StatusServiceUnavailable,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getRoomsFunc = tc.mockFunc
 
 			// messageHandler := NewMessageHandler(&mockService{})
-			roomHandler := NewRoomHandler()
+			roomHandler := NewRoomHandler(memdb.New())
 			roomHandler.roomService = &mockService{}
 			rr := httptest.NewRecorder()
 			// c, _ := gin.CreateTestContext(rc)
@@ -103,13 +119,20 @@ func TestGetAnyRoom(t *testing.T) {
 			},
 			CodeWant: http.StatusInternalServerError,
 		},
+		{
+			Name: "GetAnyRoom Failed no room",
+			mockFunc: func() (*mongodb.Room, error) {
+				return nil, mongodb.ErrRoomNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getAnyRoomFunc = tc.mockFunc
 
 			// messageHandler := NewMessageHandler(&mockService{})
-			roomHandler := NewRoomHandler()
+			roomHandler := NewRoomHandler(memdb.New())
 			roomHandler.roomService = &mockService{}
 			rr := httptest.NewRecorder()
 			// c, _ := gin.CreateTestContext(rc)
@@ -171,7 +194,7 @@ func TestAddRoom(t *testing.T) {
 			addRoomFunc = tc.mockFunc
 
 			// messageHandler := NewMessageHandler(&mockService{})
-			roomHandler := NewRoomHandler()
+			roomHandler := NewRoomHandler(memdb.New())
 			roomHandler.roomService = &mockService{}
 			rr := httptest.NewRecorder()
 			// c, _ := gin.CreateTestContext(rc)
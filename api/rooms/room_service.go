@@ -1,34 +1,34 @@
 package rooms
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
 )
 
 type IRoomService interface {
-	GetRooms() ([]mongodb.Room, error)
-	GetAnyRoom() (*mongodb.Room, error)
-	AddRoom(name string) (string, error)
+	GetRooms(ctx context.Context) ([]mongodb.Room, error)
+	GetAnyRoom(ctx context.Context) (*mongodb.Room, error)
+	AddRoom(ctx context.Context, name string) (string, error)
 }
 type roomService struct {
-	repo mongodb.IMongoDB
+	repo mongodb.RoomRepository
 }
 
 // NewRoomService will initialize roomService object
-func NewRoomService() *roomService {
-	r := mongodb.NewMongoDB()
-	return &roomService{repo: r}
+func NewRoomService(repo mongodb.RoomRepository) *roomService {
+	return &roomService{repo: repo}
 }
 
 // GetRooms will get all rooms available
-func (s *roomService) GetRooms() ([]mongodb.Room, error) {
-	return s.repo.GetRooms()
+func (s *roomService) GetRooms(ctx context.Context) ([]mongodb.Room, error) {
+	return s.repo.GetRooms(ctx)
 }
 
 // GetAnyRoom will return one room with no specific condition
-func (s *roomService) GetAnyRoom() (*mongodb.Room, error) {
-	anyRoomPtr, err := s.repo.GetAnyRoom()
+func (s *roomService) GetAnyRoom(ctx context.Context) (*mongodb.Room, error) {
+	anyRoomPtr, err := s.repo.GetAnyRoom(ctx)
 	if err != nil {
 		return anyRoomPtr, err
 	}
@@ -50,6 +50,6 @@ func (s *roomService) GetAnyRoom() (*mongodb.Room, error) {
 }
 
 // AddRoom will add room to the database
-func (s *roomService) AddRoom(name string) (string, error) {
-	return s.repo.AddRoom(name)
+func (s *roomService) AddRoom(ctx context.Context, name string) (string, error) {
+	return s.repo.AddRoom(ctx, name)
 }
@@ -1,6 +1,7 @@
 package rooms
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -15,16 +16,16 @@ var (
 )
 
 type mockRoomRepo struct {
-	mongodb.IMongoDB
+	mongodb.RoomRepository
 }
 
-func (m *mockRoomRepo) GetRooms() ([]mongodb.Room, error) {
+func (m *mockRoomRepo) GetRooms(ctx context.Context) ([]mongodb.Room, error) {
 	return getRoomsRepoFunc()
 }
-func (m *mockRoomRepo) GetAnyRoom() (*mongodb.Room, error) {
+func (m *mockRoomRepo) GetAnyRoom(ctx context.Context) (*mongodb.Room, error) {
 	return getAnyRoomRepoFunc()
 }
-func (m *mockRoomRepo) AddRoom(name string) (string, error) {
+func (m *mockRoomRepo) AddRoom(ctx context.Context, name string) (string, error) {
 	return addRoomRepoFunc(name)
 }
 func TestGetRoomsService(t *testing.T) {
@@ -52,10 +53,9 @@ func TestGetRoomsService(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getRoomsRepoFunc = tc.mockFunc
-			roomService := NewRoomService()
-			roomService.repo = &mockRoomRepo{}
+			roomService := NewRoomService(&mockRoomRepo{})
 
-			rooms, err := roomService.GetRooms()
+			rooms, err := roomService.GetRooms(context.Background())
 
 			if tc.IsSuccess {
 				assert.NotNil(t, rooms)
@@ -94,10 +94,9 @@ func TestGetAnyRoomService(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getAnyRoomRepoFunc = tc.mockAnyRoomFunc
-			roomService := NewRoomService()
-			roomService.repo = &mockRoomRepo{}
+			roomService := NewRoomService(&mockRoomRepo{})
 
-			rooms, err := roomService.GetAnyRoom()
+			rooms, err := roomService.GetAnyRoom(context.Background())
 
 			if tc.IsSuccess {
 				assert.NotNil(t, rooms)
@@ -138,10 +137,9 @@ func TestAddRoomService(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			addRoomRepoFunc = tc.mockAddRoomFunc
-			roomService := NewRoomService()
-			roomService.repo = &mockRoomRepo{}
+			roomService := NewRoomService(&mockRoomRepo{})
 
-			room, err := roomService.AddRoom(tc.RoomName)
+			room, err := roomService.AddRoom(context.Background(), tc.RoomName)
 
 			if tc.IsSuccess {
 				assert.NotNil(t, room)
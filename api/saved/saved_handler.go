@@ -0,0 +1,121 @@
+package saved
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+type ISavedHandler interface {
+	Save(w http.ResponseWriter, r *http.Request)
+	Unsave(w http.ResponseWriter, r *http.Request)
+	GetSaved(w http.ResponseWriter, r *http.Request)
+}
+type savedHandler struct {
+	savedService ISavedService
+}
+
+// NewSavedHandler will initialize savedHandler object
+func NewSavedHandler(savedRepo mongodb.SavedItemRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, roomRepo mongodb.RoomRepository) *savedHandler {
+	savedService := NewSavedService(savedRepo, messageRepo, userRepo, roomRepo)
+	return &savedHandler{savedService: savedService}
+}
+
+// Save will save message {messageId} for the user, "me" is the user_id query parameter
+func (h *savedHandler) Save(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+	userId := r.URL.Query().Get("user_id")
+
+	saved, err := h.savedService.Save(r.Context(), userId, messageId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusCreated, "success", "save message successfull", saved)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Unsave will forget message {messageId} saved by the user_id query parameter
+func (h *savedHandler) Unsave(w http.ResponseWriter, r *http.Request) {
+	messageId := chi.URLParam(r, "messageId")
+	userId := r.URL.Query().Get("user_id")
+
+	if err := h.savedService.Unsave(r.Context(), userId, messageId); err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "unsave message successfull", nil)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSaved will return a page of the messages saved by the user_id query parameter.
+// limit is the page size, before is the next cursor of the previous page
+func (h *savedHandler) GetSaved(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	userId := query.Get("user_id")
+	if userId == "" {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, errors.New("user_id is required"))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			response := common.ResponseErrorFormatter(http.StatusBadRequest, errors.New("limit must be a positive number"))
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+
+	page, err := h.savedService.GetSaved(r.Context(), userId, query.Get("before"), limit)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "get saved messages successfull", page)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errorCode will map an error of ISavedService to a http status code
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidCursor):
+		return http.StatusBadRequest
+	case errors.Is(err, mongodb.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, mongodb.ErrSavedItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, mongodb.ErrSavedItemExists):
+		return http.StatusConflict
+	default:
+		return common.ErrorCode(err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,209 @@
+package saved
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	saveFunc     func(userId string, messageId string) (*SavedMessage, error)
+	unsaveFunc   func(userId string, messageId string) error
+	getSavedFunc func(userId string, before string, limit int) (*SavedPage, error)
+)
+
+type mockService struct{}
+
+func (m *mockService) Save(ctx context.Context, userId string, messageId string) (*SavedMessage, error) {
+	return saveFunc(userId, messageId)
+}
+func (m *mockService) Unsave(ctx context.Context, userId string, messageId string) error {
+	return unsaveFunc(userId, messageId)
+}
+func (m *mockService) GetSaved(ctx context.Context, userId string, before string, limit int) (*SavedPage, error) {
+	return getSavedFunc(userId, before, limit)
+}
+
+// newSavedRequest will build a request with the chi url parameters set, as the router would
+func newSavedRequest(method string, url string) *http.Request {
+	req, _ := http.NewRequest(method, url, nil)
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("messageId", testMessageID)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+}
+
+func TestSave(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(userId string, messageId string) (*SavedMessage, error)
+		CodeWant int
+	}{
+		{
+			Name: "Save Success",
+			mockFunc: func(userId string, messageId string) (*SavedMessage, error) {
+				return &SavedMessage{ID: "s1"}, nil
+			},
+			CodeWant: http.StatusCreated,
+		},
+		{
+			Name: "Save Failed can not see message",
+			mockFunc: func(userId string, messageId string) (*SavedMessage, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+		{
+			Name: "Save Failed already saved",
+			mockFunc: func(userId string, messageId string) (*SavedMessage, error) {
+				return nil, mongodb.ErrSavedItemExists
+			},
+			CodeWant: http.StatusConflict,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			saveFunc = func(userId string, messageId string) (*SavedMessage, error) {
+				assert.Equal(t, testUserID, userId)
+				assert.Equal(t, testMessageID, messageId)
+				return tc.mockFunc(userId, messageId)
+			}
+
+			savedHandler := &savedHandler{savedService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			savedHandler.Save(rr, newSavedRequest(http.MethodPost, "/me/saved/"+testMessageID+"?user_id="+testUserID))
+
+			// check header StatusCode
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			// check response (JSON format) StatusCode
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestUnsave(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(userId string, messageId string) error
+		CodeWant int
+	}{
+		{
+			Name: "Unsave Success",
+			mockFunc: func(userId string, messageId string) error {
+				return nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name: "Unsave Failed not saved",
+			mockFunc: func(userId string, messageId string) error {
+				return mongodb.ErrSavedItemNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			unsaveFunc = tc.mockFunc
+
+			savedHandler := &savedHandler{savedService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			savedHandler.Unsave(rr, newSavedRequest(http.MethodDelete, "/me/saved/"+testMessageID+"?user_id="+testUserID))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestGetSaved(t *testing.T) {
+
+	tt := []struct {
+		Name       string
+		mockFunc   func(userId string, before string, limit int) (*SavedPage, error)
+		Query      string
+		CodeWant   int
+		LimitWant  int
+		BeforeWant string
+	}{
+		{
+			Name: "GetSaved Success",
+			mockFunc: func(userId string, before string, limit int) (*SavedPage, error) {
+				return &SavedPage{Items: []SavedMessage{}}, nil
+			},
+			Query:      "?user_id=" + testUserID + "&limit=10&before=61f61d94fc663b6f4c8f3192",
+			CodeWant:   http.StatusOK,
+			LimitWant:  10,
+			BeforeWant: "61f61d94fc663b6f4c8f3192",
+		},
+		{
+			Name: "GetSaved Failed missing user",
+			mockFunc: func(userId string, before string, limit int) (*SavedPage, error) {
+				return &SavedPage{}, nil
+			},
+			Query:    "",
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "GetSaved Failed invalid limit",
+			mockFunc: func(userId string, before string, limit int) (*SavedPage, error) {
+				return &SavedPage{}, nil
+			},
+			Query:    "?user_id=" + testUserID + "&limit=abc",
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "GetSaved Failed",
+			mockFunc: func(userId string, before string, limit int) (*SavedPage, error) {
+				return nil, errors.New("get saved failed")
+			},
+			Query:    "?user_id=" + testUserID,
+			CodeWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var gotLimit int
+			var gotBefore string
+			getSavedFunc = func(userId string, before string, limit int) (*SavedPage, error) {
+				gotLimit, gotBefore = limit, before
+				return tc.mockFunc(userId, before, limit)
+			}
+
+			savedHandler := &savedHandler{savedService: &mockService{}}
+			rr := httptest.NewRecorder()
+
+			savedHandler.GetSaved(rr, newSavedRequest(http.MethodGet, "/me/saved"+tc.Query))
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+			if tc.CodeWant == http.StatusOK {
+				assert.Equal(t, tc.LimitWant, gotLimit)
+				assert.Equal(t, tc.BeforeWant, gotBefore)
+			}
+		})
+	}
+}
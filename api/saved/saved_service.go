@@ -0,0 +1,202 @@
+package saved
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrInvalidCursor   = errors.New("invalid before cursor")
+)
+
+// page sizes of GetSaved
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// SavedMessage is a saved item with its message and room
+type SavedMessage struct {
+	ID      string          `json:"id"`
+	SavedAt time.Time       `json:"saved_at"`
+	Message mongodb.Message `json:"message"`
+	Room    mongodb.Room    `json:"room"`
+}
+
+// SavedPage is one page of saved items, Next is the before cursor of the next page, empty on the last page
+type SavedPage struct {
+	Items []SavedMessage `json:"items"`
+	Next  string         `json:"next"`
+}
+
+type ISavedService interface {
+	Save(ctx context.Context, userId string, messageId string) (*SavedMessage, error)
+	Unsave(ctx context.Context, userId string, messageId string) error
+	GetSaved(ctx context.Context, userId string, before string, limit int) (*SavedPage, error)
+}
+type savedService struct {
+	savedRepo   mongodb.SavedItemRepository
+	messageRepo mongodb.MessageRepository
+	userRepo    mongodb.UserRepository
+	roomRepo    mongodb.RoomRepository
+	now         func() time.Time
+}
+
+// NewSavedService will initialize savedService object
+func NewSavedService(savedRepo mongodb.SavedItemRepository, messageRepo mongodb.MessageRepository, userRepo mongodb.UserRepository, roomRepo mongodb.RoomRepository) *savedService {
+	return &savedService{
+		savedRepo:   savedRepo,
+		messageRepo: messageRepo,
+		userRepo:    userRepo,
+		roomRepo:    roomRepo,
+		now:         time.Now,
+	}
+}
+
+// Save will save the message for the user, who must be a member of the message's room
+func (s *savedService) Save(ctx context.Context, userId string, messageId string) (*SavedMessage, error) {
+	objID, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, ErrMessageNotFound
+	}
+	messages, err := s.messageRepo.GetMessages(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	message := messages[0]
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, message.RoomID); err != nil {
+		return nil, err
+	}
+
+	item := mongodb.SavedItem{UserID: userId, MessageID: messageId, RoomID: message.RoomID, SavedAt: s.now()}
+	id, err := s.savedRepo.AddSavedItem(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return &SavedMessage{ID: id, SavedAt: item.SavedAt, Message: message, Room: s.room(ctx, message.RoomID)}, nil
+}
+
+// Unsave will forget the message saved by the user
+func (s *savedService) Unsave(ctx context.Context, userId string, messageId string) error {
+	return s.savedRepo.RemoveSavedItem(ctx, userId, messageId)
+}
+
+// GetSaved will get a page of the items saved by the user, the newest first.
+// only the items of rooms the user is still a member of are returned, the others are kept for when the user joins back.
+// messages are never deleted by the application, the items of messages deleted in the database are removed on the way.
+// a page can therefore hold fewer than limit items, even none, while Next is set: the last page is the one without Next
+func (s *savedService) GetSaved(ctx context.Context, userId string, before string, limit int) (*SavedPage, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if before != "" && !primitive.IsValidObjectID(before) {
+		return nil, ErrInvalidCursor
+	}
+
+	// one more than asked tells whether there is a next page
+	items, err := s.savedRepo.GetSavedItems(ctx, userId, before, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &SavedPage{Items: []SavedMessage{}}
+	if len(items) > limit {
+		items = items[:limit]
+		page.Next = items[limit-1].ID
+	}
+	if len(items) == 0 {
+		return page, nil
+	}
+	memberOf, err := s.memberRooms(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []primitive.ObjectID
+	for _, item := range items {
+		if objID, err := primitive.ObjectIDFromHex(item.MessageID); err == nil {
+			ids = append(ids, objID)
+		}
+	}
+	messages, err := s.messageRepo.GetMessages(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]mongodb.Message)
+	for _, message := range messages {
+		byId[message.ID] = message
+	}
+
+	rooms := make(map[string]mongodb.Room)
+	var deleted []string
+	for _, item := range items {
+		message, ok := byId[item.MessageID]
+		if !ok {
+			deleted = append(deleted, item.MessageID)
+			continue
+		}
+		if !memberOf[message.RoomID] {
+			continue
+		}
+		room, ok := rooms[message.RoomID]
+		if !ok {
+			room = s.room(ctx, message.RoomID)
+			rooms[message.RoomID] = room
+		}
+		page.Items = append(page.Items, SavedMessage{ID: item.ID, SavedAt: item.SavedAt, Message: message, Room: room})
+	}
+
+	if len(deleted) > 0 {
+		log.Println("GetSaved - removing saved items of deleted messages: ", deleted)
+		if err := s.savedRepo.RemoveSavedItemsOfMessages(ctx, deleted); err != nil {
+			log.Println("GetSaved - failed to remove saved items: ", err)
+		}
+	}
+	return page, nil
+}
+
+// memberRooms will get the set of rooms the user is a member of, none for an unknown user
+func (s *savedService) memberRooms(ctx context.Context, userId string) (map[string]bool, error) {
+	rooms := make(map[string]bool)
+	objID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return rooms, nil
+	}
+	user, err := s.userRepo.GetUser(ctx, bson.M{"_id": objID})
+	if errors.Is(err, mongodb.ErrNotFound) {
+		return rooms, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range user.Rooms {
+		rooms[room] = true
+	}
+	return rooms, nil
+}
+
+// room will get the room by id, a room which is gone is returned with its id only
+func (s *savedService) room(ctx context.Context, roomId string) mongodb.Room {
+	objID, err := primitive.ObjectIDFromHex(roomId)
+	if err != nil {
+		return mongodb.Room{ID: roomId}
+	}
+	room, err := s.roomRepo.GetRoom(ctx, bson.M{"_id": objID})
+	if err != nil {
+		log.Println("savedService - room not found: ", roomId, " error: ", err)
+		return mongodb.Room{ID: roomId}
+	}
+	return *room
+}
@@ -0,0 +1,254 @@
+package saved
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUserID    = "61cfa908eca4dd2b9d11d9ee"
+	testRoomID    = "61cc50877ea033031b1a950e"
+	testMessageID = "61f61d94fc663b6f4c8f3190"
+)
+
+var (
+	getUserRepoFunc                    func(filter interface{}) (*mongodb.User, error)
+	getRoomRepoFunc                    func(filter interface{}) (*mongodb.Room, error)
+	getMessagesRepoFunc                func(filter interface{}) ([]mongodb.Message, error)
+	addSavedItemRepoFunc               func(item mongodb.SavedItem) (string, error)
+	getSavedItemsRepoFunc              func(userId string, before string, limit int) ([]mongodb.SavedItem, error)
+	removeSavedItemsOfMessagesRepoFunc func(messageIds []string) error
+)
+
+type mockSavedRepo struct {
+	mongodb.SavedItemRepository
+	mongodb.MessageRepository
+	mongodb.UserRepository
+	mongodb.RoomRepository
+}
+
+func (m *mockSavedRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockSavedRepo) GetRoom(ctx context.Context, filter interface{}) (*mongodb.Room, error) {
+	return getRoomRepoFunc(filter)
+}
+func (m *mockSavedRepo) GetMessages(ctx context.Context, filter interface{}) ([]mongodb.Message, error) {
+	return getMessagesRepoFunc(filter)
+}
+func (m *mockSavedRepo) AddSavedItem(ctx context.Context, item mongodb.SavedItem) (string, error) {
+	return addSavedItemRepoFunc(item)
+}
+func (m *mockSavedRepo) GetSavedItems(ctx context.Context, userId string, before string, limit int) ([]mongodb.SavedItem, error) {
+	return getSavedItemsRepoFunc(userId, before, limit)
+}
+func (m *mockSavedRepo) RemoveSavedItemsOfMessages(ctx context.Context, messageIds []string) error {
+	return removeSavedItemsOfMessagesRepoFunc(messageIds)
+}
+
+func newTestSavedService() *savedService {
+	repo := &mockSavedRepo{}
+	return &savedService{savedRepo: repo, messageRepo: repo, userRepo: repo, roomRepo: repo, now: time.Now}
+}
+
+func memberOf(rooms ...string) func(filter interface{}) (*mongodb.User, error) {
+	return func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: testUserID, Rooms: rooms}, nil
+	}
+}
+
+func TestSaveService(t *testing.T) {
+	tt := []struct {
+		Name            string
+		getUserMockFunc func(filter interface{}) (*mongodb.User, error)
+		Messages        []mongodb.Message
+		addSavedErr     error
+		ErrWant         error
+	}{
+		{
+			Name:            "Save Success",
+			getUserMockFunc: memberOf(testRoomID),
+			Messages:        []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}},
+		},
+		{
+			Name:            "Save Failed message not found",
+			getUserMockFunc: memberOf(testRoomID),
+			ErrWant:         ErrMessageNotFound,
+		},
+		{
+			Name:            "Save Failed message of another room",
+			getUserMockFunc: memberOf("otherroom"),
+			Messages:        []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}},
+			ErrWant:         mongodb.ErrNotMember,
+		},
+		{
+			Name:            "Save Failed already saved",
+			getUserMockFunc: memberOf(testRoomID),
+			Messages:        []mongodb.Message{{ID: testMessageID, RoomID: testRoomID}},
+			addSavedErr:     mongodb.ErrSavedItemExists,
+			ErrWant:         mongodb.ErrSavedItemExists,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = tc.getUserMockFunc
+			getMessagesRepoFunc = func(filter interface{}) ([]mongodb.Message, error) {
+				return tc.Messages, nil
+			}
+			getRoomRepoFunc = func(filter interface{}) (*mongodb.Room, error) {
+				return &mongodb.Room{ID: testRoomID, Name: "room1"}, nil
+			}
+			addSavedItemRepoFunc = func(item mongodb.SavedItem) (string, error) {
+				assert.Equal(t, testUserID, item.UserID)
+				assert.Equal(t, testRoomID, item.RoomID)
+				return "s1", tc.addSavedErr
+			}
+
+			saved, err := newTestSavedService().Save(context.Background(), testUserID, testMessageID)
+
+			if tc.ErrWant != nil {
+				assert.Equal(t, tc.ErrWant, err)
+				assert.Nil(t, saved)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "s1", saved.ID)
+			assert.Equal(t, testMessageID, saved.Message.ID)
+			assert.Equal(t, "room1", saved.Room.Name)
+		})
+	}
+}
+
+func TestGetSavedService(t *testing.T) {
+	items := []mongodb.SavedItem{
+		{ID: "s3", MessageID: "61f61d94fc663b6f4c8f3193"},
+		{ID: "s2", MessageID: "61f61d94fc663b6f4c8f3192"},
+		{ID: "s1", MessageID: "61f61d94fc663b6f4c8f3191"},
+	}
+	messages := []mongodb.Message{
+		{ID: "61f61d94fc663b6f4c8f3193", RoomID: testRoomID},
+		{ID: "61f61d94fc663b6f4c8f3191", RoomID: testRoomID},
+		{ID: "61f61d94fc663b6f4c8f3194", RoomID: "leftroom"},
+	}
+
+	tt := []struct {
+		Name        string
+		Before      string
+		Limit       int
+		LimitWant   int
+		Items       []mongodb.SavedItem
+		UserMock    func(filter interface{}) (*mongodb.User, error)
+		IdsWant     []string
+		NextWant    string
+		DeletedWant []string
+		ErrWant     error
+	}{
+		{
+			Name:        "GetSaved first page, deleted message removed",
+			Limit:       2,
+			LimitWant:   3,
+			Items:       items,
+			IdsWant:     []string{"s3"},
+			NextWant:    "s2",
+			DeletedWant: []string{"61f61d94fc663b6f4c8f3192"},
+		},
+		{
+			Name:      "GetSaved item of a left room skipped, not removed",
+			LimitWant: DefaultLimit + 1,
+			Items:     []mongodb.SavedItem{{ID: "s4", MessageID: "61f61d94fc663b6f4c8f3194"}, items[0]},
+			IdsWant:   []string{"s3"},
+		},
+		{
+			Name:      "GetSaved user without rooms gets no items",
+			LimitWant: DefaultLimit + 1,
+			Items:     []mongodb.SavedItem{items[0], items[2]},
+			UserMock:  memberOf(),
+			IdsWant:   []string{},
+		},
+		{
+			Name:      "GetSaved unknown user gets no items",
+			LimitWant: DefaultLimit + 1,
+			Items:     []mongodb.SavedItem{items[0], items[2]},
+			UserMock: func(filter interface{}) (*mongodb.User, error) {
+				return nil, mongodb.ErrNotFound
+			},
+			IdsWant: []string{},
+		},
+		{
+			Name:        "GetSaved short page of deleted messages keeps next",
+			Limit:       1,
+			LimitWant:   2,
+			Items:       items[1:],
+			IdsWant:     []string{},
+			NextWant:    "s2",
+			DeletedWant: []string{"61f61d94fc663b6f4c8f3192"},
+		},
+		{
+			Name:      "GetSaved last page",
+			Before:    "61f61d94fc663b6f4c8f3192",
+			LimitWant: DefaultLimit + 1,
+			Items:     items[2:],
+			IdsWant:   []string{"s1"},
+		},
+		{
+			Name:      "GetSaved limit is capped",
+			Limit:     1000,
+			LimitWant: MaxLimit + 1,
+			IdsWant:   []string{},
+		},
+		{
+			Name:    "GetSaved Failed invalid cursor",
+			Before:  "abc",
+			ErrWant: ErrInvalidCursor,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var gotLimit int
+			var deleted []string
+			getUserRepoFunc = memberOf(testRoomID)
+			if tc.UserMock != nil {
+				getUserRepoFunc = tc.UserMock
+			}
+			getSavedItemsRepoFunc = func(userId string, before string, limit int) ([]mongodb.SavedItem, error) {
+				gotLimit = limit
+				assert.Equal(t, tc.Before, before)
+				return tc.Items, nil
+			}
+			getMessagesRepoFunc = func(filter interface{}) ([]mongodb.Message, error) {
+				return messages, nil
+			}
+			getRoomRepoFunc = func(filter interface{}) (*mongodb.Room, error) {
+				return nil, errors.New("room not found")
+			}
+			removeSavedItemsOfMessagesRepoFunc = func(messageIds []string) error {
+				deleted = messageIds
+				return nil
+			}
+
+			page, err := newTestSavedService().GetSaved(context.Background(), testUserID, tc.Before, tc.Limit)
+
+			if tc.ErrWant != nil {
+				assert.Equal(t, tc.ErrWant, err)
+				assert.Nil(t, page)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.LimitWant, gotLimit)
+			ids := []string{}
+			for _, item := range page.Items {
+				ids = append(ids, item.ID)
+				// a room which is gone keeps its id
+				assert.Equal(t, testRoomID, item.Room.ID)
+			}
+			assert.Equal(t, tc.IdsWant, ids)
+			assert.Equal(t, tc.NextWant, page.Next)
+			assert.Equal(t, tc.DeletedWant, deleted)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package scheduled
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+)
+
+type IScheduledHandler interface {
+	Schedule(w http.ResponseWriter, r *http.Request)
+	GetScheduled(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
+}
+type scheduledHandler struct {
+	scheduledService IScheduledService
+}
+
+// NewScheduledHandler will initialize scheduledHandler object
+func NewScheduledHandler(scheduledRepo mongodb.ScheduledMessageRepository, userRepo mongodb.UserRepository, policy *msgpolicy.Policy, schedulerConfig config.Scheduler) *scheduledHandler {
+	scheduledService := NewScheduledService(scheduledRepo, userRepo, policy, schedulerConfig)
+	return &scheduledHandler{scheduledService: scheduledService}
+}
+
+// Schedule will store a message to post later, the body is NewScheduled with post_at in RFC 3339
+func (h *scheduledHandler) Schedule(w http.ResponseWriter, r *http.Request) {
+	var newScheduled NewScheduled
+	if err := json.NewDecoder(r.Body).Decode(&newScheduled); err != nil {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	scheduled, err := h.scheduledService.Schedule(r.Context(), newScheduled)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusCreated, "success", "schedule message successfull", scheduled)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetScheduled will return the messages scheduled by the user_id query parameter which are not posted yet
+func (h *scheduledHandler) GetScheduled(w http.ResponseWriter, r *http.Request) {
+	userId := r.URL.Query().Get("user_id")
+	if userId == "" {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, errors.New("user_id is required"))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	scheduled, err := h.scheduledService.GetScheduled(r.Context(), userId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "get scheduled messages successfull", scheduled)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Cancel will delete scheduled message {id} of the user_id query parameter
+func (h *scheduledHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userId := r.URL.Query().Get("user_id")
+
+	if err := h.scheduledService.Cancel(r.Context(), id, userId); err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusOK, "success", "cancel scheduled message successfull", nil)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// errorCode will map an error of IScheduledService to a http status code
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidMessage), errors.Is(err, ErrInvalidTime):
+		return http.StatusBadRequest
+	case errors.Is(err, mongodb.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, mongodb.ErrScheduledMessageNotFound):
+		return http.StatusNotFound
+	default:
+		return common.ErrorCode(err, http.StatusInternalServerError)
+	}
+}
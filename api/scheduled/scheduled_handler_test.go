@@ -0,0 +1,193 @@
+package scheduled
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	scheduleFunc     func(newScheduled NewScheduled) (*mongodb.ScheduledMessage, error)
+	getScheduledFunc func(userId string) ([]mongodb.ScheduledMessage, error)
+	cancelFunc       func(id string, userId string) error
+)
+
+type mockService struct{}
+
+func (m *mockService) Schedule(ctx context.Context, newScheduled NewScheduled) (*mongodb.ScheduledMessage, error) {
+	return scheduleFunc(newScheduled)
+}
+func (m *mockService) GetScheduled(ctx context.Context, userId string) ([]mongodb.ScheduledMessage, error) {
+	return getScheduledFunc(userId)
+}
+func (m *mockService) Cancel(ctx context.Context, id string, userId string) error {
+	return cancelFunc(id, userId)
+}
+
+func TestSchedule(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		Body     string
+		mockFunc func(newScheduled NewScheduled) (*mongodb.ScheduledMessage, error)
+		CodeWant int
+	}{
+		{
+			Name: "Schedule Success",
+			Body: fmt.Sprintf(`{"room_id":"%v","user_id":"%v","message":"hello","post_at":"2022-02-01T09:00:00Z"}`, testRoomID, testUserID),
+			mockFunc: func(newScheduled NewScheduled) (*mongodb.ScheduledMessage, error) {
+				return &mongodb.ScheduledMessage{ID: "s1", PostAt: newScheduled.PostAt}, nil
+			},
+			CodeWant: http.StatusCreated,
+		},
+		{
+			Name:     "Schedule Failed invalid body",
+			Body:     `{"post_at":"tomorrow"}`,
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "Schedule Failed in the past",
+			Body: `{"post_at":"2022-02-01T07:00:00Z"}`,
+			mockFunc: func(newScheduled NewScheduled) (*mongodb.ScheduledMessage, error) {
+				return nil, fmt.Errorf("%w: must be in the future", ErrInvalidTime)
+			},
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "Schedule Failed not a member",
+			Body: `{"post_at":"2022-02-01T09:00:00Z"}`,
+			mockFunc: func(newScheduled NewScheduled) (*mongodb.ScheduledMessage, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			scheduleFunc = tc.mockFunc
+
+			scheduledHandler := &scheduledHandler{scheduledService: &mockService{}}
+			req, _ := http.NewRequest(http.MethodPost, "/scheduled", strings.NewReader(tc.Body))
+			rr := httptest.NewRecorder()
+
+			scheduledHandler.Schedule(rr, req)
+
+			// check header StatusCode
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			// check response (JSON format) StatusCode
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestGetScheduled(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		Query    string
+		mockFunc func(userId string) ([]mongodb.ScheduledMessage, error)
+		CodeWant int
+	}{
+		{
+			Name:  "GetScheduled Success",
+			Query: "?user_id=" + testUserID,
+			mockFunc: func(userId string) ([]mongodb.ScheduledMessage, error) {
+				return []mongodb.ScheduledMessage{{ID: "s1", UserID: userId}}, nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name:     "GetScheduled Failed missing user",
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name:  "GetScheduled Failed",
+			Query: "?user_id=" + testUserID,
+			mockFunc: func(userId string) ([]mongodb.ScheduledMessage, error) {
+				return nil, errors.New("find failed")
+			},
+			CodeWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getScheduledFunc = tc.mockFunc
+
+			scheduledHandler := &scheduledHandler{scheduledService: &mockService{}}
+			req, _ := http.NewRequest(http.MethodGet, "/scheduled"+tc.Query, nil)
+			rr := httptest.NewRecorder()
+
+			scheduledHandler.GetScheduled(rr, req)
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(id string, userId string) error
+		CodeWant int
+	}{
+		{
+			Name: "Cancel Success",
+			mockFunc: func(id string, userId string) error {
+				return nil
+			},
+			CodeWant: http.StatusOK,
+		},
+		{
+			Name: "Cancel Failed not found or already posted",
+			mockFunc: func(id string, userId string) error {
+				return mongodb.ErrScheduledMessageNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			cancelFunc = func(id string, userId string) error {
+				assert.Equal(t, "s1", id)
+				assert.Equal(t, testUserID, userId)
+				return tc.mockFunc(id, userId)
+			}
+
+			scheduledHandler := &scheduledHandler{scheduledService: &mockService{}}
+			req, _ := http.NewRequest(http.MethodDelete, "/scheduled/s1?user_id="+testUserID, nil)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", "s1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+			rr := httptest.NewRecorder()
+
+			scheduledHandler.Cancel(rr, req)
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
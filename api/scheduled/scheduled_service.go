@@ -0,0 +1,103 @@
+package scheduled
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/clock"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+)
+
+var (
+	ErrInvalidMessage = errors.New("invalid message")
+	ErrInvalidTime    = errors.New("invalid post_at")
+)
+
+// NewScheduled is the body of POST /scheduled
+type NewScheduled struct {
+	RoomID      string    `json:"room_id"`
+	UserID      string    `json:"user_id"`
+	Message     string    `json:"message"`
+	Attachments []string  `json:"attachments,omitempty"`
+	PostAt      time.Time `json:"post_at"`
+}
+
+type IScheduledService interface {
+	Schedule(ctx context.Context, newScheduled NewScheduled) (*mongodb.ScheduledMessage, error)
+	GetScheduled(ctx context.Context, userId string) ([]mongodb.ScheduledMessage, error)
+	Cancel(ctx context.Context, id string, userId string) error
+}
+type scheduledService struct {
+	scheduledRepo mongodb.ScheduledMessageRepository
+	userRepo      mongodb.UserRepository
+	policy        *msgpolicy.Policy
+	clock         clock.Clock
+	config        config.Scheduler
+}
+
+// NewScheduledService will initialize scheduledService object, messages are checked against policy when they are scheduled
+func NewScheduledService(scheduledRepo mongodb.ScheduledMessageRepository, userRepo mongodb.UserRepository, policy *msgpolicy.Policy, schedulerConfig config.Scheduler) *scheduledService {
+	return &scheduledService{
+		scheduledRepo: scheduledRepo,
+		userRepo:      userRepo,
+		policy:        policy,
+		clock:         clock.System{},
+		config:        schedulerConfig,
+	}
+}
+
+// Schedule will store the message to be posted to the room at PostAt by the scheduler.
+// the text is checked against the message policy now, so the user learns about a rejected message right away
+func (s *scheduledService) Schedule(ctx context.Context, newScheduled NewScheduled) (*mongodb.ScheduledMessage, error) {
+	now := s.clock.Now()
+	if !newScheduled.PostAt.After(now) {
+		return nil, fmt.Errorf("%w: must be in the future", ErrInvalidTime)
+	}
+	if newScheduled.PostAt.After(now.Add(s.config.MaxAhead)) {
+		return nil, fmt.Errorf("%w: must be within %v", ErrInvalidTime, s.config.MaxAhead)
+	}
+	text, err := s.policy.Apply(newScheduled.Message)
+	if err == msgpolicy.ErrEmptyMessage && len(newScheduled.Attachments) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	user, err := mongodb.RoomMember(ctx, s.userRepo, newScheduled.UserID, newScheduled.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduled := mongodb.ScheduledMessage{
+		UserID:      user.ID,
+		Username:    user.Username,
+		UserImage:   user.UserImage,
+		RoomID:      newScheduled.RoomID,
+		Message:     text,
+		Attachments: newScheduled.Attachments,
+		PostAt:      newScheduled.PostAt,
+		CreatedAt:   now,
+		Status:      mongodb.ScheduledPending,
+	}
+	id, err := s.scheduledRepo.AddScheduledMessage(ctx, scheduled)
+	if err != nil {
+		return nil, err
+	}
+	scheduled.ID = id
+	return &scheduled, nil
+}
+
+// GetScheduled will get the messages the user scheduled which are not posted yet, failed ones included
+func (s *scheduledService) GetScheduled(ctx context.Context, userId string) ([]mongodb.ScheduledMessage, error) {
+	return s.scheduledRepo.GetScheduledMessages(ctx, userId)
+}
+
+// Cancel will delete a scheduled message of the user before it is posted
+func (s *scheduledService) Cancel(ctx context.Context, id string, userId string) error {
+	return s.scheduledRepo.DeleteScheduledMessage(ctx, id, userId)
+}
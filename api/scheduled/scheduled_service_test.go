@@ -0,0 +1,158 @@
+package scheduled
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUserID = "61cfa908eca4dd2b9d11d9ee"
+	testRoomID = "61cc50877ea033031b1a950e"
+)
+
+var (
+	getUserRepoFunc             func(filter interface{}) (*mongodb.User, error)
+	addScheduledMessageRepoFunc func(scheduled mongodb.ScheduledMessage) (string, error)
+)
+
+type mockScheduledRepo struct {
+	mongodb.ScheduledMessageRepository
+	mongodb.UserRepository
+}
+
+func (m *mockScheduledRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockScheduledRepo) AddScheduledMessage(ctx context.Context, scheduled mongodb.ScheduledMessage) (string, error) {
+	return addScheduledMessageRepoFunc(scheduled)
+}
+
+// fixedClock always tells the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+func (c fixedClock) After(d time.Duration) <-chan time.Time {
+	return make(chan time.Time)
+}
+
+var testNow = time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+func newTestScheduledService(t *testing.T) *scheduledService {
+	policy, err := msgpolicy.New(config.MessagePolicy{MaxLength: 10, Trim: true, Normalization: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &mockScheduledRepo{}
+	return &scheduledService{
+		scheduledRepo: repo,
+		userRepo:      repo,
+		policy:        policy,
+		clock:         fixedClock(testNow),
+		config:        config.Scheduler{MaxAhead: 24 * time.Hour},
+	}
+}
+
+func TestScheduleService(t *testing.T) {
+	valid := NewScheduled{RoomID: testRoomID, UserID: testUserID, Message: " hello ", PostAt: testNow.Add(time.Hour)}
+	withPostAt := func(postAt time.Time) NewScheduled {
+		newScheduled := valid
+		newScheduled.PostAt = postAt
+		return newScheduled
+	}
+	withMessage := func(message string, attachments ...string) NewScheduled {
+		newScheduled := valid
+		newScheduled.Message = message
+		newScheduled.Attachments = attachments
+		return newScheduled
+	}
+
+	tt := []struct {
+		Name         string
+		NewScheduled NewScheduled
+		Rooms        []string
+		addErr       error
+		ErrWant      error
+	}{
+		{
+			Name:         "Schedule Success",
+			NewScheduled: valid,
+			Rooms:        []string{testRoomID},
+		},
+		{
+			Name:         "Schedule Success attachments only",
+			NewScheduled: withMessage("", "61f61d94fc663b6f4c8f3190"),
+			Rooms:        []string{testRoomID},
+		},
+		{
+			Name:         "Schedule Failed in the past",
+			NewScheduled: withPostAt(testNow),
+			Rooms:        []string{testRoomID},
+			ErrWant:      ErrInvalidTime,
+		},
+		{
+			Name:         "Schedule Failed too far ahead",
+			NewScheduled: withPostAt(testNow.Add(25 * time.Hour)),
+			Rooms:        []string{testRoomID},
+			ErrWant:      ErrInvalidTime,
+		},
+		{
+			Name:         "Schedule Failed message too long",
+			NewScheduled: withMessage("hello world, hello"),
+			Rooms:        []string{testRoomID},
+			ErrWant:      ErrInvalidMessage,
+		},
+		{
+			Name:         "Schedule Failed not a member",
+			NewScheduled: valid,
+			Rooms:        []string{"otherroom"},
+			ErrWant:      mongodb.ErrNotMember,
+		},
+		{
+			Name:         "Schedule Failed insert",
+			NewScheduled: valid,
+			Rooms:        []string{testRoomID},
+			addErr:       errors.New("insert failed"),
+			ErrWant:      errors.New("insert failed"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+				return &mongodb.User{ID: testUserID, Username: "budi", Rooms: tc.Rooms}, nil
+			}
+			addScheduledMessageRepoFunc = func(scheduled mongodb.ScheduledMessage) (string, error) {
+				assert.Equal(t, mongodb.ScheduledPending, scheduled.Status)
+				assert.Equal(t, testNow, scheduled.CreatedAt)
+				return "61f61d94fc663b6f4c8f3199", tc.addErr
+			}
+
+			scheduled, err := newTestScheduledService(t).Schedule(context.Background(), tc.NewScheduled)
+
+			if tc.ErrWant != nil {
+				if !errors.Is(err, tc.ErrWant) {
+					assert.Equal(t, tc.ErrWant, err)
+				}
+				assert.Nil(t, scheduled)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "61f61d94fc663b6f4c8f3199", scheduled.ID)
+			assert.Equal(t, "budi", scheduled.Username)
+			assert.Equal(t, tc.NewScheduled.PostAt, scheduled.PostAt)
+			// the text is cleaned by the message policy
+			assert.Equal(t, tc.NewScheduled.Attachments, scheduled.Attachments)
+			if tc.NewScheduled.Message != "" {
+				assert.Equal(t, "hello", scheduled.Message)
+			}
+		})
+	}
+}
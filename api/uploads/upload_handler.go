@@ -0,0 +1,135 @@
+package uploads
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/blobstore"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+// formOverhead is room for the multipart boundaries and the other form fields
+const formOverhead = 1 << 20
+
+type IUploadHandler interface {
+	Upload(w http.ResponseWriter, r *http.Request)
+	Download(w http.ResponseWriter, r *http.Request)
+}
+type uploadHandler struct {
+	uploadService IUploadService
+	maxBytes      int64
+}
+
+// NewUploadHandler will initialize uploadHandler object
+func NewUploadHandler(attachmentRepo mongodb.AttachmentRepository, userRepo mongodb.UserRepository, store blobstore.BlobStore, uploadConfig config.Upload) *uploadHandler {
+	uploadService := NewUploadService(attachmentRepo, userRepo, store, uploadConfig)
+	return &uploadHandler{uploadService: uploadService, maxBytes: uploadService.config.MaxBytes}
+}
+
+// Upload will store the multipart "file" field for the room_id and user_id fields, the attachment is returned
+func (h *uploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+formOverhead)
+	if err := r.ParseMultipartForm(formOverhead); err != nil {
+		log.Println("Upload - invalid multipart form: ", err)
+		code := http.StatusBadRequest
+		if strings.Contains(err.Error(), "request body too large") {
+			code, err = http.StatusRequestEntityTooLarge, ErrFileTooLarge
+		}
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		response := common.ResponseErrorFormatter(http.StatusBadRequest, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer file.Close()
+
+	upload := NewUpload{
+		RoomID: r.FormValue("room_id"),
+		UserID: r.FormValue("user_id"),
+		Name:   header.Filename,
+		Size:   header.Size,
+		File:   file,
+	}
+	attachment, err := h.uploadService.Upload(r.Context(), upload)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := common.ResponseFormatter(http.StatusCreated, "success", "upload successfull", attachment)
+	log.Println("RESPONSE TO BROWSER: ", response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Download will send the content of the attachment {id} to user_id, who must be a member of its room
+func (h *uploadHandler) Download(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userId := r.URL.Query().Get("user_id")
+	attachment, content, err := h.uploadService.Open(r.Context(), id, userId)
+	if err != nil {
+		code := errorCode(err)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	defer content.Close()
+
+	// images are shown in the chat, anything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	// older Go versions can not format non-ASCII file names, the browser picks a name then
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name}); value != "" {
+		disposition = value
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		log.Println("Download - failed to send attachment: ", err)
+	}
+}
+
+// errorCode will map an error of IUploadService to a http status code
+func errorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidUpload):
+		return http.StatusBadRequest
+	case errors.Is(err, mongodb.ErrNotMember):
+		return http.StatusForbidden
+	case errors.Is(err, ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, mongodb.ErrAttachmentNotFound), errors.Is(err, blobstore.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return common.ErrorCode(err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,203 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	uploadFunc func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error)
+	openFunc   func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error)
+)
+
+type mockService struct{}
+
+func (m *mockService) Upload(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+	return uploadFunc(ctx, upload)
+}
+func (m *mockService) Open(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+	return openFunc(ctx, id, userId)
+}
+
+// newUploadRequest will build a multipart request, fileSize 0 leaves the file field out
+func newUploadRequest(fileSize int) *http.Request {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("room_id", testRoomID)
+	form.WriteField("user_id", testUserID)
+	if fileSize > 0 {
+		part, _ := form.CreateFormFile("file", "photo.png")
+		part.Write(bytes.Repeat([]byte("a"), fileSize))
+	}
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "/uploads", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestUpload(t *testing.T) {
+
+	tt := []struct {
+		Name     string
+		mockFunc func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error)
+		FileSize int
+		CodeWant int
+	}{
+		{
+			Name: "Upload Success",
+			mockFunc: func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+				return &mongodb.Attachment{ID: "abc", Name: upload.Name, RoomID: upload.RoomID, UserID: upload.UserID}, nil
+			},
+			FileSize: 10,
+			CodeWant: http.StatusCreated,
+		},
+		{
+			Name: "Upload Failed missing file",
+			mockFunc: func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+				return &mongodb.Attachment{}, nil
+			},
+			CodeWant: http.StatusBadRequest,
+		},
+		{
+			Name: "Upload Failed body too large",
+			mockFunc: func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+				return &mongodb.Attachment{}, nil
+			},
+			FileSize: 2048 + formOverhead,
+			CodeWant: http.StatusRequestEntityTooLarge,
+		},
+		{
+			Name: "Upload Failed not a room member",
+			mockFunc: func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+				return nil, mongodb.ErrNotMember
+			},
+			FileSize: 10,
+			CodeWant: http.StatusForbidden,
+		},
+		{
+			Name: "Upload Failed type not allowed",
+			mockFunc: func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+				return nil, ErrUnsupportedType
+			},
+			FileSize: 10,
+			CodeWant: http.StatusUnsupportedMediaType,
+		},
+		{
+			Name: "Upload Failed",
+			mockFunc: func(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+				return nil, errors.New("upload failed")
+			},
+			FileSize: 10,
+			CodeWant: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			uploadFunc = tc.mockFunc
+
+			uploadHandler := &uploadHandler{uploadService: &mockService{}, maxBytes: 1024}
+			rr := httptest.NewRecorder()
+			req := newUploadRequest(tc.FileSize)
+
+			uploadHandler.Upload(rr, req)
+
+			// check header StatusCode
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			// check response (JSON format) StatusCode
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+		})
+	}
+}
+
+func TestDownload(t *testing.T) {
+
+	tt := []struct {
+		Name            string
+		mockFunc        func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error)
+		CodeWant        int
+		DispositionWant string
+	}{
+		{
+			Name: "Download image Success",
+			mockFunc: func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+				return &mongodb.Attachment{ID: id, Name: "photo.png", ContentType: "image/png", Size: 5}, ioutil.NopCloser(strings.NewReader("hello")), nil
+			},
+			CodeWant:        http.StatusOK,
+			DispositionWant: `inline; filename=photo.png`,
+		},
+		{
+			Name: "Download file Success",
+			mockFunc: func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+				return &mongodb.Attachment{ID: id, Name: "my notes.txt", ContentType: "text/plain", Size: 5}, ioutil.NopCloser(strings.NewReader("hello")), nil
+			},
+			CodeWant:        http.StatusOK,
+			DispositionWant: `attachment; filename="my notes.txt"`,
+		},
+		{
+			Name: "Download Failed not a room member",
+			mockFunc: func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+				return nil, nil, mongodb.ErrNotMember
+			},
+			CodeWant: http.StatusForbidden,
+		},
+		{
+			Name: "Download Failed not found",
+			mockFunc: func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+				return nil, nil, mongodb.ErrAttachmentNotFound
+			},
+			CodeWant: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			var gotId, gotUserId string
+			openFunc = func(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+				gotId, gotUserId = id, userId
+				return tc.mockFunc(ctx, id, userId)
+			}
+
+			uploadHandler := &uploadHandler{uploadService: &mockService{}, maxBytes: 1024}
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/files/abc?user_id="+testUserID, nil)
+			routeContext := chi.NewRouteContext()
+			routeContext.URLParams.Add("id", "abc")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, routeContext))
+
+			uploadHandler.Download(rr, req)
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			assert.Equal(t, "abc", gotId)
+			assert.Equal(t, testUserID, gotUserId)
+			if tc.CodeWant != http.StatusOK {
+				var response common.Response
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					assert.Errorf(t, err, "response format is not valid")
+				}
+				assert.EqualValues(t, tc.CodeWant, response.Meta.Code)
+				return
+			}
+			assert.Equal(t, "hello", rr.Body.String())
+			assert.Equal(t, tc.DispositionWant, rr.Header().Get("Content-Disposition"))
+			assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pranotobudi/myslack-happy-backend/blobstore"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidUpload   = errors.New("room_id, user_id and file are required")
+	ErrFileTooLarge    = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("file type is not allowed")
+)
+
+// sniffLen is how much of the file http.DetectContentType looks at
+const sniffLen = 512
+
+// maxNameLength is in bytes, longer file names are cut
+const maxNameLength = 255
+
+// NewUpload is a file posted to /uploads
+type NewUpload struct {
+	RoomID string
+	UserID string
+	Name   string
+	Size   int64
+	File   io.Reader
+}
+
+type IUploadService interface {
+	Upload(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error)
+	Open(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error)
+}
+type uploadService struct {
+	attachmentRepo mongodb.AttachmentRepository
+	userRepo       mongodb.UserRepository
+	store          blobstore.BlobStore
+	config         config.Upload
+}
+
+// NewUploadService will initialize uploadService object, the files are kept in store
+func NewUploadService(attachmentRepo mongodb.AttachmentRepository, userRepo mongodb.UserRepository, store blobstore.BlobStore, uploadConfig config.Upload) *uploadService {
+	return &uploadService{attachmentRepo: attachmentRepo, userRepo: userRepo, store: store, config: uploadConfig}
+}
+
+// Upload will check the file and keep it in the blob store, the metadata is added to mongoDB.
+// the MIME type is sniffed from the content, the client's Content-Type is ignored
+func (s *uploadService) Upload(ctx context.Context, upload NewUpload) (*mongodb.Attachment, error) {
+	if upload.RoomID == "" || upload.UserID == "" || upload.File == nil {
+		return nil, ErrInvalidUpload
+	}
+	if upload.Size > s.config.MaxBytes {
+		return nil, ErrFileTooLarge
+	}
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, upload.UserID, upload.RoomID); err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(upload.File, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil || !s.allowed(contentType) {
+		return nil, ErrUnsupportedType
+	}
+
+	objID := primitive.NewObjectID()
+	attachment := mongodb.Attachment{
+		ID:          objID.Hex(),
+		Name:        cleanName(upload.Name),
+		ContentType: contentType,
+		Size:        upload.Size,
+		RoomID:      upload.RoomID,
+		UserID:      upload.UserID,
+		CreatedAt:   time.Now(),
+	}
+	file := io.MultiReader(bytes.NewReader(head), upload.File)
+	if err := s.store.Put(ctx, blobKey(attachment.ID), file, attachment.Size, contentType); err != nil {
+		log.Println("failed to store upload: ", err)
+		return nil, err
+	}
+
+	doc := bson.D{
+		{Key: "_id", Value: objID},
+		{Key: "name", Value: attachment.Name},
+		{Key: "content_type", Value: attachment.ContentType},
+		{Key: "size", Value: attachment.Size},
+		{Key: "room_id", Value: attachment.RoomID},
+		{Key: "user_id", Value: attachment.UserID},
+		{Key: "created_at", Value: attachment.CreatedAt},
+	}
+	if _, err := s.attachmentRepo.AddAttachment(ctx, doc); err != nil {
+		// no metadata, nobody can ever download it
+		if err := s.store.Delete(ctx, blobKey(attachment.ID)); err != nil {
+			log.Println("failed to delete orphan upload: ", err)
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// Open will return the attachment and its content, for members of the attachment's room only.
+// the caller closes the content
+func (s *uploadService) Open(ctx context.Context, id string, userId string) (*mongodb.Attachment, io.ReadCloser, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil, mongodb.ErrAttachmentNotFound
+	}
+	attachment, err := s.attachmentRepo.GetAttachment(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := mongodb.RoomMember(ctx, s.userRepo, userId, attachment.RoomID); err != nil {
+		return nil, nil, err
+	}
+	content, err := s.store.Get(ctx, blobKey(attachment.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+func (s *uploadService) allowed(contentType string) bool {
+	for _, allowed := range s.config.AllowedTypes {
+		if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// blobKey is where the content of an attachment is kept in the blob store
+func blobKey(id string) string {
+	return "attachments/" + id
+}
+
+// cleanName will keep the base name of the uploaded file only, it is shown to other users and sent back in Content-Disposition
+func cleanName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
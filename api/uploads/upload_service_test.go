@@ -0,0 +1,241 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/pranotobudi/myslack-happy-backend/blobstore"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testUserID = "61cfa908eca4dd2b9d11d9ee"
+	testRoomID = "61cc50877ea033031b1a950e"
+)
+
+// a PNG signature is enough for http.DetectContentType
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+var (
+	getUserRepoFunc       func(filter interface{}) (*mongodb.User, error)
+	addAttachmentRepoFunc func(attachment interface{}) (string, error)
+	getAttachmentRepoFunc func(filter interface{}) (*mongodb.Attachment, error)
+)
+
+type mockUploadRepo struct {
+	mongodb.AttachmentRepository
+	mongodb.UserRepository
+}
+
+func (m *mockUploadRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockUploadRepo) AddAttachment(ctx context.Context, attachment interface{}) (string, error) {
+	return addAttachmentRepoFunc(attachment)
+}
+func (m *mockUploadRepo) GetAttachment(ctx context.Context, filter interface{}) (*mongodb.Attachment, error) {
+	return getAttachmentRepoFunc(filter)
+}
+
+func newTestUploadService(t *testing.T) (*uploadService, blobstore.BlobStore) {
+	store, err := blobstore.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	repo := &mockUploadRepo{}
+	return NewUploadService(repo, repo, store, config.Upload{MaxBytes: 1024, AllowedTypes: []string{"image/png", "text/plain"}}), store
+}
+
+func memberOf(rooms ...string) func(filter interface{}) (*mongodb.User, error) {
+	return func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: testUserID, Rooms: rooms}, nil
+	}
+}
+
+func TestUploadService(t *testing.T) {
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 100)...)
+
+	tt := []struct {
+		Name             string
+		getUserMockFunc  func(filter interface{}) (*mongodb.User, error)
+		addAttachmentErr error
+		Upload           NewUpload
+		ErrWant          error
+		ContentTypeWant  string
+		Stored           bool
+	}{
+		{
+			Name:            "Upload image Success",
+			getUserMockFunc: memberOf(testRoomID),
+			Upload:          NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "photo.png", Size: int64(len(png)), File: bytes.NewReader(png)},
+			ContentTypeWant: "image/png",
+			Stored:          true,
+		},
+		{
+			Name:            "Upload text Success, type is sniffed",
+			getUserMockFunc: memberOf(testRoomID),
+			Upload:          NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "notes.png", Size: 5, File: strings.NewReader("hello")},
+			ContentTypeWant: "text/plain",
+			Stored:          true,
+		},
+		{
+			Name:            "Upload Failed missing room",
+			getUserMockFunc: memberOf(testRoomID),
+			Upload:          NewUpload{UserID: testUserID, Name: "photo.png", Size: 5, File: strings.NewReader("hello")},
+			ErrWant:         ErrInvalidUpload,
+		},
+		{
+			Name:            "Upload Failed too large",
+			getUserMockFunc: memberOf(testRoomID),
+			Upload:          NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "big.txt", Size: 2048, File: strings.NewReader("hello")},
+			ErrWant:         ErrFileTooLarge,
+		},
+		{
+			Name:            "Upload Failed type not allowed",
+			getUserMockFunc: memberOf(testRoomID),
+			Upload:          NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "page.html", Size: 15, File: strings.NewReader("<html><script>")},
+			ErrWant:         ErrUnsupportedType,
+		},
+		{
+			Name:            "Upload Failed not a room member",
+			getUserMockFunc: memberOf("otherroom"),
+			Upload:          NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "photo.png", Size: 5, File: strings.NewReader("hello")},
+			ErrWant:         mongodb.ErrNotMember,
+		},
+		{
+			Name: "Upload Failed unknown user",
+			getUserMockFunc: func(filter interface{}) (*mongodb.User, error) {
+				return nil, mongodb.ErrNotFound
+			},
+			Upload:  NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "photo.png", Size: 5, File: strings.NewReader("hello")},
+			ErrWant: mongodb.ErrNotMember,
+		},
+		{
+			Name:             "Upload Failed add attachment, blob is removed",
+			getUserMockFunc:  memberOf(testRoomID),
+			addAttachmentErr: errors.New("add attachment failed"),
+			Upload:           NewUpload{RoomID: testRoomID, UserID: testUserID, Name: "photo.png", Size: 5, File: strings.NewReader("hello")},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = tc.getUserMockFunc
+			var addedDoc interface{}
+			addAttachmentRepoFunc = func(attachment interface{}) (string, error) {
+				addedDoc = attachment
+				return "", tc.addAttachmentErr
+			}
+			uploadService, store := newTestUploadService(t)
+
+			attachment, err := uploadService.Upload(context.Background(), tc.Upload)
+
+			if !tc.Stored {
+				assert.NotNil(t, err)
+				assert.Nil(t, attachment)
+				if tc.ErrWant != nil {
+					assert.Equal(t, tc.ErrWant, err)
+				}
+				if addedDoc != nil {
+					id := addedDoc.(bson.D)[0].Value.(primitive.ObjectID)
+					_, err := store.Get(context.Background(), blobKey(id.Hex()))
+					assert.Equal(t, blobstore.ErrNotFound, err)
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.ContentTypeWant, attachment.ContentType)
+			assert.Equal(t, tc.Upload.Name, attachment.Name)
+			content, err := store.Get(context.Background(), blobKey(attachment.ID))
+			assert.Nil(t, err)
+			data, _ := ioutil.ReadAll(content)
+			content.Close()
+			assert.EqualValues(t, tc.Upload.Size, len(data))
+		})
+	}
+}
+
+func TestOpenService(t *testing.T) {
+	tt := []struct {
+		Name            string
+		ID              string
+		getUserMockFunc func(filter interface{}) (*mongodb.User, error)
+		Stored          bool
+		ErrWant         error
+	}{
+		{
+			Name:            "Open Success",
+			ID:              "61cc50877ea033031b1a9500",
+			getUserMockFunc: memberOf(testRoomID),
+			Stored:          true,
+		},
+		{
+			Name:            "Open Failed not a room member",
+			ID:              "61cc50877ea033031b1a9500",
+			getUserMockFunc: memberOf("otherroom"),
+			Stored:          true,
+			ErrWant:         mongodb.ErrNotMember,
+		},
+		{
+			Name:            "Open Failed invalid id",
+			ID:              "abc",
+			getUserMockFunc: memberOf(testRoomID),
+			ErrWant:         mongodb.ErrAttachmentNotFound,
+		},
+		{
+			Name:            "Open Failed blob missing",
+			ID:              "61cc50877ea033031b1a9500",
+			getUserMockFunc: memberOf(testRoomID),
+			ErrWant:         blobstore.ErrNotFound,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			getUserRepoFunc = tc.getUserMockFunc
+			getAttachmentRepoFunc = func(filter interface{}) (*mongodb.Attachment, error) {
+				return &mongodb.Attachment{ID: tc.ID, RoomID: testRoomID, ContentType: "text/plain", Size: 5}, nil
+			}
+			uploadService, store := newTestUploadService(t)
+			if tc.Stored {
+				store.Put(context.Background(), blobKey(tc.ID), strings.NewReader("hello"), 5, "text/plain")
+			}
+
+			attachment, content, err := uploadService.Open(context.Background(), tc.ID, testUserID)
+
+			if tc.ErrWant != nil {
+				assert.Equal(t, tc.ErrWant, err)
+				assert.Nil(t, attachment)
+				assert.Nil(t, content)
+				return
+			}
+			assert.Nil(t, err)
+			data, _ := ioutil.ReadAll(content)
+			content.Close()
+			assert.Equal(t, "hello", string(data))
+		})
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tt := []struct {
+		Name string
+		Want string
+	}{
+		{Name: "photo.png", Want: "photo.png"},
+		{Name: "../../etc/passwd", Want: "passwd"},
+		{Name: `C:\Users\bud\photo.png`, Want: "photo.png"},
+		{Name: "a\r\nb.txt", Want: "ab.txt"},
+		{Name: "", Want: "file"},
+		{Name: strings.Repeat("é", 200), Want: strings.Repeat("é", 127)},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Want, cleanName(tc.Name))
+		})
+	}
+}
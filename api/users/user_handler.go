@@ -17,15 +17,14 @@ type IUserHandler interface {
 	GetUserByEmail(w http.ResponseWriter, r *http.Request)
 	UserAuth(w http.ResponseWriter, r *http.Request)
 	UpdateUserRooms(w http.ResponseWriter, r *http.Request)
-	HelloWorld(w http.ResponseWriter, r *http.Request)
 }
 type userHandler struct {
 	userService IUserService
 }
 
 // NewUserHandler will initialize userHandler object
-func NewUserHandler() *userHandler {
-	userService := NewUserService()
+func NewUserHandler(repo mongodb.UserRepository) *userHandler {
+	userService := NewUserService(repo)
 	return &userHandler{userService: userService}
 }
 
@@ -46,10 +45,11 @@ func (h *userHandler) GetUserByEmail(w http.ResponseWriter, r *http.Request) {
 	}
 	// filter := bson.M{"email": email}
 	// userPtr, err := mongo.GetUser(filter)
-	userPtr, err := h.userService.GetUser(email)
+	userPtr, err := h.userService.GetUser(r.Context(), email)
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
@@ -68,7 +68,7 @@ func (h *userHandler) GetUserByEmail(w http.ResponseWriter, r *http.Request) {
 	// c.JSON(http.StatusOK, response)
 }
 
-// UserAuth will return user if exist or create new user if not exist
+// UserAuth will return user if exist with 200, or create new user if not exist with 201
 func (h *userHandler) UserAuth(w http.ResponseWriter, r *http.Request) {
 	// login
 	var userAuth mongodb.UserAuth
@@ -85,17 +85,28 @@ func (h *userHandler) UserAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Println("GetUserByEmail - email: ", userAuth.Email)
-	userPtr, err := h.userService.UserAuth(userAuth)
+	userPtr, created, err := h.userService.UserAuth(r.Context(), userAuth)
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := http.StatusBadRequest
+		if !errors.Is(err, ErrInvalidEmail) {
+			code = common.ErrorCode(err, http.StatusInternalServerError)
+		}
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	fmt.Println("inside room_io_handler-UserAuth user registered! ID: ", *userPtr)
+	if created {
+		fmt.Println("inside room_io_handler-UserAuth user registered! ID: ", *userPtr)
+		response := common.ResponseFormatter(http.StatusCreated, "success", "register user successfull", *userPtr)
+		log.Println("RESPONSE TO BROWSER: ", response)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
 	response := common.ResponseFormatter(http.StatusOK, "success", "get user successfull", *userPtr)
 	log.Println("RESPONSE TO BROWSER: ", response)
 	w.WriteHeader(http.StatusOK)
@@ -120,10 +131,11 @@ func (h *userHandler) UpdateUserRooms(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userPtr, err := h.userService.UpdateUserRooms(userMongo)
+	userPtr, err := h.userService.UpdateUserRooms(r.Context(), userMongo)
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
@@ -143,14 +155,21 @@ type HelloData struct {
 	Rooms []mongodb.Room
 }
 
-// HelloWorld will return welcome message for home path
-func HelloWorld(w http.ResponseWriter, r *http.Request) {
+// HelloWorld will return the handler of the welcome page for home path, listing the rooms of roomService
+func HelloWorld(roomService rooms.IRoomService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		helloWorld(roomService, w, r)
+	}
+}
+
+// helloWorld will render the welcome page with the rooms
+func helloWorld(roomService rooms.IRoomService, w http.ResponseWriter, r *http.Request) {
 	t := template.Must(template.ParseFiles("./template/hello.html"))
-	roomService := rooms.NewRoomService()
-	rooms, err := roomService.GetRooms()
+	rooms, err := roomService.GetRooms(r.Context())
 	if err != nil {
-		response := common.ResponseErrorFormatter(http.StatusInternalServerError, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		code := common.ErrorCode(err, http.StatusInternalServerError)
+		response := common.ResponseErrorFormatter(code, err)
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(response)
 		// w.Write([]byte(fmt.Sprintf("%v", response)))
 		// c.JSON(http.StatusInternalServerError, response)
@@ -2,6 +2,7 @@ package users
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -10,29 +11,30 @@ import (
 
 	"github.com/pranotobudi/myslack-happy-backend/common"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	getUserFunc         func(email string) (*mongodb.User, error)
-	userAuthFunc        func(userAuth mongodb.UserAuth) (*mongodb.User, error)
+	userAuthFunc        func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error)
 	updateUserRoomsFunc func(userMongo mongodb.User) (*mongodb.User, error)
 	userMailChatFunc    func(userMongo mongodb.User) (string, error)
 )
 
 type mockService struct{}
 
-func (m *mockService) GetUser(email string) (*mongodb.User, error) {
+func (m *mockService) GetUser(ctx context.Context, email string) (*mongodb.User, error) {
 	return getUserFunc(email)
 }
-func (m *mockService) UserAuth(userAuth mongodb.UserAuth) (*mongodb.User, error) {
+func (m *mockService) UserAuth(ctx context.Context, userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
 	return userAuthFunc(userAuth)
 }
-func (m *mockService) UpdateUserRooms(userMongo mongodb.User) (*mongodb.User, error) {
+func (m *mockService) UpdateUserRooms(ctx context.Context, userMongo mongodb.User) (*mongodb.User, error) {
 	return updateUserRoomsFunc(userMongo)
 }
 
-func (m *mockService) UserMailChat(userMongo mongodb.User) (string, error) {
+func (m *mockService) UserMailChat(ctx context.Context, userMongo mongodb.User) (string, error) {
 	return userMailChatFunc(userMongo)
 }
 
@@ -66,7 +68,7 @@ func TestGetUser(t *testing.T) {
 			getUserFunc = tc.mockFunc
 
 			// messageHandler := NewMessageHandler(&mockService{})
-			userHandler := NewUserHandler()
+			userHandler := NewUserHandler(memdb.New())
 			userHandler.userService = &mockService{}
 			rr := httptest.NewRecorder()
 			// c, _ := gin.CreateTestContext(rc)
@@ -90,33 +92,51 @@ func TestUserAuth(t *testing.T) {
 
 	tt := []struct {
 		Name       string
-		mockFunc   func(userAuth mongodb.UserAuth) (*mongodb.User, error)
+		mockFunc   func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error)
 		CodeWant   int
 		HttpMethod string
 		Body       []byte
 	}{
 		{
 			Name: "UserAuth Success",
-			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, error) {
-				return &mongodb.User{}, nil
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return &mongodb.User{}, false, nil
 			},
 			CodeWant:   http.StatusOK,
 			HttpMethod: http.MethodPost,
 			Body:       []byte(`{"email":"bud@gmail.com", "user_image":"https://aws.com"}`),
 		},
+		{
+			Name: "UserAuth Success new user",
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return &mongodb.User{Email: userAuth.Email}, true, nil
+			},
+			CodeWant:   http.StatusCreated,
+			HttpMethod: http.MethodPost,
+			Body:       []byte(`{"email":"new@gmail.com", "user_image":"https://aws.com"}`),
+		},
 		{
 			Name: "UserAuth Failed json format error",
-			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, error) {
-				return nil, errors.New("UserAuth Failed json format error")
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return nil, false, errors.New("UserAuth Failed json format error")
 			},
 			CodeWant:   http.StatusBadRequest,
 			HttpMethod: http.MethodPost,
 			Body:       []byte(``),
 		},
+		{
+			Name: "UserAuth Failed no email",
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return nil, false, ErrInvalidEmail
+			},
+			CodeWant:   http.StatusBadRequest,
+			HttpMethod: http.MethodPost,
+			Body:       []byte(`{"user_image":"https://aws.com"}`),
+		},
 		{
 			Name: "UserAuth Failed",
-			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, error) {
-				return nil, errors.New("UserAuth Failed")
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return nil, false, errors.New("UserAuth Failed")
 			},
 			CodeWant:   http.StatusInternalServerError,
 			HttpMethod: http.MethodPost,
@@ -128,7 +148,7 @@ func TestUserAuth(t *testing.T) {
 			userAuthFunc = tc.mockFunc
 
 			// messageHandler := NewMessageHandler(&mockService{})
-			userHandler := NewUserHandler()
+			userHandler := NewUserHandler(memdb.New())
 			userHandler.userService = &mockService{}
 			rr := httptest.NewRecorder()
 			// c, _ := gin.CreateTestContext(rc)
@@ -204,7 +224,7 @@ func TestUpdateUserRooms(t *testing.T) {
 			updateUserRoomsFunc = tc.mockFunc
 
 			// messageHandler := NewMessageHandler(&mockService{})
-			userHandler := NewUserHandler()
+			userHandler := NewUserHandler(memdb.New())
 			userHandler.userService = &mockService{}
 			rr := httptest.NewRecorder()
 			// c, _ := gin.CreateTestContext(rc)
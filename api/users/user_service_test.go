@@ -1,6 +1,7 @@
 package users
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -11,22 +12,22 @@ import (
 
 var (
 	getUserRepoFunc    func(filter interface{}) (*mongodb.User, error)
-	addUserRepoFunc    func(user interface{}) (string, error)
+	findOrAddUserFunc  func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error)
 	updateUserRepoFunc func(filter interface{}, update interface{}, options *options.UpdateOptions) error
 )
 
 type mockUserRepo struct {
-	mongodb.IMongoDB
+	mongodb.UserRepository
 }
 
-func (m *mockUserRepo) GetUser(filter interface{}) (*mongodb.User, error) {
+func (m *mockUserRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
 	return getUserRepoFunc(filter)
 }
 
-func (m *mockUserRepo) AddUser(user interface{}) (string, error) {
-	return addUserRepoFunc(user)
+func (m *mockUserRepo) FindOrAddUser(ctx context.Context, userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+	return findOrAddUserFunc(userAuth)
 }
-func (m *mockUserRepo) UpdateUser(filter interface{}, update interface{}, options *options.UpdateOptions) error {
+func (m *mockUserRepo) UpdateUser(ctx context.Context, filter interface{}, update interface{}, options *options.UpdateOptions) error {
 	return updateUserRepoFunc(filter, update, options)
 }
 func TestGetUserService(t *testing.T) {
@@ -54,10 +55,9 @@ func TestGetUserService(t *testing.T) {
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
 			getUserRepoFunc = tc.mockFunc
-			userService := NewUserService()
-			userService.repo = &mockUserRepo{}
+			userService := NewUserService(&mockUserRepo{})
 
-			user, err := userService.GetUser("lumion@gmail.com")
+			user, err := userService.GetUser(context.Background(), "lumion@gmail.com")
 
 			if tc.IsSuccess {
 				assert.NotNil(t, user)
@@ -73,47 +73,60 @@ func TestGetUserService(t *testing.T) {
 func TestUserAuthService(t *testing.T) {
 
 	tt := []struct {
-		Name            string
-		getUserMockFunc func(filter interface{}) (*mongodb.User, error)
-		addUserMockFunc func(user interface{}) (string, error)
-		IsSuccess       bool
+		Name        string
+		mockFunc    func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error)
+		UserAuth    mongodb.UserAuth
+		CreatedWant bool
+		ErrWant     error
 	}{
 		{
-			Name: "UserAuth Success",
-			getUserMockFunc: func(filter interface{}) (*mongodb.User, error) {
-				return &mongodb.User{ID: "abc123"}, nil
+			Name: "UserAuth Success existing user",
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return &mongodb.User{ID: "abc123", Email: userAuth.Email}, false, nil
 			},
-			addUserMockFunc: func(user interface{}) (string, error) {
-				return "abc123", nil
+			UserAuth:    mongodb.UserAuth{Email: "lumion@gmail.com"},
+			CreatedWant: false,
+		},
+		{
+			Name: "UserAuth Success new user",
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return &mongodb.User{ID: "abc123", Email: userAuth.Email}, true, nil
 			},
-			IsSuccess: true,
+			UserAuth:    mongodb.UserAuth{Email: "lumion@gmail.com"},
+			CreatedWant: true,
 		},
 		{
-			Name: "UserAuth Failed",
-			getUserMockFunc: func(filter interface{}) (*mongodb.User, error) {
-				return nil, errors.New("get user failed")
+			Name: "UserAuth Failed no email",
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return nil, false, errors.New("repository must not be called without an email")
 			},
-			addUserMockFunc: func(user interface{}) (string, error) {
-				return "", errors.New("add user failed")
+			UserAuth: mongodb.UserAuth{UserImage: "https://aws.com"},
+			ErrWant:  ErrInvalidEmail,
+		},
+		{
+			Name: "UserAuth Failed",
+			mockFunc: func(userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+				return nil, false, mongodb.ErrUnavailable
 			},
-			IsSuccess: false,
+			UserAuth: mongodb.UserAuth{Email: "lumion@gmail.com"},
+			ErrWant:  mongodb.ErrUnavailable,
 		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
-			getUserRepoFunc = tc.getUserMockFunc
-			addUserRepoFunc = tc.addUserMockFunc
-			userService := NewUserService()
-			userService.repo = &mockUserRepo{}
+			findOrAddUserFunc = tc.mockFunc
+			userService := NewUserService(&mockUserRepo{})
 
-			user, err := userService.UserAuth(mongodb.UserAuth{Email: "lumion@gmail.com"})
+			user, created, err := userService.UserAuth(context.Background(), tc.UserAuth)
 
-			if tc.IsSuccess {
-				assert.NotNil(t, user)
+			if tc.ErrWant == nil {
 				assert.Nil(t, err)
+				assert.Equal(t, tc.UserAuth.Email, user.Email)
+				assert.Equal(t, tc.CreatedWant, created)
 			} else {
-				assert.NotNil(t, err)
+				assert.True(t, errors.Is(err, tc.ErrWant))
 				assert.Nil(t, user)
+				assert.False(t, created)
 			}
 		})
 	}
@@ -153,10 +166,9 @@ func TestUpdateUserRoomsService(t *testing.T) {
 		t.Run(tc.Name, func(t *testing.T) {
 			getUserRepoFunc = tc.getUserMockFunc
 			updateUserRepoFunc = tc.updateUserMockFunc
-			userService := NewUserService()
-			userService.repo = &mockUserRepo{}
+			userService := NewUserService(&mockUserRepo{})
 
-			user, err := userService.UpdateUserRooms(mongodb.User{ID: "abd123"})
+			user, err := userService.UpdateUserRooms(context.Background(), mongodb.User{ID: "abd123"})
 
 			if tc.IsSuccess {
 				assert.NotNil(t, user)
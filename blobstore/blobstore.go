@@ -0,0 +1,32 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+)
+
+// ErrNotFound is returned by Get when there is no blob for the key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files, keys are slash separated paths like "attachments/<id>"
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New will initialize the BlobStore selected by the config
+func New(blobConfig config.BlobStore) (BlobStore, error) {
+	switch blobConfig.Kind {
+	case "fs", "":
+		return NewFileStore(blobConfig.Dir)
+	case "s3":
+		return NewS3Store(blobConfig.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob store: %v", blobConfig.Kind)
+	}
+}
@@ -0,0 +1,44 @@
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	err = store.Put(ctx, "attachments/abc", strings.NewReader("hello"), 5, "text/plain")
+	assert.Nil(t, err)
+
+	body, err := store.Get(ctx, "attachments/abc")
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "hello", string(data))
+
+	assert.Nil(t, store.Delete(ctx, "attachments/abc"))
+	_, err = store.Get(ctx, "attachments/abc")
+	assert.Equal(t, ErrNotFound, err)
+	// deleting twice is fine
+	assert.Nil(t, store.Delete(ctx, "attachments/abc"))
+}
+
+func TestFileStoreInvalidKey(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+
+	tt := []string{"", "../secret", "attachments/../../secret", "/"}
+	for _, key := range tt {
+		t.Run(key, func(t *testing.T) {
+			err := store.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain")
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a local stand-in for an S3-compatible storage, it checks the request signature
+// from what it received on the wire and keeps objects in memory
+type fakeS3 struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	types     map[string]string
+	secretKey string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = data
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != 16 {
+		return false
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.Host + "\nx-amz-content-sha256:" + r.Header.Get("X-Amz-Content-Sha256") + "\nx-amz-date:" + amzDate + "\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := amzDate[:8] + "/us-east-1/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+	key := hmacSHA256([]byte("AWS4"+f.secretKey), amzDate[:8])
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	want := "AWS4-HMAC-SHA256 Credential=AKID/" + scope + ", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" +
+		hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return r.Header.Get("Authorization") == want
+}
+
+func newTestS3Store(t *testing.T, secretKey string) (*s3Store, *fakeS3) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string), secretKey: "secret"}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(config.S3{
+		Endpoint:        server.URL,
+		Bucket:          "chat",
+		Region:          "us-east-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: secretKey,
+	})
+	assert.Nil(t, err)
+	return store, fake
+}
+
+func TestS3Store(t *testing.T) {
+	store, fake := newTestS3Store(t, "secret")
+	ctx := context.Background()
+
+	err := store.Put(ctx, "attachments/abc", strings.NewReader("hello"), 5, "text/plain")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(fake.objects["/chat/attachments/abc"]))
+	assert.Equal(t, "text/plain", fake.types["/chat/attachments/abc"])
+
+	body, err := store.Get(ctx, "attachments/abc")
+	assert.Nil(t, err)
+	data, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "hello", string(data))
+
+	assert.Nil(t, store.Delete(ctx, "attachments/abc"))
+	_, err = store.Get(ctx, "attachments/abc")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestS3StoreBadCredentials(t *testing.T) {
+	store, _ := newTestS3Store(t, "wrong")
+
+	err := store.Put(context.Background(), "attachments/abc", strings.NewReader("hello"), 5, "text/plain")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "403")
+}
+
+func TestS3StoreSignatureIsStable(t *testing.T) {
+	store, err := NewS3Store(config.S3{Endpoint: "http://localhost:9000", Bucket: "chat", Region: "us-east-1", AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	assert.Nil(t, err)
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	req1, _ := store.newRequest(context.Background(), http.MethodGet, "attachments/abc", nil)
+	req2, _ := store.newRequest(context.Background(), http.MethodGet, "attachments/abc", nil)
+	store.sign(req1, now)
+	store.sign(req2, now)
+	assert.Equal(t, "20220102T030405Z", req1.Header.Get("X-Amz-Date"))
+	assert.Equal(t, req1.Header.Get("Authorization"), req2.Header.Get("Authorization"))
+	assert.True(t, strings.HasPrefix(req1.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/20220102/us-east-1/s3/aws4_request"))
+}
@@ -0,0 +1,23 @@
+// Package clock lets background jobs read the time through an interface, so tests can drive them deterministically
+package clock
+
+import "time"
+
+// Clock tells the time and waits
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// System is the Clock of the operating system
+type System struct{}
+
+// Now will return the current local time
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// After will send the current time on the returned channel once d elapsed
+func (System) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
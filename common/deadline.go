@@ -0,0 +1,19 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Deadline will give the context of every request a deadline of timeout,
+// the repository gives up once it passed and the handler answers with ErrorCode
+func Deadline(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -1,33 +1,40 @@
 package common
 
 import (
-	"fmt"
+	"errors"
 	"net/smtp"
-)
+	"net/textproto"
 
-const (
-	fromAddress       = "pranotobudi.app@gmail.com"
-	fromEmailPassword = "CamelCasePasswordBismillah"
-	smtpServer        = "smtp.gmail.com"
-	smtpPort          = "587"
+	"github.com/pranotobudi/myslack-happy-backend/config"
 )
 
-// SendEmail will send email to toAddress with body as its content.
-func SendEmail(toAddress []string, body string) {
-	// Message.
-	//   message := []byte("This is a test email message.")
-	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
-	subject := "Subject: " + "Chat Messages Archive" + "!\n"
-	message := []byte(subject + mime + "\n" + body)
+// ErrMailNotConfigured is returned by the mailer of a config without MAIL_FROM
+var ErrMailNotConfigured = errors.New("mail is not configured, MAIL_FROM is not set")
+
+// Mailer sends an html email, the one of NewSMTPMailer is used by the application
+type Mailer func(toAddress []string, subject string, body string) error
+
+// NewSMTPMailer will return a Mailer sending html emails through the smtp server of mailConfig, from its From address.
+// it returns the error of the smtp server, ErrMailNotConfigured when mailConfig has no From address
+func NewSMTPMailer(mailConfig config.Mail) Mailer {
+	return func(toAddress []string, subject string, body string) error {
+		if mailConfig.From == "" {
+			return ErrMailNotConfigured
+		}
+		mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+		message := []byte("Subject: " + subject + "\n" + mime + "\n" + body)
 
-	// Authentication.
-	auth := smtp.PlainAuth("", fromAddress, fromEmailPassword, smtpServer)
+		auth := smtp.PlainAuth("", mailConfig.From, mailConfig.Password, mailConfig.Host)
+		return smtp.SendMail(mailConfig.Host+":"+mailConfig.Port, auth, mailConfig.From, toAddress, message)
+	}
+}
 
-	// Sending email.
-	err := smtp.SendMail(smtpServer+":"+smtpPort, auth, fromAddress, toAddress, message)
-	if err != nil {
-		fmt.Println(err)
-		return
+// IsPermanentMailError will report whether sending the mail again can not succeed,
+// the mail is not configured or the smtp server rejected it with a 5xx reply
+func IsPermanentMailError(err error) bool {
+	if errors.Is(err, ErrMailNotConfigured) {
+		return true
 	}
-	fmt.Println("Email Sent Successfully!")
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
 }
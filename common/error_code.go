@@ -0,0 +1,26 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+// ErrorCode will map an error of the repository to a http status code, code is returned for any other error.
+// a passed deadline is http.StatusGatewayTimeout
+func ErrorCode(err error, code int) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, mongodb.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, mongodb.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, mongodb.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return code
+	}
+}
@@ -2,37 +2,511 @@ package config
 
 import (
 	"fmt"
-	"os"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Config is the whole configuration of the application. every field has a default, see Default,
+// the yaml tag is its key in the config file and the env tag the environment variable overriding it
+type Config struct {
+	App           AppEnvironment `yaml:"app"`
+	MongoDb       MongoDb        `yaml:"mongodb"`
+	RateLimit     RateLimit      `yaml:"rate_limit"`
+	MessagePolicy MessagePolicy  `yaml:"message_policy"`
+	Upload        Upload         `yaml:"upload"`
+	BlobStore     BlobStore      `yaml:"blob_store"`
+	Unfurl        Unfurl         `yaml:"unfurl"`
+	Room          Room           `yaml:"room"`
+	Scheduler     Scheduler      `yaml:"scheduler"`
+	Timeout       Timeout        `yaml:"timeout"`
+	Mail          Mail           `yaml:"mail"`
+}
+
+// Default will return the config used for every field set neither in the config file nor in the environment
+func Default() Config {
+	return Config{
+		App: AppEnvironment{
+			AppEnv: "development",
+			Port:   "8080",
+		},
+		MongoDb: MongoDb{
+			URI:                    "mongodb://localhost:27017",
+			Name:                   "myslack-db",
+			MaxPoolSize:            100,
+			ConnectTimeout:         10 * time.Second,
+			ServerSelectionTimeout: 10 * time.Second,
+			MigrateOnStart:         true,
+		},
+		RateLimit: RateLimit{
+			HTTPPerSecond:   10,
+			HTTPBurst:       20,
+			UserPerSecond:   5,
+			UserBurst:       10,
+			AuthPerSecond:   1,
+			AuthBurst:       5,
+			WsConnPerSecond: 10,
+			WsConnBurst:     20,
+			WsRoomPerSecond: 5,
+			WsRoomBurst:     10,
+		},
+		MessagePolicy: MessagePolicy{
+			MaxLength:     4000,
+			Trim:          true,
+			StripControl:  true,
+			Normalization: "NFC",
+		},
+		Upload: Upload{
+			MaxBytes:     10 << 20,
+			AllowedTypes: []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"},
+		},
+		BlobStore: BlobStore{
+			Kind: "fs",
+			Dir:  "./uploads",
+			S3:   S3{Region: "us-east-1"},
+		},
+		Unfurl: Unfurl{
+			Enabled:   true,
+			Workers:   4,
+			QueueSize: 256,
+			Timeout:   5 * time.Second,
+			MaxBytes:  1 << 20,
+			MaxLinks:  3,
+			CacheTTL:  24 * time.Hour,
+			UserAgent: "myslack-unfurler/1.0",
+		},
+		Room: Room{
+			MaxPins: 50,
+		},
+		Scheduler: Scheduler{
+			Interval: 5 * time.Second,
+			Lease:    time.Minute,
+			MaxAhead: 365 * 24 * time.Hour,
+		},
+		Timeout: Timeout{
+			Request:   10 * time.Second,
+			Websocket: 10 * time.Second,
+		},
+		Mail: Mail{
+			Host: "smtp.gmail.com",
+			Port: "587",
+		},
+	}
+}
+
+// Validate will list the problems of every section in one *ValidationError, nil when there is none
+func (c Config) Validate() error {
+	var problems []string
+	problems = append(problems, c.App.problems()...)
+	problems = append(problems, c.MongoDb.problems()...)
+	problems = append(problems, c.RateLimit.problems()...)
+	problems = append(problems, c.MessagePolicy.problems()...)
+	problems = append(problems, c.Upload.problems()...)
+	problems = append(problems, c.BlobStore.problems()...)
+	problems = append(problems, c.Unfurl.problems()...)
+	problems = append(problems, c.Room.problems()...)
+	problems = append(problems, c.Scheduler.problems()...)
+	problems = append(problems, c.Timeout.problems()...)
+	problems = append(problems, c.Mail.problems()...)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidationError lists every invalid field of a config, each problem names the environment variable of the field
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// AppEnvironment is where the application runs, Port is the one the http server listens on
+type AppEnvironment struct {
+	AppEnv string `yaml:"app_env" env:"APP_ENV"`
+	Port   string `yaml:"port" env:"PORT"`
+}
+
+func (a AppEnvironment) String() string {
+	return fmt.Sprintf("app env:%v\n port:%v\n", a.AppEnv, a.Port)
+}
+
+func (a AppEnvironment) problems() []string {
+	var problems []string
+	if a.AppEnv == "" {
+		problems = append(problems, "APP_ENV must not be empty")
+	}
+	if port, err := strconv.Atoi(a.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT must be a port number: %q", a.Port))
+	}
+	return problems
+}
+
+// MongoDb is how the mongoDB cluster is reached. the password is kept out of URI, it is set on the user of URI
 type MongoDb struct {
-	Password string
-	Name     string
+	// URI is like mongodb+srv://myslack@cluster.example.net/?retryWrites=true&w=majority
+	URI      string `yaml:"uri" env:"MONGO_URI"`
+	Password string `yaml:"password" env:"MONGO_DB_PASSWORD" secret:"true"`
+	// Name is the database holding every collection
+	Name        string `yaml:"name" env:"MONGO_DB_NAME"`
+	MinPoolSize int    `yaml:"min_pool_size" env:"MONGO_MIN_POOL_SIZE"`
+	// MaxPoolSize is the most connections per server, 0 is unlimited
+	MaxPoolSize            int           `yaml:"max_pool_size" env:"MONGO_MAX_POOL_SIZE"`
+	ConnectTimeout         time.Duration `yaml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout" env:"MONGO_SERVER_SELECTION_TIMEOUT"`
+	// TLSCAFile is a PEM file of the certificate authorities to trust instead of the system ones,
+	// TLSCertificateKeyFile a PEM file with the client certificate and its private key
+	TLS                   bool   `yaml:"tls" env:"MONGO_TLS"`
+	TLSCAFile             string `yaml:"tls_ca_file" env:"MONGO_TLS_CA_FILE"`
+	TLSCertificateKeyFile string `yaml:"tls_certificate_key_file" env:"MONGO_TLS_CERTIFICATE_KEY_FILE"`
+	TLSInsecure           bool   `yaml:"tls_insecure" env:"MONGO_TLS_INSECURE"`
+	// MigrateOnStart applies the pending migrations when the server starts, otherwise they are run with the migrate command
+	MigrateOnStart bool `yaml:"migrate_on_start" env:"MONGO_MIGRATE_ON_START"`
 }
 
+// String will describe the config without its secrets, the password is never shown and the URI is redacted
 func (m MongoDb) String() string {
-	return fmt.Sprintf("name:%v\n", m.Name)
+	password := ""
+	if m.Password != "" {
+		password = redacted
+	}
+	return fmt.Sprintf("uri:%v\n password:%v\n name:%v\n pool size:%v-%v\n connect timeout:%v\n server selection timeout:%v\n tls:%v\n tls ca file:%v\n tls certificate key file:%v\n tls insecure:%v\n migrate on start:%v\n",
+		RedactURI(m.URI), password, m.Name, m.MinPoolSize, m.MaxPoolSize, m.ConnectTimeout, m.ServerSelectionTimeout, m.TLS, m.TLSCAFile, m.TLSCertificateKeyFile, m.TLSInsecure, m.MigrateOnStart)
 }
 
-func MongoDbConfig() MongoDb {
-	dbConfig := MongoDb{
-		Password: os.Getenv("MONGO_DB_PASSWORD"),
-		Name:     os.Getenv("MONGO_DB_NAME"),
+// Validate will list every problem of the config in one error, nil when there is none
+func (m MongoDb) Validate() error {
+	if problems := m.problems(); len(problems) > 0 {
+		return fmt.Errorf("invalid mongoDB config: %v", strings.Join(problems, "; "))
 	}
+	return nil
+}
 
-	return dbConfig
+func (m MongoDb) problems() []string {
+	var problems []string
+	if !strings.HasPrefix(m.URI, "mongodb://") && !strings.HasPrefix(m.URI, "mongodb+srv://") {
+		problems = append(problems, "MONGO_URI must start with mongodb:// or mongodb+srv://")
+	}
+	if m.Password != "" && uriUserInfo(m.URI) == "" {
+		problems = append(problems, "MONGO_DB_PASSWORD is set but MONGO_URI has no user")
+	}
+	if strings.Contains(uriUserInfo(m.URI), ":") {
+		problems = append(problems, "MONGO_URI must not contain a password, set MONGO_DB_PASSWORD instead")
+	}
+	if m.Name == "" || strings.ContainsAny(m.Name, "/\\. \"$") {
+		problems = append(problems, fmt.Sprintf("MONGO_DB_NAME is not a valid database name: %q", m.Name))
+	}
+	if m.MinPoolSize < 0 || m.MaxPoolSize < 0 {
+		problems = append(problems, "MONGO_MIN_POOL_SIZE and MONGO_MAX_POOL_SIZE must not be negative")
+	}
+	if m.MaxPoolSize > 0 && m.MinPoolSize > m.MaxPoolSize {
+		problems = append(problems, "MONGO_MIN_POOL_SIZE must not be more than MONGO_MAX_POOL_SIZE")
+	}
+	if m.ConnectTimeout <= 0 || m.ServerSelectionTimeout <= 0 {
+		problems = append(problems, "MONGO_CONNECT_TIMEOUT and MONGO_SERVER_SELECTION_TIMEOUT must be positive")
+	}
+	if !m.TLS && (m.TLSCAFile != "" || m.TLSCertificateKeyFile != "" || m.TLSInsecure) {
+		problems = append(problems, "MONGO_TLS_CA_FILE, MONGO_TLS_CERTIFICATE_KEY_FILE and MONGO_TLS_INSECURE need MONGO_TLS")
+	}
+	return problems
 }
 
-type AppEnvironment struct {
-	AppEnv string
-	Port   string
+// RedactURI will hide the password and the options of a connection string, the options may hold secrets too
+func RedactURI(uri string) string {
+	if i := strings.Index(uri, "?"); i >= 0 {
+		uri = uri[:i] + "?" + redacted
+	}
+	userInfo := uriUserInfo(uri)
+	if i := strings.Index(userInfo, ":"); i >= 0 {
+		uri = strings.Replace(uri, userInfo+"@", userInfo[:i]+":"+redacted+"@", 1)
+	}
+	return uri
+}
+
+// uriUserInfo will return the user:password part of a connection string, empty when it has none
+func uriUserInfo(uri string) string {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return ""
+	}
+	hosts := uri[i+len("://"):]
+	if end := strings.IndexAny(hosts, "/?"); end >= 0 {
+		hosts = hosts[:end]
+	}
+	at := strings.LastIndex(hosts, "@")
+	if at < 0 {
+		return ""
+	}
+	return hosts[:at]
+}
+
+// RateLimit holds token bucket limits: requests (or frames) per second and burst size
+type RateLimit struct {
+	HTTPPerSecond float64 `yaml:"http_per_second" env:"RATE_LIMIT_HTTP_PER_SECOND"`
+	HTTPBurst     int     `yaml:"http_burst" env:"RATE_LIMIT_HTTP_BURST"`
+	// requests of one user_id, on top of the limit of the client ip
+	UserPerSecond float64 `yaml:"user_per_second" env:"RATE_LIMIT_USER_PER_SECOND"`
+	UserBurst     int     `yaml:"user_burst" env:"RATE_LIMIT_USER_BURST"`
+	// stricter limit for /userAuth
+	AuthPerSecond float64 `yaml:"auth_per_second" env:"RATE_LIMIT_AUTH_PER_SECOND"`
+	AuthBurst     int     `yaml:"auth_burst" env:"RATE_LIMIT_AUTH_BURST"`
+	// websocket frames, per connection and per user in a room
+	WsConnPerSecond float64 `yaml:"ws_conn_per_second" env:"RATE_LIMIT_WS_CONN_PER_SECOND"`
+	WsConnBurst     int     `yaml:"ws_conn_burst" env:"RATE_LIMIT_WS_CONN_BURST"`
+	WsRoomPerSecond float64 `yaml:"ws_room_per_second" env:"RATE_LIMIT_WS_ROOM_PER_SECOND"`
+	WsRoomBurst     int     `yaml:"ws_room_burst" env:"RATE_LIMIT_WS_ROOM_BURST"`
+	// close the socket after this many limited frames in a row, 0 never closes
+	WsDisconnectAfter int `yaml:"ws_disconnect_after" env:"RATE_LIMIT_WS_DISCONNECT_AFTER"`
+	// TrustedProxies are the addresses or CIDR ranges of the proxies in front of the server, e.g. the ingress.
+	// the client ip of their requests is read from X-Forwarded-For or X-Real-IP, other requests can not set it
+	TrustedProxies []string `yaml:"trusted_proxies" env:"RATE_LIMIT_TRUSTED_PROXIES"`
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("http:%v/%v\n user:%v/%v\n auth:%v/%v\n ws conn:%v/%v\n ws room:%v/%v\n ws disconnect after:%v\n trusted proxies:%v\n",
+		r.HTTPPerSecond, r.HTTPBurst, r.UserPerSecond, r.UserBurst, r.AuthPerSecond, r.AuthBurst, r.WsConnPerSecond, r.WsConnBurst,
+		r.WsRoomPerSecond, r.WsRoomBurst, r.WsDisconnectAfter, strings.Join(r.TrustedProxies, ","))
+}
+
+func (r RateLimit) problems() []string {
+	var problems []string
+	if r.HTTPPerSecond <= 0 || r.UserPerSecond <= 0 || r.AuthPerSecond <= 0 || r.WsConnPerSecond <= 0 || r.WsRoomPerSecond <= 0 {
+		problems = append(problems, "RATE_LIMIT_*_PER_SECOND must be positive")
+	}
+	if r.HTTPBurst <= 0 || r.UserBurst <= 0 || r.AuthBurst <= 0 || r.WsConnBurst <= 0 || r.WsRoomBurst <= 0 {
+		problems = append(problems, "RATE_LIMIT_*_BURST must be positive")
+	}
+	if r.WsDisconnectAfter < 0 {
+		problems = append(problems, "RATE_LIMIT_WS_DISCONNECT_AFTER must not be negative")
+	}
+	for _, proxy := range r.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("RATE_LIMIT_TRUSTED_PROXIES must list ip addresses or CIDR ranges: %q", proxy))
+		}
+	}
+	return problems
+}
+
+// MessagePolicy is how chat messages are validated and cleaned before they are stored
+type MessagePolicy struct {
+	// MaxLength is counted in characters (runes), after cleaning
+	MaxLength    int  `yaml:"max_length" env:"MESSAGE_MAX_LENGTH"`
+	Trim         bool `yaml:"trim" env:"MESSAGE_TRIM"`
+	AllowEmpty   bool `yaml:"allow_empty" env:"MESSAGE_ALLOW_EMPTY"`
+	StripControl bool `yaml:"strip_control" env:"MESSAGE_STRIP_CONTROL"`
+	// Normalization is the unicode normalization form: NFC, NFKC or none
+	Normalization string `yaml:"normalization" env:"MESSAGE_NORMALIZATION"`
+}
+
+func (m MessagePolicy) String() string {
+	return fmt.Sprintf("max length:%v\n trim:%v\n allow empty:%v\n strip control:%v\n normalization:%v\n",
+		m.MaxLength, m.Trim, m.AllowEmpty, m.StripControl, m.Normalization)
+}
+
+func (m MessagePolicy) problems() []string {
+	var problems []string
+	if m.MaxLength <= 0 {
+		problems = append(problems, "MESSAGE_MAX_LENGTH must be positive")
+	}
+	switch strings.ToUpper(m.Normalization) {
+	case "NFC", "NFKC", "NONE":
+	default:
+		problems = append(problems, fmt.Sprintf("MESSAGE_NORMALIZATION must be NFC, NFKC or none: %q", m.Normalization))
+	}
+	return problems
 }
 
-func AppConfig() AppEnvironment {
-	appConfig := AppEnvironment{
-		AppEnv: os.Getenv("APP_ENV"),
-		Port:   os.Getenv("PORT"),
+// Upload is the limit for files attached to messages
+type Upload struct {
+	MaxBytes int64 `yaml:"max_bytes" env:"UPLOAD_MAX_BYTES"`
+	// AllowedTypes are MIME types as sniffed from the content, the client's Content-Type is not trusted
+	AllowedTypes []string `yaml:"allowed_types" env:"UPLOAD_ALLOWED_TYPES"`
+}
+
+func (u Upload) String() string {
+	return fmt.Sprintf("max bytes:%v\n allowed types:%v\n", u.MaxBytes, strings.Join(u.AllowedTypes, ","))
+}
+
+func (u Upload) problems() []string {
+	var problems []string
+	if u.MaxBytes <= 0 {
+		problems = append(problems, "UPLOAD_MAX_BYTES must be positive")
 	}
+	if len(u.AllowedTypes) == 0 {
+		problems = append(problems, "UPLOAD_ALLOWED_TYPES must not be empty")
+	}
+	return problems
+}
+
+// S3 is an S3-compatible object storage, Endpoint is like https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+type S3 struct {
+	Endpoint        string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	Bucket          string `yaml:"bucket" env:"S3_BUCKET"`
+	Region          string `yaml:"region" env:"S3_REGION"`
+	AccessKeyID     string `yaml:"access_key_id" env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secret_access_key" env:"S3_SECRET_ACCESS_KEY" secret:"true"`
+}
+
+func (s S3) String() string {
+	return fmt.Sprintf("endpoint:%v\n bucket:%v\n region:%v\n", s.Endpoint, s.Bucket, s.Region)
+}
+
+// BlobStore selects where uploaded files are kept, Kind is "fs" or "s3"
+type BlobStore struct {
+	Kind string `yaml:"kind" env:"BLOB_STORE"`
+	Dir  string `yaml:"dir" env:"BLOB_DIR"`
+	S3   S3     `yaml:"s3"`
+}
+
+func (b BlobStore) String() string {
+	return fmt.Sprintf("kind:%v\n dir:%v\n s3:%v", b.Kind, b.Dir, b.S3)
+}
+
+func (b BlobStore) problems() []string {
+	var problems []string
+	switch b.Kind {
+	case "fs":
+		if b.Dir == "" {
+			problems = append(problems, "BLOB_DIR must not be empty")
+		}
+	case "s3":
+		if b.S3.Endpoint == "" || b.S3.Bucket == "" {
+			problems = append(problems, "S3_ENDPOINT and S3_BUCKET must be set for BLOB_STORE s3")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("BLOB_STORE must be fs or s3: %q", b.Kind))
+	}
+	return problems
+}
+
+// Unfurl is how link previews are fetched in the background
+type Unfurl struct {
+	Enabled   bool `yaml:"enabled" env:"UNFURL_ENABLED"`
+	Workers   int  `yaml:"workers" env:"UNFURL_WORKERS"`
+	QueueSize int  `yaml:"queue_size" env:"UNFURL_QUEUE_SIZE"`
+	// Timeout is for the whole fetch of a link, redirects and oEmbed included
+	Timeout  time.Duration `yaml:"timeout" env:"UNFURL_TIMEOUT"`
+	MaxBytes int64         `yaml:"max_bytes" env:"UNFURL_MAX_BYTES"`
+	// MaxLinks is how many links of a message get a preview
+	MaxLinks  int           `yaml:"max_links" env:"UNFURL_MAX_LINKS"`
+	CacheTTL  time.Duration `yaml:"cache_ttl" env:"UNFURL_CACHE_TTL"`
+	UserAgent string        `yaml:"user_agent" env:"UNFURL_USER_AGENT"`
+}
+
+func (u Unfurl) String() string {
+	return fmt.Sprintf("enabled:%v\n workers:%v\n queue size:%v\n timeout:%v\n max bytes:%v\n max links:%v\n cache ttl:%v\n",
+		u.Enabled, u.Workers, u.QueueSize, u.Timeout, u.MaxBytes, u.MaxLinks, u.CacheTTL)
+}
+
+func (u Unfurl) problems() []string {
+	if !u.Enabled {
+		return nil
+	}
+	var problems []string
+	if u.Workers <= 0 || u.QueueSize <= 0 || u.MaxLinks <= 0 {
+		problems = append(problems, "UNFURL_WORKERS, UNFURL_QUEUE_SIZE and UNFURL_MAX_LINKS must be positive")
+	}
+	if u.Timeout <= 0 || u.MaxBytes <= 0 {
+		problems = append(problems, "UNFURL_TIMEOUT and UNFURL_MAX_BYTES must be positive")
+	}
+	if u.CacheTTL < 0 {
+		problems = append(problems, "UNFURL_CACHE_TTL must not be negative")
+	}
+	return problems
+}
+
+// Room holds the limits of a chat room
+type Room struct {
+	MaxPins int `yaml:"max_pins" env:"ROOM_MAX_PINS"`
+}
 
-	return appConfig
+func (r Room) String() string {
+	return fmt.Sprintf("max pins:%v\n", r.MaxPins)
+}
+
+func (r Room) problems() []string {
+	if r.MaxPins <= 0 {
+		return []string{"ROOM_MAX_PINS must be positive"}
+	}
+	return nil
+}
+
+// Scheduler is how scheduled messages and reminders are handled once they are due
+type Scheduler struct {
+	// Interval is how often due messages are looked up
+	Interval time.Duration `yaml:"interval" env:"SCHEDULER_INTERVAL"`
+	// Lease is how long a message being posted is held by a scheduler before another one may retry it
+	Lease time.Duration `yaml:"lease" env:"SCHEDULER_LEASE"`
+	// MaxAhead is how far in the future a message can be scheduled or a reminder set
+	MaxAhead time.Duration `yaml:"max_ahead" env:"SCHEDULER_MAX_AHEAD"`
+}
+
+func (s Scheduler) String() string {
+	return fmt.Sprintf("interval:%v\n lease:%v\n max ahead:%v\n", s.Interval, s.Lease, s.MaxAhead)
+}
+
+func (s Scheduler) problems() []string {
+	if s.Interval <= 0 || s.Lease <= 0 || s.MaxAhead <= 0 {
+		return []string{"SCHEDULER_INTERVAL, SCHEDULER_LEASE and SCHEDULER_MAX_AHEAD must be positive"}
+	}
+	return nil
+}
+
+// Timeout is how long the database work of a request or of a websocket frame may take
+type Timeout struct {
+	// Request is the deadline of an http request, uploads and the websocket upgrade are not bounded by it
+	Request time.Duration `yaml:"request" env:"TIMEOUT_REQUEST"`
+	// Websocket is the deadline of the database work for one websocket frame
+	Websocket time.Duration `yaml:"websocket" env:"TIMEOUT_WEBSOCKET"`
+}
+
+func (t Timeout) String() string {
+	return fmt.Sprintf("request:%v\n websocket:%v\n", t.Request, t.Websocket)
+}
+
+func (t Timeout) problems() []string {
+	if t.Request <= 0 || t.Websocket <= 0 {
+		return []string{"TIMEOUT_REQUEST and TIMEOUT_WEBSOCKET must be positive"}
+	}
+	return nil
+}
+
+// Mail is the smtp server emails are sent through. From is both the sender and the smtp user,
+// no email can be sent while it is empty
+type Mail struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" env:"SMTP_PORT"`
+	From     string `yaml:"from" env:"MAIL_FROM"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+func (m Mail) String() string {
+	return fmt.Sprintf("host:%v\n port:%v\n from:%v\n", m.Host, m.Port, m.From)
+}
+
+func (m Mail) problems() []string {
+	var problems []string
+	if m.Host == "" {
+		problems = append(problems, "SMTP_HOST must not be empty")
+	}
+	if port, err := strconv.Atoi(m.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("SMTP_PORT must be a port number: %q", m.Port))
+	}
+	if m.From == "" {
+		if m.Password != "" {
+			problems = append(problems, "SMTP_PASSWORD is set without MAIL_FROM")
+		}
+		return problems
+	}
+	if address, err := mail.ParseAddress(m.From); err != nil || address.Address != m.From {
+		problems = append(problems, fmt.Sprintf("MAIL_FROM must be an email address: %q", m.From))
+	}
+	if m.Password == "" {
+		problems = append(problems, "SMTP_PASSWORD must be set with MAIL_FROM")
+	}
+	return problems
 }
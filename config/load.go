@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces a secret wherever the config is shown
+const redacted = "[redacted]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load will read the config: the defaults, overridden by the yaml file at path when path is not empty,
+// overridden by the environment variables. an environment variable set to an empty string counts as unset.
+// every invalid value and field is listed in one *ValidationError, the config is returned along with it
+func Load(path string) (Config, error) {
+	appConfig := Default()
+	if path != "" {
+		if err := loadFile(path, &appConfig); err != nil {
+			return appConfig, err
+		}
+	}
+	problems := loadEnv(reflect.ValueOf(&appConfig).Elem())
+	if err := appConfig.Validate(); err != nil {
+		problems = append(problems, err.(*ValidationError).Problems...)
+	}
+	if len(problems) > 0 {
+		return appConfig, &ValidationError{Problems: problems}
+	}
+	return appConfig, nil
+}
+
+// loadFile will decode the yaml file at path over appConfig, an unknown key is an error so typos are not ignored
+func loadFile(path string, appConfig *Config) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(appConfig); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid config file %v: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv will set every field of section with an env tag from its environment variable, when it is set.
+// it returns a problem for every value which can not be parsed
+func loadEnv(section reflect.Value) []string {
+	var problems []string
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Field(i)
+		tag := section.Type().Field(i).Tag
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			problems = append(problems, loadEnv(field)...)
+			continue
+		}
+		name := tag.Get("env")
+		value := os.Getenv(name)
+		if name == "" || value == "" {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%v is not a valid %v: %q", name, field.Type(), value))
+		}
+	}
+	return problems
+}
+
+// setField will parse value into field by the kind of the field, lists are comma separated
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported config field type: %v", field.Type())
+	}
+	return nil
+}
+
+// Redacted will return a copy of the config safe to show: the fields tagged secret are replaced when set,
+// and the mongoDB URI is redacted
+func (c Config) Redacted() Config {
+	redactSecrets(reflect.ValueOf(&c).Elem())
+	c.MongoDb.URI = RedactURI(c.MongoDb.URI)
+	return c
+}
+
+func redactSecrets(section reflect.Value) {
+	for i := 0; i < section.NumField(); i++ {
+		field := section.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != durationType {
+			redactSecrets(field)
+			continue
+		}
+		if section.Type().Field(i).Tag.Get("secret") == "true" && field.String() != "" {
+			field.SetString(redacted)
+		}
+	}
+}
+
+// YAML will write the config in the format of the config file, secrets are not redacted, see Redacted
+func (c Config) YAML(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
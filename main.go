@@ -1,25 +1,80 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 	"github.com/pranotobudi/myslack-happy-backend/api/emails"
 	"github.com/pranotobudi/myslack-happy-backend/api/messages"
+	"github.com/pranotobudi/myslack-happy-backend/api/pins"
+	"github.com/pranotobudi/myslack-happy-backend/api/polls"
+	"github.com/pranotobudi/myslack-happy-backend/api/reminders"
 	"github.com/pranotobudi/myslack-happy-backend/api/rooms"
+	"github.com/pranotobudi/myslack-happy-backend/api/saved"
+	"github.com/pranotobudi/myslack-happy-backend/api/scheduled"
+	"github.com/pranotobudi/myslack-happy-backend/api/uploads"
 	"github.com/pranotobudi/myslack-happy-backend/api/users"
+	"github.com/pranotobudi/myslack-happy-backend/blobstore"
+	"github.com/pranotobudi/myslack-happy-backend/clock"
+	"github.com/pranotobudi/myslack-happy-backend/common"
 	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
 	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"github.com/pranotobudi/myslack-happy-backend/ratelimit"
+	"github.com/pranotobudi/myslack-happy-backend/unfurl"
 )
 
+// shutdownTimeout is how long in-flight requests and websocket connections get to finish on SIGTERM
+const shutdownTimeout = 15 * time.Second
+
 func main() {
-	StartApp()
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "yaml config file, the environment variables override it")
+	printConfig := flag.Bool("print-config", false, "print the effective config with its secrets redacted, then exit")
+	flag.Parse()
+
+	loadDotEnv()
+	appConfig, err := config.Load(*configFile)
+	if *printConfig {
+		if err := appConfig.Redacted().YAML(os.Stdout); err != nil {
+			log.Fatal("failed to print config: ", err)
+		}
+	}
+	if err != nil {
+		// every problem is listed, so they can all be fixed at once
+		log.Fatal(err)
+	}
+	if *printConfig {
+		return
+	}
+
+	switch command := flag.Arg(0); command {
+	case "":
+		StartApp(appConfig)
+	case "migrate":
+		if err := migrate(appConfig, flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+	case "seed":
+		if err := seedDatabase(appConfig, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown command %q, usage: %v [--config file] [--print-config] [migrate up|down|status | seed [--reset] [--messages n] [fixtures file]]", command, os.Args[0])
+	}
 }
-func StartApp() {
+
+// loadDotEnv will load the .env file into the environment, outside of production
+func loadDotEnv() {
 	if os.Getenv("APP_ENV") != "production" {
 		// executed in development, because we need to load .env variables in local env
 		// in development only,
@@ -33,20 +88,169 @@ func StartApp() {
 		}
 		log.Println("Load development environment variables..")
 	}
+}
 
+// StartApp will run the server with appConfig until SIGINT or SIGTERM
+func StartApp(appConfig config.Config) {
 	// # run router server
 	// gin.SetMode(gin.ReleaseMode)
-	appConfig := config.AppConfig()
-	log.Println("server run on port:8080...")
-	http.ListenAndServe(":"+appConfig.Port, Router())
+	mongodbConn, err := mongodb.NewMongoDB(appConfig.MongoDb)
+	if err != nil {
+		log.Fatal("failed to connect to mongoDB: ", err)
+	}
+	if appConfig.MongoDb.MigrateOnStart {
+		// applied migrations are skipped, so every instance can run them at startup
+		if _, err := mongodbConn.Migrator().Up(context.Background()); err != nil {
+			log.Fatal("failed to migrate mongoDB: ", err)
+		}
+	}
+
+	// #1 init global message server as goroutine, shared by every websocket client
+	hub := msgserver.NewHub()
+	go hub.Run()
 
+	// link previews are fetched in the background, then pushed to the room through the hub
+	var unfurler *unfurl.Unfurler
+	var wsUnfurler msgserver.Unfurler
+	if appConfig.Unfurl.Enabled {
+		unfurler = unfurl.NewUnfurler(mongodbConn, hub, appConfig.Unfurl)
+		wsUnfurler = unfurler
+		go unfurler.Run()
+	}
+
+	app, err := NewApp(appConfig, mongodbConn, hub, common.NewSMTPMailer(appConfig.Mail), wsUnfurler)
+	if err != nil {
+		log.Fatal("invalid config: ", err)
+	}
+
+	// scheduled messages are posted like websocket messages, through the hub
+	scheduler := msgserver.NewScheduler(hub, mongodbConn, mongodbConn, app.Policy, wsUnfurler, clock.System{}, appConfig.Scheduler)
+	go scheduler.Run()
+	reminderScheduler := reminders.NewScheduler(mongodbConn, mongodbConn, mongodbConn, hub, app.Mailer, clock.System{}, appConfig.Scheduler)
+	go reminderScheduler.Run()
+
+	server := &http.Server{
+		Addr:    ":" + appConfig.App.Port,
+		Handler: Router(app),
+	}
+	go func() {
+		log.Println("server run on port:" + appConfig.App.Port + "...")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("server failed: ", err)
+		}
+	}()
+
+	// wait for SIGINT (ctrl+c) or SIGTERM (kubernetes, heroku) before draining
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	log.Println("shutdown signal received, draining connections..")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	// stop accepting new requests and wait for in-flight http requests
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("server shutdown failed: ", err)
+	}
+	// the schedulers and the unfurler broadcast through the hub, they stop first so
+	// a reminder is not emailed to a user whose connections are being closed
+	if err := scheduler.Shutdown(shutdownCtx); err != nil {
+		log.Println("scheduler shutdown failed: ", err)
+	}
+	if err := reminderScheduler.Shutdown(shutdownCtx); err != nil {
+		log.Println("reminder scheduler shutdown failed: ", err)
+	}
+	if unfurler != nil {
+		if err := unfurler.Shutdown(shutdownCtx); err != nil {
+			log.Println("unfurler shutdown failed: ", err)
+		}
+	}
+	// websocket connections are hijacked, so the hub says goodbye to them itself
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Println("hub shutdown failed: ", err)
+	}
+	if err := mongodbConn.Disconnect(shutdownCtx); err != nil {
+		log.Println("mongoDB disconnect failed: ", err)
+	}
+	log.Println("server stopped")
 }
-func Router() *chi.Mux {
-	// handler
-	messageHandler := messages.NewMessageHandler()
-	roomHandler := rooms.NewRoomHandler()
-	userHandler := users.NewUserHandler()
-	emailHandler := emails.NewEmailHandler()
+
+// App owns what the server is made of: its config, the repository, the hub, the mailer and the http handlers.
+// StartApp builds it on mongoDB and smtp, tests can build it on fakes
+type App struct {
+	Config   config.Config
+	Repo     mongodb.Repository
+	Hub      *msgserver.Hub
+	Mailer   common.Mailer
+	Unfurler msgserver.Unfurler
+	// Policy checks every message posted, through the websocket, a poll or the scheduler
+	Policy *msgpolicy.Policy
+
+	homeHandler      http.HandlerFunc
+	messageHandler   messages.IMessageHandler
+	roomHandler      rooms.IRoomHandler
+	userHandler      users.IUserHandler
+	emailHandler     emails.IEmailHandler
+	uploadHandler    uploads.IUploadHandler
+	pinHandler       pins.IPinHandler
+	savedHandler     saved.ISavedHandler
+	scheduledHandler scheduled.IScheduledHandler
+	reminderHandler  reminders.IReminderHandler
+	pollHandler      polls.IPollHandler
+	wsHandler        msgserver.IWsHandler
+	// rateLimitKeys key the rate limits of the http routes by client ip and user
+	rateLimitKeys *ratelimit.Keys
+}
+
+// NewApp will build the handlers of App on repo, websocket clients are served by hub and emails sent with mailer.
+// unfurler may be nil, messages get no link previews then
+func NewApp(appConfig config.Config, repo mongodb.Repository, hub *msgserver.Hub, mailer common.Mailer, unfurler msgserver.Unfurler) (*App, error) {
+	policy, err := msgpolicy.New(appConfig.MessagePolicy)
+	if err != nil {
+		return nil, err
+	}
+	// uploaded files are kept apart from mongoDB, only their metadata is in repo
+	store, err := blobstore.New(appConfig.BlobStore)
+	if err != nil {
+		return nil, err
+	}
+	rateLimitKeys, err := ratelimit.NewKeys(appConfig.RateLimit.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	app := &App{
+		Config:   appConfig,
+		Repo:     repo,
+		Hub:      hub,
+		Mailer:   mailer,
+		Unfurler: unfurler,
+		Policy:   policy,
+
+		rateLimitKeys: rateLimitKeys,
+	}
+	app.homeHandler = users.HelloWorld(rooms.NewRoomService(repo))
+	app.messageHandler = messages.NewMessageHandler(repo)
+	app.roomHandler = rooms.NewRoomHandler(repo)
+	app.userHandler = users.NewUserHandler(repo)
+	app.emailHandler = emails.NewEmailHandler(repo, repo, mailer)
+	app.uploadHandler = uploads.NewUploadHandler(repo, repo, store, appConfig.Upload)
+	app.pinHandler = pins.NewPinHandler(repo, repo, repo, hub, appConfig.Room)
+	app.savedHandler = saved.NewSavedHandler(repo, repo, repo, repo)
+	app.scheduledHandler = scheduled.NewScheduledHandler(repo, repo, policy, appConfig.Scheduler)
+	app.reminderHandler = reminders.NewReminderHandler(repo, repo, repo, appConfig.Scheduler)
+	// the message announcing a poll is posted like a websocket message
+	app.pollHandler = polls.NewPollHandler(repo, repo, msgserver.NewPoster(hub, repo, policy, unfurler), hub)
+	app.wsHandler = msgserver.NewWsHandler(hub, repo, policy, unfurler, appConfig.RateLimit, appConfig.Timeout)
+	return app, nil
+}
+
+// Router will build the http routes on the handlers of app
+func Router(app *App) *chi.Mux {
+	// rate limit per client ip and per user, /userAuth has its own stricter limit
+	rateLimit := app.Config.RateLimit
+	httpLimiter := ratelimit.NewLimiter(rateLimit.HTTPPerSecond, rateLimit.HTTPBurst)
+	userLimiter := ratelimit.NewLimiter(rateLimit.UserPerSecond, rateLimit.UserBurst)
+	authLimiter := ratelimit.NewLimiter(rateLimit.AuthPerSecond, rateLimit.AuthBurst)
 	// #2 init chi routing server
 	router := chi.NewRouter()
 	// router := gin.Default()
@@ -60,18 +264,42 @@ func Router() *chi.Mux {
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
+	router.Use(httpLimiter.Middleware(app.rateLimitKeys.ClientIP))
+	router.Use(userLimiter.Middleware(app.rateLimitKeys.User))
 	// #3 handle url to init websocket client connection (will have func to handle incoming url)
 	// this client will notify subscribe event to the global message server through channel.
-	router.Get("/", users.HelloWorld)
-	router.Get("/rooms", roomHandler.GetRooms)
-	router.Post("/room", roomHandler.AddRoom)
-	router.Get("/room", roomHandler.GetAnyRoom)
-	router.Get("/messages", messageHandler.GetMessages)
-	router.Get("/userByEmail", userHandler.GetUserByEmail)
-	router.Post("/userAuth", userHandler.UserAuth)
-	router.Post("/mailChat", emailHandler.MailChat)
-	router.Put("/updateUserRooms", userHandler.UpdateUserRooms)
-	router.Get("/websocket", msgserver.InitWebsocket)
+	router.Get("/websocket", app.wsHandler.InitWebsocket)
+	// file transfers take as long as the client's bandwidth, they only end when the client goes away
+	router.Post("/uploads", app.uploadHandler.Upload)
+	router.Get("/files/{id}", app.uploadHandler.Download)
+	router.Group(func(router chi.Router) {
+		// the database work of every other request is bounded, a slow cluster answers 504
+		router.Use(common.Deadline(app.Config.Timeout.Request))
+		router.Get("/", app.homeHandler)
+		router.Get("/rooms", app.roomHandler.GetRooms)
+		router.Post("/room", app.roomHandler.AddRoom)
+		router.Get("/room", app.roomHandler.GetAnyRoom)
+		router.Get("/messages", app.messageHandler.GetMessages)
+		router.Get("/userByEmail", app.userHandler.GetUserByEmail)
+		router.With(authLimiter.Middleware(app.rateLimitKeys.ClientIP)).Post("/userAuth", app.userHandler.UserAuth)
+		router.Post("/mailChat", app.emailHandler.MailChat)
+		router.Put("/updateUserRooms", app.userHandler.UpdateUserRooms)
+		router.Get("/rooms/{id}/pins", app.pinHandler.GetPins)
+		router.Post("/rooms/{id}/pins/{messageId}", app.pinHandler.AddPin)
+		router.Delete("/rooms/{id}/pins/{messageId}", app.pinHandler.RemovePin)
+		router.Get("/me/saved", app.savedHandler.GetSaved)
+		router.Post("/me/saved/{messageId}", app.savedHandler.Save)
+		router.Delete("/me/saved/{messageId}", app.savedHandler.Unsave)
+		router.Post("/scheduled", app.scheduledHandler.Schedule)
+		router.Get("/scheduled", app.scheduledHandler.GetScheduled)
+		router.Delete("/scheduled/{id}", app.scheduledHandler.Cancel)
+		router.Get("/me/reminders", app.reminderHandler.GetReminders)
+		router.Post("/messages/{messageId}/reminder", app.reminderHandler.SetReminder)
+		router.Delete("/messages/{messageId}/reminder", app.reminderHandler.DeleteReminder)
+		router.Post("/rooms/{id}/polls", app.pollHandler.CreatePoll)
+		router.Get("/polls/{id}", app.pollHandler.GetPoll)
+		router.Post("/polls/{id}/votes", app.pollHandler.Vote)
+	})
 
 	return router
 }
@@ -1,41 +1,96 @@
 package main_test
 
 import (
+	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	main "github.com/pranotobudi/myslack-happy-backend"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
+// sentEmail is what the fake mailer of newTestApp was asked to send
+type sentEmail struct {
+	ToAddress []string
+	Subject   string
+	Body      string
+}
+
+// newTestApp will build the app on an in-memory repository holding one room with one message,
+// ocean@example.com is a member of the room. emails are recorded instead of sent
+func newTestApp(t *testing.T) (*main.App, *[]sentEmail) {
+	ctx := context.Background()
+	repo := memdb.New()
+	roomIds, err := repo.AddRooms(ctx, []interface{}{bson.D{{Key: "name", Value: "general"}}})
+	assert.Nil(t, err)
+	roomId := roomIds[0]
+	_, err = repo.AddUser(ctx, bson.M{"email": "ocean@example.com", "username": "ocean", "rooms": bson.A{roomId}})
+	assert.Nil(t, err)
+	_, err = repo.AddMessage(ctx, bson.D{{Key: "message", Value: "hello"}, {Key: "room_id", Value: roomId}, {Key: "username", Value: "ocean"}})
+	assert.Nil(t, err)
+
+	var sent []sentEmail
+	mailer := func(toAddress []string, subject string, body string) error {
+		sent = append(sent, sentEmail{ToAddress: toAddress, Subject: subject, Body: body})
+		return nil
+	}
+	app, err := main.NewApp(config.Default(), repo, msgserver.NewHub(), mailer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, &sent
+}
+
 // TestRouting will test each end point is active
 func TestRouting(t *testing.T) {
 	tt := []struct {
 		Name   string
 		Path   string
 		Method string
+		Body   []byte
 		Status int
 	}{
-		{"Get home", "/", http.MethodGet, http.StatusOK},
-		{"Get rooms", "/rooms", http.MethodGet, http.StatusOK},
-		// {"Get room", "/room", http.MethodGet, http.StatusOK},
-		// {"Post room", "/room", http.MethodPost, http.StatusOK},
-		// {"Get messages", "/messages", http.MethodGet, http.StatusOK},
-		// {"Get userByemail", "/userByEmail", http.MethodGet, http.StatusOK},
-		// {"Post userAuth", "/userAuth", http.MethodPost, http.StatusOK},
-		// {"Put updateUserRooms", "/updateUserRooms", http.MethodPut, http.StatusOK},
+		{"Get home", "/", http.MethodGet, nil, http.StatusOK},
+		{"Get rooms", "/rooms", http.MethodGet, nil, http.StatusOK},
+		{"Get userByemail", "/userByEmail?email=ocean@example.com", http.MethodGet, nil, http.StatusOK},
+		{"Get userByemail not found", "/userByEmail?email=nobody@example.com", http.MethodGet, nil, http.StatusNotFound},
+		{"Post userAuth", "/userAuth", http.MethodPost, []byte(`{"email":"ocean@example.com"}`), http.StatusOK},
+		{"Post userAuth new user", "/userAuth", http.MethodPost, []byte(`{"email":"new@example.com"}`), http.StatusCreated},
+		{"Get pins not a room member", "/rooms/61cc50877ea033031b1a950e/pins", http.MethodGet, nil, http.StatusForbidden},
+		{"Get unknown path", "/unknown", http.MethodGet, nil, http.StatusNotFound},
 		// {"Get websocket", "/websocket", http.MethodGet, http.StatusOK},
 	}
 	for _, tc := range tt {
 		t.Run(tc.Name, func(t *testing.T) {
-			req := httptest.NewRequest(tc.Method, tc.Path, nil)
+			app, _ := newTestApp(t)
+			req := httptest.NewRequest(tc.Method, tc.Path, bytes.NewBuffer(tc.Body))
 			w := httptest.NewRecorder()
 
-			router := main.Router()
+			router := main.Router(app)
 			router.ServeHTTP(w, req)
 
-			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.Status, w.Code)
 		})
 	}
 }
+
+// TestMailChat will test the chat of the user is sent with the mailer of the app
+func TestMailChat(t *testing.T) {
+	app, sent := newTestApp(t)
+	req := httptest.NewRequest(http.MethodPost, "/mailChat", bytes.NewBufferString(`{"email":"ocean@example.com"}`))
+	w := httptest.NewRecorder()
+
+	main.Router(app).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Len(t, *sent, 1) {
+		assert.Equal(t, []string{"ocean@example.com"}, (*sent)[0].ToAddress)
+		assert.Contains(t, (*sent)[0].Body, "hello")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+// migrate will run the migrate command: up applies the pending migrations,
+// down reverts the latest applied one and status lists them all
+func migrate(appConfig config.Config, action string) error {
+	if action != "up" && action != "down" && action != "status" {
+		return fmt.Errorf("unknown migrate action %q, the actions are up, down and status", action)
+	}
+	mongodbConn, err := mongodb.NewMongoDB(appConfig.MongoDb)
+	if err != nil {
+		return fmt.Errorf("failed to connect to mongoDB: %v", err)
+	}
+	// an index build can take long, it is only stopped by ctrl+c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer func() {
+		if err := mongodbConn.Disconnect(context.Background()); err != nil {
+			log.Println("mongoDB disconnect failed: ", err)
+		}
+	}()
+
+	migrator := mongodbConn.Migrator()
+	switch action {
+	case "up":
+		versions, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(versions) == 0 {
+			fmt.Println("database is up to date")
+			return nil
+		}
+		fmt.Println("applied migrations:", versions)
+	case "down":
+		version, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println("reverted migration:", version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			fmt.Println(status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// kinds of the errors returned by MongoDB, check them with errors.Is.
+// a context error of the caller is returned as is, so it is still told apart by errors.Is
+var (
+	// ErrNotFound is returned when no document matches
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write conflicts with a stored document
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable is returned when the database can not be reached
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// ErrNotMember is returned by RoomMember when the user does not exist or is not a member of the room,
+// every service checking room membership returns it so the handlers answer 403 alike
+var ErrNotMember = errors.New("user is not a member of the room")
+
+// ErrDuplicateMessage is returned by AddMessage when the user already sent a message with the same client_msg_id
+var ErrDuplicateMessage = newError(ErrConflict, "message already exists")
+
+// ErrAttachmentNotFound is returned by GetAttachment when no attachment matches the filter
+var ErrAttachmentNotFound = newError(ErrNotFound, "attachment not found")
+
+// errors of AddPin, RemovePin and GetPins
+var (
+	ErrRoomNotFound = newError(ErrNotFound, "room not found")
+	ErrPinExists    = newError(ErrConflict, "message is already pinned")
+	ErrPinLimit     = newError(ErrConflict, "room has too many pinned messages")
+	ErrPinNotFound  = newError(ErrNotFound, "message is not pinned")
+)
+
+// errors of AddSavedItem and RemoveSavedItem
+var (
+	ErrSavedItemExists   = newError(ErrConflict, "message is already saved")
+	ErrSavedItemNotFound = newError(ErrNotFound, "message is not saved")
+)
+
+// ErrScheduledMessageNotFound is returned when no scheduled message matches, or none is due for ClaimScheduledMessage
+var ErrScheduledMessageNotFound = newError(ErrNotFound, "scheduled message not found")
+
+// ErrReminderNotFound is returned when no reminder matches, or none is due for ClaimReminder
+var ErrReminderNotFound = newError(ErrNotFound, "reminder not found")
+
+// ErrPollNotFound is returned by GetPoll, DeletePoll and SetPollMessage when the poll does not exist
+var ErrPollNotFound = newError(ErrNotFound, "poll not found")
+
+// ErrLinkPreviewNotFound is returned by GetLinkPreview when the url is not cached
+var ErrLinkPreviewNotFound = newError(ErrNotFound, "link preview not found")
+
+// kindError is a specific error of one of the kinds, it keeps its own message
+type kindError struct {
+	msg  string
+	kind error
+}
+
+// newError will return an error with msg which errors.Is kind
+func newError(kind error, msg string) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// wrapError will map an error of the driver to the kind it belongs to, keeping the driver error in the message.
+// errors of no known kind are returned unchanged
+func wrapError(err error) error {
+	var selectionErr topology.ServerSelectionError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	case mongo.IsDuplicateKeyError(err):
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	case errors.Is(err, mongo.ErrClientDisconnected), errors.As(err, &selectionErr),
+		mongo.IsNetworkError(err), mongo.IsTimeout(err):
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
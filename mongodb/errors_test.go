@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestWrapError(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Err      error
+		KindWant error
+	}{
+		{
+			Name:     "no document",
+			Err:      mongo.ErrNoDocuments,
+			KindWant: ErrNotFound,
+		},
+		{
+			Name:     "duplicate key",
+			Err:      mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "E11000 duplicate key error"}}},
+			KindWant: ErrConflict,
+		},
+		{
+			Name:     "server selection",
+			Err:      topology.ServerSelectionError{Wrapped: errors.New("no such host")},
+			KindWant: ErrUnavailable,
+		},
+		{
+			Name:     "client disconnected",
+			Err:      mongo.ErrClientDisconnected,
+			KindWant: ErrUnavailable,
+		},
+		{
+			Name:     "deadline of the caller",
+			Err:      topology.ServerSelectionError{Wrapped: context.DeadlineExceeded},
+			KindWant: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := wrapError(tc.Err)
+			assert.True(t, errors.Is(err, tc.KindWant), "%v is not %v", err, tc.KindWant)
+			assert.Contains(t, err.Error(), tc.Err.Error())
+		})
+	}
+
+	assert.Nil(t, wrapError(nil))
+	other := errors.New("invalid filter")
+	assert.Equal(t, other, wrapError(other))
+}
+
+func TestErrorKinds(t *testing.T) {
+	for _, err := range []error{ErrRoomNotFound, ErrAttachmentNotFound, ErrPinNotFound, ErrSavedItemNotFound,
+		ErrScheduledMessageNotFound, ErrReminderNotFound, ErrPollNotFound, ErrLinkPreviewNotFound} {
+		assert.True(t, errors.Is(err, ErrNotFound), err.Error())
+		assert.False(t, errors.Is(err, ErrConflict), err.Error())
+	}
+	for _, err := range []error{ErrDuplicateMessage, ErrPinExists, ErrPinLimit, ErrSavedItemExists} {
+		assert.True(t, errors.Is(err, ErrConflict), err.Error())
+	}
+	assert.Equal(t, "room has too many pinned messages", ErrPinLimit.Error())
+	assert.True(t, errors.Is(fmt.Errorf("get pins: %w", ErrRoomNotFound), ErrNotFound))
+}
@@ -0,0 +1,31 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RoomMember will get the user with userId from users, it returns ErrNotMember unless the user is a member of roomId.
+// an invalid or unknown userId is not a member either
+func RoomMember(ctx context.Context, users UserRepository, userId string, roomId string) (*User, error) {
+	objID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrNotMember
+	}
+	user, err := users.GetUser(ctx, bson.M{"_id": objID})
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range user.Rooms {
+		if room == roomId {
+			return user, nil
+		}
+	}
+	return nil, ErrNotMember
+}
@@ -0,0 +1,49 @@
+package mongodb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRoomMember(t *testing.T) {
+	ctx := context.Background()
+	db := memdb.New()
+	userIds, err := db.AddUsers(ctx, []interface{}{bson.M{"email": "ocean@example.com", "rooms": bson.A{"room1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userId := userIds[0]
+
+	tt := []struct {
+		Name    string
+		UserID  string
+		RoomID  string
+		ErrWant error
+	}{
+		{Name: "Member", UserID: userId, RoomID: "room1"},
+		{Name: "Not a member", UserID: userId, RoomID: "room2", ErrWant: mongodb.ErrNotMember},
+		{Name: "Unknown user", UserID: primitive.NewObjectID().Hex(), RoomID: "room1", ErrWant: mongodb.ErrNotMember},
+		{Name: "Invalid user id", UserID: "ocean", RoomID: "room1", ErrWant: mongodb.ErrNotMember},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			user, err := mongodb.RoomMember(ctx, db, tc.UserID, tc.RoomID)
+
+			if tc.ErrWant != nil {
+				assert.True(t, errors.Is(err, tc.ErrWant))
+				assert.Nil(t, user)
+				return
+			}
+			if assert.Nil(t, err) {
+				assert.Equal(t, "ocean@example.com", user.Email)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddSavedItem will save a message for a user, mongodb.ErrSavedItemExists when the user already saved it
+func (db *DB) AddSavedItem(ctx context.Context, item mongodb.SavedItem) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, saved := range db.saved {
+		if saved.UserID == item.UserID && saved.MessageID == item.MessageID {
+			return "", mongodb.ErrSavedItemExists
+		}
+	}
+	item.ID = primitive.NewObjectID().Hex()
+	db.saved = append(db.saved, item)
+	return item.ID, nil
+}
+
+// RemoveSavedItem will forget a message saved by the user
+func (db *DB) RemoveSavedItem(ctx context.Context, userId string, messageId string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, saved := range db.saved {
+		if saved.UserID == userId && saved.MessageID == messageId {
+			db.saved = append(db.saved[:i:i], db.saved[i+1:]...)
+			return nil
+		}
+	}
+	return mongodb.ErrSavedItemNotFound
+}
+
+// GetSavedItems will get at most limit items saved by the user, the newest first.
+// before is the id of the last item of the previous page, empty for the first page
+func (db *DB) GetSavedItems(ctx context.Context, userId string, before string, limit int) ([]mongodb.SavedItem, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	if before != "" {
+		if _, err := primitive.ObjectIDFromHex(before); err != nil {
+			return nil, err
+		}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	items := []mongodb.SavedItem{}
+	for i := len(db.saved) - 1; i >= 0 && len(items) < limit; i-- {
+		item := db.saved[i]
+		if item.UserID == userId && (before == "" || item.ID < before) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// RemoveSavedItemsOfMessages will forget the saved items of every user for the messages
+func (db *DB) RemoveSavedItemsOfMessages(ctx context.Context, messageIds []string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	removed := make(map[string]bool)
+	for _, id := range messageIds {
+		removed[id] = true
+	}
+	kept := db.saved[:0:0]
+	for _, item := range db.saved {
+		if !removed[item.MessageID] {
+			kept = append(kept, item)
+		}
+	}
+	db.saved = kept
+	return nil
+}
+
+// AddScheduledMessage will store a message to post later
+func (db *DB) AddScheduledMessage(ctx context.Context, scheduled mongodb.ScheduledMessage) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	scheduled.ID = primitive.NewObjectID().Hex()
+	db.scheduled = append(db.scheduled, scheduled)
+	return scheduled.ID, nil
+}
+
+// GetScheduledMessages will get the messages of the user which are not posted yet, the next first
+func (db *DB) GetScheduledMessages(ctx context.Context, userId string) ([]mongodb.ScheduledMessage, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	scheduled := []mongodb.ScheduledMessage{}
+	for _, s := range db.scheduled {
+		if s.UserID == userId && s.Status != mongodb.ScheduledSent {
+			scheduled = append(scheduled, s)
+		}
+	}
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		return scheduled[i].PostAt.Before(scheduled[j].PostAt)
+	})
+	return scheduled, nil
+}
+
+// DeleteScheduledMessage will cancel a pending or failed scheduled message of the user
+func (db *DB) DeleteScheduledMessage(ctx context.Context, id string, userId string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, s := range db.scheduled {
+		if s.ID == id && s.UserID == userId && (s.Status == mongodb.ScheduledPending || s.Status == mongodb.ScheduledFailed) {
+			db.scheduled = append(db.scheduled[:i:i], db.scheduled[i+1:]...)
+			return nil
+		}
+	}
+	return mongodb.ErrScheduledMessageNotFound
+}
+
+// ClaimScheduledMessage will mark the earliest due message as sending and return it,
+// a message claimed before staleBefore is claimed again
+func (db *DB) ClaimScheduledMessage(ctx context.Context, now time.Time, staleBefore time.Time) (*mongodb.ScheduledMessage, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	next := -1
+	for i, s := range db.scheduled {
+		due := !s.PostAt.After(now)
+		claimable := s.Status == mongodb.ScheduledPending ||
+			(s.Status == mongodb.ScheduledSending && s.ClaimedAt.Before(staleBefore))
+		if due && claimable && (next < 0 || s.PostAt.Before(db.scheduled[next].PostAt)) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil, mongodb.ErrScheduledMessageNotFound
+	}
+	db.scheduled[next].Status = mongodb.ScheduledSending
+	db.scheduled[next].ClaimedAt = now
+	claimed := db.scheduled[next]
+	return &claimed, nil
+}
+
+// FinishScheduledMessage will record the outcome of posting a claimed message
+func (db *DB) FinishScheduledMessage(ctx context.Context, id string, messageId string, failure string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, s := range db.scheduled {
+		if s.ID != id {
+			continue
+		}
+		if failure != "" {
+			db.scheduled[i].Status = mongodb.ScheduledFailed
+			db.scheduled[i].Error = failure
+		} else {
+			db.scheduled[i].Status = mongodb.ScheduledSent
+			db.scheduled[i].MessageID = messageId
+		}
+		return nil
+	}
+	return mongodb.ErrScheduledMessageNotFound
+}
+
+// SetReminder will store the reminder of the user on the message, replacing the one set before
+func (db *DB) SetReminder(ctx context.Context, reminder mongodb.Reminder) (*mongodb.Reminder, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored := mongodb.Reminder{
+		ID:        primitive.NewObjectID().Hex(),
+		UserID:    reminder.UserID,
+		MessageID: reminder.MessageID,
+		RoomID:    reminder.RoomID,
+		RemindAt:  reminder.RemindAt,
+		CreatedAt: reminder.CreatedAt,
+		Status:    mongodb.ReminderPending,
+	}
+	for i, r := range db.reminders {
+		if r.UserID == reminder.UserID && r.MessageID == reminder.MessageID {
+			stored.ID = r.ID
+			db.reminders[i] = stored
+			return &stored, nil
+		}
+	}
+	db.reminders = append(db.reminders, stored)
+	return &stored, nil
+}
+
+// GetReminders will get the reminders of the user which are not delivered yet, the next first
+func (db *DB) GetReminders(ctx context.Context, userId string) ([]mongodb.Reminder, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	reminders := []mongodb.Reminder{}
+	for _, r := range db.reminders {
+		if r.UserID == userId && r.Status != mongodb.ReminderDelivered {
+			reminders = append(reminders, r)
+		}
+	}
+	sort.SliceStable(reminders, func(i, j int) bool {
+		return reminders[i].RemindAt.Before(reminders[j].RemindAt)
+	})
+	return reminders, nil
+}
+
+// DeleteReminder will delete the reminder of the user on the message
+func (db *DB) DeleteReminder(ctx context.Context, userId string, messageId string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, r := range db.reminders {
+		if r.UserID == userId && r.MessageID == messageId {
+			db.reminders = append(db.reminders[:i:i], db.reminders[i+1:]...)
+			return nil
+		}
+	}
+	return mongodb.ErrReminderNotFound
+}
+
+// ClaimReminder will mark the earliest due reminder as sending and return it,
+// a reminder claimed before staleBefore is claimed again
+func (db *DB) ClaimReminder(ctx context.Context, now time.Time, staleBefore time.Time) (*mongodb.Reminder, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	next := -1
+	for i, r := range db.reminders {
+		due := !r.RemindAt.After(now)
+		claimable := r.Status == mongodb.ReminderPending ||
+			(r.Status == mongodb.ReminderSending && r.ClaimedAt.Before(staleBefore))
+		if due && claimable && (next < 0 || r.RemindAt.Before(db.reminders[next].RemindAt)) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return nil, mongodb.ErrReminderNotFound
+	}
+	db.reminders[next].Status = mongodb.ReminderSending
+	db.reminders[next].ClaimedAt = now
+	claimed := db.reminders[next]
+	return &claimed, nil
+}
+
+// FinishReminder will record the outcome of delivering a claimed reminder,
+// a reminder set again meanwhile is left pending
+func (db *DB) FinishReminder(ctx context.Context, id string, deliveredVia string, failure string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, r := range db.reminders {
+		if r.ID != id || r.Status != mongodb.ReminderSending {
+			continue
+		}
+		if failure != "" {
+			db.reminders[i].Status = mongodb.ReminderFailed
+			db.reminders[i].Error = failure
+		} else {
+			db.reminders[i].Status = mongodb.ReminderDelivered
+			db.reminders[i].DeliveredVia = deliveredVia
+		}
+		return nil
+	}
+	return mongodb.ErrReminderNotFound
+}
+
+// AddPoll will store a new poll
+func (db *DB) AddPoll(ctx context.Context, poll mongodb.Poll) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	poll.ID = primitive.NewObjectID().Hex()
+	db.polls = append(db.polls, poll)
+	return poll.ID, nil
+}
+
+// GetPoll will get the poll by id, mongodb.ErrPollNotFound when it does not exist
+func (db *DB) GetPoll(ctx context.Context, id string) (*mongodb.Poll, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, poll := range db.polls {
+		if poll.ID == id {
+			found := poll
+			return &found, nil
+		}
+	}
+	return nil, mongodb.ErrPollNotFound
+}
+
+// DeletePoll will delete the poll by id, mongodb.ErrPollNotFound when it does not exist
+func (db *DB) DeletePoll(ctx context.Context, id string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, poll := range db.polls {
+		if poll.ID == id {
+			db.polls = append(db.polls[:i:i], db.polls[i+1:]...)
+			return nil
+		}
+	}
+	return mongodb.ErrPollNotFound
+}
+
+// SetPollMessage will link the poll to the message announcing it
+func (db *DB) SetPollMessage(ctx context.Context, pollId string, messageId string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, poll := range db.polls {
+		if poll.ID == pollId {
+			db.polls[i].MessageID = messageId
+			return nil
+		}
+	}
+	return mongodb.ErrPollNotFound
+}
+
+// SetPollVote will store the vote of the user, replacing the vote cast before in the same poll
+func (db *DB) SetPollVote(ctx context.Context, vote mongodb.PollVote) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, v := range db.votes {
+		if v.PollID == vote.PollID && v.UserID == vote.UserID {
+			db.votes[i] = vote
+			return nil
+		}
+	}
+	db.votes = append(db.votes, vote)
+	return nil
+}
+
+// GetPollVotes will get every vote of the poll
+func (db *DB) GetPollVotes(ctx context.Context, pollId string) ([]mongodb.PollVote, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	votes := []mongodb.PollVote{}
+	for _, v := range db.votes {
+		if v.PollID == pollId {
+			votes = append(votes, v)
+		}
+	}
+	return votes, nil
+}
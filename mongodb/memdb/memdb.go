@@ -0,0 +1,299 @@
+// Package memdb is an in-memory mongodb.Repository for unit tests.
+// rooms, messages, users and attachments are kept as documents like mongoDB keeps them, so the filters the
+// services build work unchanged: equality, array contains, $in, $ne, $gt, $gte, $lt, $lte, $exists and $or
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DB keeps every collection in memory, it is safe for concurrent use
+type DB struct {
+	mu sync.Mutex
+
+	rooms       []bson.M
+	messages    []bson.M
+	users       []bson.M
+	attachments []bson.M
+
+	pins      map[string][]mongodb.Pin
+	seqs      map[string]int64
+	previews  map[string]mongodb.LinkPreview
+	saved     []mongodb.SavedItem
+	scheduled []mongodb.ScheduledMessage
+	reminders []mongodb.Reminder
+	polls     []mongodb.Poll
+	votes     []mongodb.PollVote
+}
+
+var _ mongodb.Repository = (*DB)(nil)
+
+// New will return an empty DB
+func New() *DB {
+	return &DB{
+		pins:     make(map[string][]mongodb.Pin),
+		seqs:     make(map[string]int64),
+		previews: make(map[string]mongodb.LinkPreview),
+	}
+}
+
+// errNotFound is what mongodb.MongoDB returns when FindOne matches nothing
+var errNotFound = fmt.Errorf("%w: %v", mongodb.ErrNotFound, mongo.ErrNoDocuments)
+
+// toDoc will round trip v through bson, so stored documents and filters hold the same types
+func toDoc(v interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// insert will add doc to coll with a new _id unless it has one, and return the _id
+func insert(coll *[]bson.M, v interface{}) (primitive.ObjectID, error) {
+	doc, err := toDoc(v)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id, ok := doc["_id"].(primitive.ObjectID)
+	if !ok {
+		id = primitive.NewObjectID()
+		doc["_id"] = id
+	}
+	if findIndex(*coll, bson.M{"_id": id}) >= 0 {
+		return primitive.NilObjectID, mongodb.ErrConflict
+	}
+	*coll = append(*coll, doc)
+	return id, nil
+}
+
+// find will return the documents of coll matching filter, in insert order
+func find(coll []bson.M, filter interface{}) ([]bson.M, error) {
+	f, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	var found []bson.M
+	for _, doc := range coll {
+		if matches(doc, f) {
+			found = append(found, doc)
+		}
+	}
+	return found, nil
+}
+
+// findIndex will return the index of the first document of coll matching filter, -1 for none
+func findIndex(coll []bson.M, filter bson.M) int {
+	for i, doc := range coll {
+		if matches(doc, filter) {
+			return i
+		}
+	}
+	return -1
+}
+
+// raw will encode doc for the decoders of package mongodb
+func raw(doc bson.M) bson.Raw {
+	raw, _ := bson.Marshal(doc)
+	return raw
+}
+
+// matches will tell whether doc matches filter
+func matches(doc bson.M, filter bson.M) bool {
+	for key, cond := range filter {
+		if key == "$or" {
+			if !matchesAny(doc, cond) {
+				return false
+			}
+			continue
+		}
+		value, exists := doc[key]
+		if ops, ok := operators(cond); ok {
+			for op, arg := range ops {
+				if !matchesOperator(value, exists, op, arg) {
+					return false
+				}
+			}
+			continue
+		}
+		if !matchesValue(value, cond) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny will tell whether doc matches any filter of the $or array
+func matchesAny(doc bson.M, cond interface{}) bool {
+	filters, ok := cond.(primitive.A)
+	if !ok {
+		return false
+	}
+	for _, f := range filters {
+		if sub, ok := asDoc(f); ok && matches(doc, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// operators will return cond as a document of query operators, like {"$in": [...]}
+func operators(cond interface{}) (bson.M, bool) {
+	doc, ok := asDoc(cond)
+	if !ok || len(doc) == 0 {
+		return nil, false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func matchesOperator(value interface{}, exists bool, op string, arg interface{}) bool {
+	switch op {
+	case "$exists":
+		want, _ := arg.(bool)
+		return exists == want
+	case "$ne":
+		return !matchesValue(value, arg)
+	case "$in":
+		values, _ := arg.(primitive.A)
+		for _, v := range values {
+			if matchesValue(value, v) {
+				return true
+			}
+		}
+		return false
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exists {
+			return false
+		}
+		c, ok := compare(value, arg)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "$gt":
+			return c > 0
+		case "$gte":
+			return c >= 0
+		case "$lt":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	default:
+		return false
+	}
+}
+
+// matchesValue will tell whether value equals want, or contains it when value is an array
+func matchesValue(value interface{}, want interface{}) bool {
+	if equal(value, want) {
+		return true
+	}
+	if values, ok := value.(primitive.A); ok {
+		for _, v := range values {
+			if equal(v, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equal(a interface{}, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare will order a and b when they are of comparable bson types
+func compare(a interface{}, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case primitive.ObjectID:
+		if y, ok := b.(primitive.ObjectID); ok {
+			return bytes.Compare(x[:], y[:]), true
+		}
+	case primitive.DateTime:
+		if y, ok := b.(primitive.DateTime); ok {
+			return compareInt64(int64(x), int64(y)), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok && x == y {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func compareInt64(x int64, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// asDoc will return v as bson.M, nested documents decode to bson.M or primitive.D
+func asDoc(v interface{}) (bson.M, bool) {
+	switch d := v.(type) {
+	case bson.M:
+		return d, true
+	case primitive.D:
+		return d.Map(), true
+	}
+	return nil, false
+}
+
+// check will return the error of a done ctx, like the driver does before a round trip
+func check(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -0,0 +1,203 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMessages(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	first, err := db.AddMessage(ctx, bson.D{{Key: "message", Value: "first"}, {Key: "room_id", Value: "room1"}, {Key: "seq", Value: int64(2)}})
+	assert.Nil(t, err)
+	second, err := db.AddMessage(ctx, bson.D{{Key: "message", Value: "second"}, {Key: "room_id", Value: "room1"}, {Key: "seq", Value: int64(1)}})
+	assert.Nil(t, err)
+	_, err = db.AddMessage(ctx, bson.D{{Key: "message", Value: "other room"}, {Key: "room_id", Value: "room2"}})
+	assert.Nil(t, err)
+
+	messages, err := db.GetMessages(ctx, bson.M{"room_id": "room1"})
+	assert.Nil(t, err)
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, second, messages[0].ID, "ordered by seq")
+		assert.Equal(t, "first", messages[1].Message)
+	}
+
+	firstID, _ := primitive.ObjectIDFromHex(first)
+	secondID, _ := primitive.ObjectIDFromHex(second)
+	messages, err = db.GetMessages(ctx, bson.M{"_id": bson.M{"$in": []primitive.ObjectID{firstID, secondID}}, "room_id": "room1"})
+	assert.Nil(t, err)
+	assert.Len(t, messages, 2)
+
+	messages, err = db.GetMessagesAfter(ctx, "room1", second, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, first, messages[0].ID)
+	}
+	messages, err = db.GetMessagesAfter(ctx, "room1", second, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, messages, "at most limit messages")
+
+	message, err := db.GetMessage(ctx, bson.M{"_id": firstID})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", message.Message)
+	_, err = db.GetMessage(ctx, bson.M{"_id": primitive.NewObjectID()})
+	assert.True(t, errors.Is(err, mongodb.ErrNotFound))
+
+	err = db.SetMessagePreviews(ctx, first, []mongodb.LinkPreview{{URL: "https://example.com", Title: "Example"}})
+	assert.Nil(t, err)
+	message, _ = db.GetMessage(ctx, bson.M{"_id": firstID})
+	if assert.Len(t, message.Previews, 1) {
+		assert.Equal(t, "Example", message.Previews[0].Title)
+	}
+}
+
+func TestGetMessagesAfterOtherRoom(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	_, err := db.AddMessage(ctx, bson.D{{Key: "message", Value: "first"}, {Key: "room_id", Value: "room1"}, {Key: "seq", Value: int64(2)}})
+	assert.Nil(t, err)
+	other, err := db.AddMessage(ctx, bson.D{{Key: "message", Value: "other room"}, {Key: "room_id", Value: "room2"}, {Key: "seq", Value: int64(1)}})
+	assert.Nil(t, err)
+
+	// the sequence of room2 says nothing about room1, only the messages of room1 stored after it are newer
+	messages, err := db.GetMessagesAfter(ctx, "room1", other, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestAddMessageDuplicate(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	message := bson.D{{Key: "user_id", Value: "user1"}, {Key: "client_msg_id", Value: "abc"}}
+	_, err := db.AddMessage(ctx, message)
+	assert.Nil(t, err)
+	_, err = db.AddMessage(ctx, message)
+	assert.Equal(t, mongodb.ErrDuplicateMessage, err)
+
+	// messages without client_msg_id are never duplicates
+	_, err = db.AddMessage(ctx, bson.D{{Key: "user_id", Value: "user1"}})
+	assert.Nil(t, err)
+	_, err = db.AddMessage(ctx, bson.D{{Key: "user_id", Value: "user1"}})
+	assert.Nil(t, err)
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	user, created, err := db.FindOrAddUser(ctx, mongodb.UserAuth{Email: "ocean@example.com", UserImage: "image"})
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "image", user.UserImage)
+
+	again, created, err := db.FindOrAddUser(ctx, mongodb.UserAuth{Email: "ocean@example.com"})
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, user.ID, again.ID)
+
+	filter := bson.M{"email": "ocean@example.com"}
+	upsert := options.Update().SetUpsert(true)
+	assert.Nil(t, db.UpdateUser(ctx, filter, bson.D{{Key: "$set", Value: bson.M{"rooms": []string{}}}}, upsert))
+	assert.Nil(t, db.UpdateUser(ctx, filter, bson.D{{Key: "$push", Value: bson.M{"rooms": "room1"}}}, upsert))
+	assert.Nil(t, db.UpdateUser(ctx, filter, bson.D{{Key: "$push", Value: bson.M{"rooms": "room2"}}}, upsert))
+
+	members, err := db.GetUsers(ctx, bson.M{"rooms": "room2"})
+	assert.Nil(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, []string{"room1", "room2"}, members[0].Rooms)
+	}
+
+	// an upsert adds the user made of the filter
+	assert.Nil(t, db.UpdateUser(ctx, bson.M{"email": "new@example.com"}, bson.D{{Key: "$push", Value: bson.M{"rooms": "room1"}}}, upsert))
+	added, err := db.GetUser(ctx, bson.M{"email": "new@example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"room1"}, added.Rooms)
+
+	_, err = db.AddUser(ctx, bson.M{"email": "new@example.com"})
+	assert.True(t, errors.Is(err, mongodb.ErrConflict))
+	_, err = db.GetUser(ctx, bson.M{"email": "nobody@example.com"})
+	assert.True(t, errors.Is(err, mongodb.ErrNotFound))
+}
+
+func TestRoomsAndPins(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	roomIds, err := db.AddRooms(ctx, []interface{}{bson.D{{Key: "name", Value: "room1"}}, bson.D{{Key: "name", Value: "room2"}}})
+	assert.Nil(t, err)
+	rooms, err := db.GetRooms(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, rooms, 2)
+
+	objID, _ := primitive.ObjectIDFromHex(roomIds[1])
+	room, err := db.GetRoom(ctx, bson.M{"_id": objID})
+	assert.Nil(t, err)
+	assert.Equal(t, "room2", room.Name)
+	_, err = db.GetRoom(ctx, bson.M{"name": "room3"})
+	assert.Equal(t, mongodb.ErrRoomNotFound, err)
+
+	roomId := roomIds[0]
+	assert.Nil(t, db.AddPin(ctx, roomId, mongodb.Pin{MessageID: "m1"}, 2))
+	assert.Equal(t, mongodb.ErrPinExists, db.AddPin(ctx, roomId, mongodb.Pin{MessageID: "m1"}, 2))
+	assert.Nil(t, db.AddPin(ctx, roomId, mongodb.Pin{MessageID: "m2"}, 2))
+	assert.Equal(t, mongodb.ErrPinLimit, db.AddPin(ctx, roomId, mongodb.Pin{MessageID: "m3"}, 2))
+	assert.Nil(t, db.RemovePin(ctx, roomId, "m1"))
+	assert.Equal(t, mongodb.ErrPinNotFound, db.RemovePin(ctx, roomId, "m1"))
+
+	pins, err := db.GetPins(ctx, roomId)
+	assert.Nil(t, err)
+	if assert.Len(t, pins, 1) {
+		assert.Equal(t, "m2", pins[0].MessageID)
+	}
+	_, err = db.GetPins(ctx, primitive.NewObjectID().Hex())
+	assert.Equal(t, mongodb.ErrRoomNotFound, err)
+}
+
+func TestClaimScheduledMessage(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	now := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	later, _ := db.AddScheduledMessage(ctx, mongodb.ScheduledMessage{UserID: "user1", PostAt: now.Add(time.Minute), Status: mongodb.ScheduledPending})
+	due, _ := db.AddScheduledMessage(ctx, mongodb.ScheduledMessage{UserID: "user1", PostAt: now.Add(-time.Minute), Status: mongodb.ScheduledPending})
+
+	claimed, err := db.ClaimScheduledMessage(ctx, now, now.Add(-time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, due, claimed.ID)
+	_, err = db.ClaimScheduledMessage(ctx, now, now.Add(-time.Hour))
+	assert.Equal(t, mongodb.ErrScheduledMessageNotFound, err)
+
+	// a claim older than staleBefore is taken over
+	claimed, err = db.ClaimScheduledMessage(ctx, now.Add(2*time.Hour), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, due, claimed.ID)
+
+	assert.Nil(t, db.FinishScheduledMessage(ctx, due, "message1", ""))
+	scheduled, err := db.GetScheduledMessages(ctx, "user1")
+	assert.Nil(t, err)
+	if assert.Len(t, scheduled, 1) {
+		assert.Equal(t, later, scheduled[0].ID)
+	}
+}
+
+func TestContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	db := New()
+
+	_, err := db.GetRooms(ctx)
+	assert.Equal(t, context.Canceled, err)
+	_, err = db.GetUser(ctx, bson.M{})
+	assert.Equal(t, context.Canceled, err)
+}
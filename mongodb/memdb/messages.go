@@ -0,0 +1,235 @@
+package memdb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetMessages will get the messages matching filter, ordered by room sequence
+func (db *DB) GetMessages(ctx context.Context, filter interface{}) ([]mongodb.Message, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	found, err := find(db.messages, filter)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMessages(found), nil
+}
+
+// GetMessagesAfter will get at most limit messages of a room which come after messageId, in room sequence order
+func (db *DB) GetMessagesAfter(ctx context.Context, roomId string, messageId string, limit int) ([]mongodb.Message, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	objID, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	filter := bson.M{"room_id": roomId, "_id": bson.M{"$gt": objID}}
+	if i := findIndex(db.messages, bson.M{"_id": objID, "room_id": roomId}); i >= 0 {
+		if seq, ok := number(db.messages[i]["seq"]); ok && seq > 0 {
+			filter = bson.M{"room_id": roomId, "seq": bson.M{"$gt": seq}}
+		}
+	}
+	found, err := find(db.messages, filter)
+	if err != nil {
+		return nil, err
+	}
+	messages := decodeMessages(found)
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// NextMessageSeq will increment and return the message sequence of a room
+func (db *DB) NextMessageSeq(ctx context.Context, roomId string) (int64, error) {
+	if err := check(ctx); err != nil {
+		return 0, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.seqs[roomId]++
+	return db.seqs[roomId], nil
+}
+
+// GetMessage will get the first message matching filter, the error is mongodb.ErrNotFound for none
+func (db *DB) GetMessage(ctx context.Context, filter interface{}) (mongodb.Message, error) {
+	if err := check(ctx); err != nil {
+		return mongodb.Message{}, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	found, err := find(db.messages, filter)
+	if err != nil {
+		return mongodb.Message{}, err
+	}
+	if len(found) == 0 {
+		return mongodb.Message{}, errNotFound
+	}
+	return mongodb.DecodeMessage(raw(found[0]))
+}
+
+// AddMessage will add the message document, mongodb.ErrDuplicateMessage for a client_msg_id the user already sent
+func (db *DB) AddMessage(ctx context.Context, message interface{}) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	doc, err := toDoc(message)
+	if err != nil {
+		return "", err
+	}
+	if clientMsgId, ok := doc["client_msg_id"].(string); ok {
+		duplicate := bson.M{"user_id": doc["user_id"], "client_msg_id": clientMsgId}
+		if findIndex(db.messages, duplicate) >= 0 {
+			return "", mongodb.ErrDuplicateMessage
+		}
+	}
+	id, err := insert(&db.messages, doc)
+	if err != nil {
+		return "", err
+	}
+	return id.Hex(), nil
+}
+
+// AddMessages will add the message documents and return their ids
+func (db *DB) AddMessages(ctx context.Context, messages []interface{}) ([]string, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return insertMany(&db.messages, messages)
+}
+
+// AddAttachment will add the metadata document of an uploaded file and return its id
+func (db *DB) AddAttachment(ctx context.Context, attachment interface{}) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	id, err := insert(&db.attachments, attachment)
+	if err != nil {
+		return "", err
+	}
+	return id.Hex(), nil
+}
+
+// GetAttachment will get the first attachment matching filter, mongodb.ErrAttachmentNotFound for none
+func (db *DB) GetAttachment(ctx context.Context, filter interface{}) (*mongodb.Attachment, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	found, err := find(db.attachments, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, mongodb.ErrAttachmentNotFound
+	}
+	var attachmentDoc struct {
+		ID                 primitive.ObjectID `bson:"_id"`
+		mongodb.Attachment `bson:",inline"`
+	}
+	if err := bson.Unmarshal(raw(found[0]), &attachmentDoc); err != nil {
+		return nil, err
+	}
+	attachment := attachmentDoc.Attachment
+	attachment.ID = attachmentDoc.ID.Hex()
+	return &attachment, nil
+}
+
+// GetLinkPreview will get the cached preview of the url, mongodb.ErrLinkPreviewNotFound when not cached
+func (db *DB) GetLinkPreview(ctx context.Context, url string) (*mongodb.LinkPreview, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	preview, ok := db.previews[url]
+	if !ok {
+		return nil, mongodb.ErrLinkPreviewNotFound
+	}
+	return &preview, nil
+}
+
+// SaveLinkPreview will add or replace the cached preview of preview.URL
+func (db *DB) SaveLinkPreview(ctx context.Context, preview mongodb.LinkPreview) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.previews[preview.URL] = preview
+	return nil
+}
+
+// SetMessagePreviews will replace the link previews of the message
+func (db *DB) SetMessagePreviews(ctx context.Context, messageId string, previews []mongodb.LinkPreview) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	objID, err := primitive.ObjectIDFromHex(messageId)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i := findIndex(db.messages, bson.M{"_id": objID})
+	if i < 0 {
+		return nil
+	}
+	set, err := toDoc(bson.M{"previews": previews})
+	if err != nil {
+		return err
+	}
+	db.messages[i]["previews"] = set["previews"]
+	return nil
+}
+
+// decodeMessages will sort the documents by room sequence and decode them, skipping malformed ones
+func decodeMessages(docs []bson.M) []mongodb.Message {
+	sorted := append([]bson.M(nil), docs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		seqI, _ := number(sorted[i]["seq"])
+		seqJ, _ := number(sorted[j]["seq"])
+		if seqI != seqJ {
+			return seqI < seqJ
+		}
+		c, _ := compare(sorted[i]["_id"], sorted[j]["_id"])
+		return c < 0
+	})
+
+	var messages []mongodb.Message
+	for _, doc := range sorted {
+		if message, err := mongodb.DecodeMessage(raw(doc)); err == nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,162 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetRooms will get all rooms in insert order
+func (db *DB) GetRooms(ctx context.Context) ([]mongodb.Room, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var rooms []mongodb.Room
+	for _, doc := range db.rooms {
+		if room, err := mongodb.DecodeRoom(raw(doc)); err == nil {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
+// GetRoom will get the first room matching filter, mongodb.ErrRoomNotFound for none
+func (db *DB) GetRoom(ctx context.Context, filter interface{}) (*mongodb.Room, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	found, err := find(db.rooms, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, mongodb.ErrRoomNotFound
+	}
+	room, err := mongodb.DecodeRoom(raw(found[0]))
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// GetAnyRoom will get the first room added, mongodb.ErrRoomNotFound when there is none
+func (db *DB) GetAnyRoom(ctx context.Context) (*mongodb.Room, error) {
+	return db.GetRoom(ctx, bson.M{})
+}
+
+// AddRoom will add a room named roomName, the id is formatted like mongodb.MongoDB does
+func (db *DB) AddRoom(ctx context.Context, roomName string) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	id, err := insert(&db.rooms, bson.M{"name": roomName})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", id), nil
+}
+
+// AddRooms will add the room documents and return their ids
+func (db *DB) AddRooms(ctx context.Context, rooms []interface{}) ([]string, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return insertMany(&db.rooms, rooms)
+}
+
+// AddPin will pin the message to the room, at most maxPins per room
+func (db *DB) AddPin(ctx context.Context, roomId string, pin mongodb.Pin, maxPins int) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.roomExists(roomId) {
+		return mongodb.ErrRoomNotFound
+	}
+	if maxPins < 1 {
+		return mongodb.ErrPinLimit
+	}
+	for _, p := range db.pins[roomId] {
+		if p.MessageID == pin.MessageID {
+			return mongodb.ErrPinExists
+		}
+	}
+	if len(db.pins[roomId]) >= maxPins {
+		return mongodb.ErrPinLimit
+	}
+	db.pins[roomId] = append(db.pins[roomId], pin)
+	return nil
+}
+
+// RemovePin will unpin the message from the room
+func (db *DB) RemovePin(ctx context.Context, roomId string, messageId string) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.roomExists(roomId) {
+		return mongodb.ErrRoomNotFound
+	}
+	pins := db.pins[roomId]
+	for i, p := range pins {
+		if p.MessageID == messageId {
+			db.pins[roomId] = append(pins[:i:i], pins[i+1:]...)
+			return nil
+		}
+	}
+	return mongodb.ErrPinNotFound
+}
+
+// GetPins will get the pins of the room in the order they were added
+func (db *DB) GetPins(ctx context.Context, roomId string) ([]mongodb.Pin, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.roomExists(roomId) {
+		return nil, mongodb.ErrRoomNotFound
+	}
+	return append([]mongodb.Pin(nil), db.pins[roomId]...), nil
+}
+
+func (db *DB) roomExists(roomId string) bool {
+	objID, err := primitive.ObjectIDFromHex(roomId)
+	if err != nil {
+		return false
+	}
+	return findIndex(db.rooms, bson.M{"_id": objID}) >= 0
+}
+
+// insertMany will add the documents to coll and return their ids as hex
+func insertMany(coll *[]bson.M, docs []interface{}) ([]string, error) {
+	var ids []string
+	for _, doc := range docs {
+		id, err := insert(coll, doc)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id.Hex())
+	}
+	return ids, nil
+}
@@ -0,0 +1,193 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetUsers will get the users matching filter in insert order
+func (db *DB) GetUsers(ctx context.Context, filter interface{}) ([]mongodb.User, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	found, err := find(db.users, filter)
+	if err != nil {
+		return nil, err
+	}
+	var users []mongodb.User
+	for _, doc := range found {
+		if user, err := mongodb.DecodeUser(raw(doc)); err == nil {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// GetUser will get the first user matching filter, the error is mongodb.ErrNotFound for none
+func (db *DB) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.getUser(filter)
+}
+
+func (db *DB) getUser(filter interface{}) (*mongodb.User, error) {
+	found, err := find(db.users, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, errNotFound
+	}
+	user, err := mongodb.DecodeUser(raw(found[0]))
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AddUser will add the user document, the id is formatted like mongodb.MongoDB does
+func (db *DB) AddUser(ctx context.Context, user interface{}) (string, error) {
+	if err := check(ctx); err != nil {
+		return "", err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	doc, err := toDoc(user)
+	if err != nil {
+		return "", err
+	}
+	if err := db.checkEmail(doc); err != nil {
+		return "", err
+	}
+	id, err := insert(&db.users, doc)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v", id), nil
+}
+
+// FindOrAddUser will get the user with the email of userAuth, adding the user first when there is none.
+// created tells whether the user was added
+func (db *DB) FindOrAddUser(ctx context.Context, userAuth mongodb.UserAuth) (*mongodb.User, bool, error) {
+	if err := check(ctx); err != nil {
+		return nil, false, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	filter := bson.M{"email": userAuth.Email}
+	if user, err := db.getUser(filter); err == nil {
+		return user, false, nil
+	}
+	doc := bson.M{"email": userAuth.Email, "username": "", "user_image": userAuth.UserImage, "rooms": bson.A{}}
+	if _, err := insert(&db.users, doc); err != nil {
+		return nil, false, err
+	}
+	user, err := db.getUser(filter)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, true, nil
+}
+
+// UpdateUser will apply the $set, $push and $setOnInsert of update to the first user matching filter.
+// with an upsert option a user made of the filter is added when none matches
+func (db *DB) UpdateUser(ctx context.Context, filter interface{}, update interface{}, options *options.UpdateOptions) error {
+	if err := check(ctx); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	f, err := toDoc(filter)
+	if err != nil {
+		return err
+	}
+	u, err := toDoc(update)
+	if err != nil {
+		return err
+	}
+
+	i := findIndex(db.users, f)
+	inserted := i < 0
+	if inserted {
+		if options == nil || options.Upsert == nil || !*options.Upsert {
+			return nil
+		}
+		doc := bson.M{"_id": primitive.NewObjectID()}
+		for key, value := range f {
+			if _, isOperator := operators(value); !isOperator && key != "$or" {
+				doc[key] = value
+			}
+		}
+		db.users = append(db.users, doc)
+		i = len(db.users) - 1
+	}
+
+	doc := db.users[i]
+	if set, ok := asDoc(u["$set"]); ok {
+		for key, value := range set {
+			doc[key] = value
+		}
+	}
+	if push, ok := asDoc(u["$push"]); ok {
+		for key, value := range push {
+			values, _ := doc[key].(primitive.A)
+			doc[key] = append(values, value)
+		}
+	}
+	if setOnInsert, ok := asDoc(u["$setOnInsert"]); ok && inserted {
+		for key, value := range setOnInsert {
+			doc[key] = value
+		}
+	}
+	return nil
+}
+
+// AddUsers will add the user documents and return their ids
+func (db *DB) AddUsers(ctx context.Context, users []interface{}) ([]string, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var ids []string
+	for _, user := range users {
+		doc, err := toDoc(user)
+		if err != nil {
+			return ids, err
+		}
+		if err := db.checkEmail(doc); err != nil {
+			return ids, err
+		}
+		id, err := insert(&db.users, doc)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id.Hex())
+	}
+	return ids, nil
+}
+
+// checkEmail will return mongodb.ErrConflict when a user with the email of doc exists, like the unique email index
+func (db *DB) checkEmail(doc bson.M) error {
+	email, ok := doc["email"]
+	if ok && findIndex(db.users, bson.M{"email": email}) >= 0 {
+		return fmt.Errorf("%w: duplicate email %v", mongodb.ErrConflict, email)
+	}
+	return nil
+}
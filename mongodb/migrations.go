@@ -0,0 +1,358 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrationsCollection records the version of every migration applied to the database
+const migrationsCollection = "migrations"
+
+// Migration is one versioned change of the database, Up applies it and Down reverts it.
+// both must be idempotent: a migration interrupted halfway, or run by two instances starting together, is run again
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// MigrationStatus tells whether a migration was applied, AppliedAt is nil while it is pending
+type MigrationStatus struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time
+}
+
+func (s MigrationStatus) String() string {
+	if s.AppliedAt == nil {
+		return fmt.Sprintf("%4d  pending                    %v", s.Version, s.Description)
+	}
+	return fmt.Sprintf("%4d  applied %v  %v", s.Version, s.AppliedAt.UTC().Format(time.RFC3339), s.Description)
+}
+
+// migrationRecord is the document of an applied migration
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrator applies versioned migrations to a database, in the order of their versions
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewMigrator will initialize Migrator for the migrations of db, versions must be unique
+func NewMigrator(db *mongo.Database, migrations []Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version: %v", sorted[i].Version)
+		}
+	}
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+// Migrator will return the Migrator of the application migrations, see Migrations
+func (m *MongoDB) Migrator() *Migrator {
+	migrator, err := NewMigrator(m.client.Database(m.config.Name), Migrations())
+	if err != nil {
+		// Migrations is a constant list, this is a programming error
+		panic(err)
+	}
+	return migrator
+}
+
+// Up will apply every pending migration in order and return their versions.
+// it stops at the first failure, the migrations applied before it stay recorded
+func (m *Migrator) Up(ctx context.Context) ([]int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := migration.Up(ctx, m.db); err != nil {
+			return versions, fmt.Errorf("migration %v up failed: %w", migration.Version, wrapError(err))
+		}
+		record := migrationRecord{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now()}
+		// another instance may have recorded it meanwhile, the migration is idempotent so that is fine
+		_, err := m.db.Collection(migrationsCollection).InsertOne(ctx, record)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return versions, fmt.Errorf("failed to record migration %v: %w", migration.Version, wrapError(err))
+		}
+		log.Println("migration applied: ", migration.Version, migration.Description)
+		versions = append(versions, migration.Version)
+	}
+	return versions, nil
+}
+
+// Down will revert the latest applied migration and return its version, ErrNotFound when none is applied
+func (m *Migrator) Down(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := migration.Down(ctx, m.db); err != nil {
+			return 0, fmt.Errorf("migration %v down failed: %w", migration.Version, wrapError(err))
+		}
+		_, err := m.db.Collection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": migration.Version})
+		if err != nil {
+			return 0, fmt.Errorf("failed to forget migration %v: %w", migration.Version, wrapError(err))
+		}
+		log.Println("migration reverted: ", migration.Version, migration.Description)
+		return migration.Version, nil
+	}
+	return 0, fmt.Errorf("%w: no migration applied", ErrNotFound)
+}
+
+// Status will tell for every migration whether it was applied, in the order of their versions
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Description: migration.Description}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// applied will return the records of the applied migrations by version
+func (m *Migrator) applied(ctx context.Context) (map[int]migrationRecord, error) {
+	cursor, err := m.db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	var records []migrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, wrapError(err)
+	}
+	applied := make(map[int]migrationRecord)
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// collectionIndexes are the indexes of one collection
+type collectionIndexes struct {
+	collection string
+	indexes    []mongo.IndexModel
+}
+
+// collectionValidator is the validator of one collection, an empty one accepts every document
+type collectionValidator struct {
+	collection string
+	validator  bson.M
+}
+
+// Migrations are the migrations of the application, a new one gets the next version and is never edited once released
+func Migrations() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "indexes of messages, saved items, scheduled messages, reminders, poll votes and users",
+			Up:          createIndexes(existingIndexes),
+			Down:        dropIndexes(existingIndexes),
+		},
+		{
+			Version:     2,
+			Description: "indexes on messages room_id and timestamp",
+			Up:          createIndexes(messageIndexes),
+			Down:        dropIndexes(messageIndexes),
+		},
+		{
+			Version:     3,
+			Description: "validators of users, rooms and messages",
+			Up:          setValidators(validators),
+			Down: setValidators([]collectionValidator{
+				{collection: "users", validator: bson.M{}},
+				{collection: "rooms", validator: bson.M{}},
+				{collection: "messages", validator: bson.M{}},
+			}),
+		},
+	}
+}
+
+// existingIndexes were created at every startup before migrations existed, creating them again is a no-op
+var existingIndexes = []collectionIndexes{
+	// makes AddMessage idempotent for retries, messages without client_msg_id are not indexed
+	{"messages", []mongo.IndexModel{{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "client_msg_id", Value: 1}},
+		Options: options.Index().
+			SetName("user_id_client_msg_id").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"client_msg_id": bson.M{"$type": "string"}}),
+	}}},
+	// a message is saved once per user, the newest saved first
+	{"saved_items", []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "message_id", Value: 1}},
+		Options: options.Index().SetName("user_id_message_id").SetUnique(true),
+	}}},
+	// the scheduler looks up due messages by status and time
+	{"scheduled_messages", []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "post_at", Value: 1}},
+		Options: options.Index().SetName("status_post_at"),
+	}}},
+	// a user has one reminder per message, the scheduler looks up due reminders by status and time
+	{"reminders", []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "message_id", Value: 1}},
+			Options: options.Index().SetName("user_id_message_id").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "remind_at", Value: 1}},
+			Options: options.Index().SetName("status_remind_at"),
+		},
+	}},
+	// a user votes once per poll, voting again replaces the vote
+	{"poll_votes", []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "poll_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("poll_id_user_id").SetUnique(true),
+	}}},
+	// one user per email, FindOrAddUser relies on it under concurrent logins
+	{"users", []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email").SetUnique(true),
+	}}},
+}
+
+// messageIndexes serve the history of a room, read by room_id in seq order, and lookups by time
+var messageIndexes = []collectionIndexes{
+	{"messages", []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "room_id", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetName("room_id_seq"),
+		},
+		{
+			Keys:    bson.D{{Key: "timestamp", Value: 1}},
+			Options: options.Index().SetName("timestamp"),
+		},
+	}},
+}
+
+// validators reject documents missing the fields every query relies on.
+// the level is moderate, so documents stored before the validator existed can still be updated
+var validators = []collectionValidator{
+	{"users", bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"email"},
+		"properties": bson.M{
+			"email": bson.M{"bsonType": "string"},
+			"rooms": bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+		},
+	}}},
+	{"rooms", bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"name"},
+		"properties": bson.M{
+			"name": bson.M{"bsonType": "string"},
+		},
+	}}},
+	{"messages", bson.M{"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"room_id", "timestamp"},
+		"properties": bson.M{
+			"room_id":   bson.M{"bsonType": "string"},
+			"timestamp": bson.M{"bsonType": "date"},
+		},
+	}}},
+}
+
+// createIndexes will return a migration step creating indexes by collection, an existing index of the same name is kept
+func createIndexes(indexes []collectionIndexes) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, c := range indexes {
+			if _, err := db.Collection(c.collection).Indexes().CreateMany(ctx, c.indexes); err != nil {
+				return fmt.Errorf("failed to create %v indexes: %w", c.collection, err)
+			}
+		}
+		return nil
+	}
+}
+
+// dropIndexes will return a migration step dropping indexes by collection, a missing index or collection is ignored
+func dropIndexes(indexes []collectionIndexes) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, c := range indexes {
+			for _, index := range c.indexes {
+				_, err := db.Collection(c.collection).Indexes().DropOne(ctx, *index.Options.Name)
+				if err != nil && !isCommandError(err, codeNamespaceNotFound, codeIndexNotFound) {
+					return fmt.Errorf("failed to drop %v index %v: %w", c.collection, *index.Options.Name, err)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// setValidators will return a migration step setting the validator of collections, an empty validator removes it.
+// a missing collection is created with its validator
+func setValidators(validators []collectionValidator) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		for _, c := range validators {
+			collMod := bson.D{
+				{Key: "collMod", Value: c.collection},
+				{Key: "validator", Value: c.validator},
+				{Key: "validationLevel", Value: "moderate"},
+				{Key: "validationAction", Value: "error"},
+			}
+			err := db.RunCommand(ctx, collMod).Err()
+			if isCommandError(err, codeNamespaceNotFound) {
+				opts := options.CreateCollection().SetValidator(c.validator).SetValidationLevel("moderate")
+				err = db.CreateCollection(ctx, c.collection, opts)
+			}
+			// a collection created meanwhile by another instance is retried by the next startup
+			if err != nil {
+				return fmt.Errorf("failed to set %v validator: %w", c.collection, err)
+			}
+		}
+		return nil
+	}
+}
+
+// server error codes the migrations tolerate
+const (
+	codeNamespaceNotFound = 26
+	codeIndexNotFound     = 27
+)
+
+// isCommandError will tell whether err is a server error with one of codes
+func isCommandError(err error, codes ...int32) bool {
+	var commandErr mongo.CommandError
+	if !errors.As(err, &commandErr) {
+		return false
+	}
+	for _, code := range codes {
+		if commandErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/benweissmann/memongo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestNewMigratorDuplicateVersion(t *testing.T) {
+	migrations := []Migration{{Version: 2}, {Version: 1}, {Version: 2}}
+
+	_, err := NewMigrator(nil, migrations)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "duplicate migration version: 2")
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	migrator, err := NewMigrator(nil, Migrations())
+
+	if assert.Nil(t, err) {
+		for i, migration := range migrator.migrations {
+			assert.Equal(t, i+1, migration.Version, "versions have no gap")
+			assert.NotEmpty(t, migration.Description)
+			assert.NotNil(t, migration.Up)
+			assert.NotNil(t, migration.Down)
+		}
+	}
+}
+
+// testDatabase will start a mongod for the test and return a random database of it.
+// the test is skipped when mongod can not be started, MEMONGO_MONGOD_BIN can point to a local binary
+func testDatabase(t *testing.T) *mongo.Database {
+	if testing.Short() {
+		t.Skip("mongod is not started in short mode")
+	}
+	server, err := memongo.StartWithOptions(&memongo.Options{
+		MongoVersion:   "4.4.13",
+		MongodBin:      os.Getenv("MEMONGO_MONGOD_BIN"),
+		StartupTimeout: 30 * time.Second,
+	})
+	if err != nil {
+		t.Skip("mongod is not available: ", err)
+	}
+	t.Cleanup(server.Stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(server.URI()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client.Database(memongo.RandomDatabase())
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, Migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3}, versions)
+
+	versions, err = migrator.Up(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, versions, "applied migrations are not run again")
+
+	statuses, err := migrator.Status(ctx)
+	assert.Nil(t, err)
+	if assert.Len(t, statuses, 3) {
+		for _, status := range statuses {
+			assert.NotNil(t, status.AppliedAt)
+		}
+	}
+
+	indexes, err := db.Collection("messages").Indexes().ListSpecifications(ctx)
+	assert.Nil(t, err)
+	var names []string
+	for _, index := range indexes {
+		names = append(names, index.Name)
+	}
+	assert.Subset(t, names, []string{"user_id_client_msg_id", "room_id_seq", "timestamp"})
+
+	_, err = db.Collection("users").InsertOne(ctx, bson.M{"name": "no email"})
+	assert.NotNil(t, err, "the validator rejects a user without an email")
+
+	version, err := migrator.Down(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, version)
+
+	_, err = db.Collection("users").InsertOne(ctx, bson.M{"name": "no email"})
+	assert.Nil(t, err, "the validator is removed")
+
+	statuses, err = migrator.Status(ctx)
+	assert.Nil(t, err)
+	if assert.Len(t, statuses, 3) {
+		assert.Nil(t, statuses[2].AppliedAt)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = migrator.Down(ctx)
+		assert.Nil(t, err)
+	}
+	_, err = migrator.Down(ctx)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,134 @@
+package mongodb
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// messageDoc is a messages document as stored. fields added over time are missing in older documents,
+// they decode to their zero value
+type messageDoc struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Message         string             `bson:"message"`
+	MessageHTML     string             `bson:"message_html"`
+	RoomID          string             `bson:"room_id"`
+	UserID          string             `bson:"user_id"`
+	Username        string             `bson:"username"`
+	UserImage       string             `bson:"user_image"`
+	Timestamp       time.Time          `bson:"timestamp"`
+	ClientTimestamp time.Time          `bson:"client_timestamp"`
+	Seq             int64              `bson:"seq"`
+	ClientMsgID     string             `bson:"client_msg_id"`
+	Mentions        []string           `bson:"mentions"`
+	// attachments and previews are decoded one by one, so a malformed entry does not lose the message
+	Attachments []bson.RawValue `bson:"attachments"`
+	Previews    []bson.RawValue `bson:"previews"`
+	PollID      string          `bson:"poll_id"`
+}
+
+// message will convert the document to the API type
+func (d messageDoc) message() Message {
+	message := Message{
+		ID:              d.ID.Hex(),
+		Message:         d.Message,
+		MessageHTML:     d.MessageHTML,
+		RoomID:          d.RoomID,
+		UserID:          d.UserID,
+		Username:        d.Username,
+		UserImage:       d.UserImage,
+		Timestamp:       d.Timestamp,
+		ClientTimestamp: d.ClientTimestamp,
+		Seq:             d.Seq,
+		ClientMsgID:     d.ClientMsgID,
+		Mentions:        d.Mentions,
+		PollID:          d.PollID,
+	}
+	for _, value := range d.Attachments {
+		var attachment Attachment
+		if err := value.Unmarshal(&attachment); err == nil {
+			message.Attachments = append(message.Attachments, attachment)
+		}
+	}
+	for _, value := range d.Previews {
+		var preview LinkPreview
+		if err := value.Unmarshal(&preview); err == nil {
+			message.Previews = append(message.Previews, preview)
+		}
+	}
+	return message
+}
+
+// DecodeMessage will decode a messages document, a field of the wrong type is an error
+func DecodeMessage(raw bson.Raw) (Message, error) {
+	var doc messageDoc
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return Message{}, err
+	}
+	return doc.message(), nil
+}
+
+// userDoc is a users document as stored
+type userDoc struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Email     string             `bson:"email"`
+	Username  string             `bson:"username"`
+	UserImage string             `bson:"user_image"`
+	Rooms     []string           `bson:"rooms"`
+}
+
+// user will convert the document to the API type
+func (d userDoc) user() User {
+	return User{
+		ID:        d.ID.Hex(),
+		Email:     d.Email,
+		Username:  d.Username,
+		UserImage: d.UserImage,
+		Rooms:     d.Rooms,
+	}
+}
+
+// DecodeUser will decode a users document, a field of the wrong type is an error
+func DecodeUser(raw bson.Raw) (User, error) {
+	var doc userDoc
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return User{}, err
+	}
+	return doc.user(), nil
+}
+
+// roomDoc is a rooms document as stored
+type roomDoc struct {
+	ID   primitive.ObjectID `bson:"_id"`
+	Name string             `bson:"name"`
+}
+
+// room will convert the document to the API type
+func (d roomDoc) room() Room {
+	return Room{ID: d.ID.Hex(), Name: d.Name}
+}
+
+// DecodeRoom will decode a rooms document, a field of the wrong type is an error
+func DecodeRoom(raw bson.Raw) (Room, error) {
+	var doc roomDoc
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return Room{}, err
+	}
+	return doc.room(), nil
+}
+
+// decodeEach will call decode with every document of the cursor and close it.
+// a document decode fails on is logged and skipped, one bad document does not fail the whole list
+func decodeEach(ctx context.Context, cursor *mongo.Cursor, decode func(raw bson.Raw) error) error {
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err := decode(cursor.Current); err != nil {
+			log.Println("skipping malformed document ", cursor.Current.Lookup("_id"), ": ", err)
+		}
+	}
+	return cursor.Err()
+}
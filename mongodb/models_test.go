@@ -0,0 +1,175 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func mustMarshal(t *testing.T, doc interface{}) bson.Raw {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestDecodeMessage(t *testing.T) {
+	id := primitive.NewObjectID()
+	timestamp := time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		Name        string
+		Doc         bson.M
+		MessageWant Message
+		WantErr     bool
+	}{
+		{
+			Name: "Complete message",
+			Doc: bson.M{
+				"_id": id, "message": "hi @budi", "message_html": "<p>hi @budi</p>", "room_id": "room1",
+				"user_id": "user1", "username": "ocean", "user_image": "localhost",
+				"timestamp": timestamp, "client_timestamp": timestamp.Add(-time.Second), "seq": int64(7),
+				"client_msg_id": "c1", "mentions": bson.A{"user2"}, "poll_id": "poll1",
+				"attachments": bson.A{bson.M{"id": "a1", "name": "cat.png", "size": int64(10)}},
+				"previews":    bson.A{bson.M{"url": "https://example.com", "title": "Example"}},
+			},
+			MessageWant: Message{
+				ID: id.Hex(), Message: "hi @budi", MessageHTML: "<p>hi @budi</p>", RoomID: "room1",
+				UserID: "user1", Username: "ocean", UserImage: "localhost",
+				Timestamp: timestamp, ClientTimestamp: timestamp.Add(-time.Second), Seq: 7,
+				ClientMsgID: "c1", Mentions: []string{"user2"}, PollID: "poll1",
+				Attachments: []Attachment{{ID: "a1", Name: "cat.png", Size: 10}},
+				Previews:    []LinkPreview{{URL: "https://example.com", Title: "Example"}},
+			},
+		},
+		{
+			Name:        "Missing fields are left empty",
+			Doc:         bson.M{"_id": id, "message": "hello"},
+			MessageWant: Message{ID: id.Hex(), Message: "hello"},
+		},
+		{
+			Name:        "Seq stored as int32",
+			Doc:         bson.M{"_id": id, "seq": int32(3)},
+			MessageWant: Message{ID: id.Hex(), Seq: 3},
+		},
+		{
+			Name: "Malformed attachments and previews are skipped",
+			Doc: bson.M{
+				"_id":         id,
+				"attachments": bson.A{"a1", bson.M{"id": "a2"}, bson.M{"size": "big"}},
+				"previews":    bson.A{42},
+			},
+			MessageWant: Message{ID: id.Hex(), Attachments: []Attachment{{ID: "a2"}}},
+		},
+		{
+			Name:    "Username of the wrong type",
+			Doc:     bson.M{"_id": id, "username": 42},
+			WantErr: true,
+		},
+		{
+			Name:    "Timestamp of the wrong type",
+			Doc:     bson.M{"_id": id, "timestamp": "yesterday"},
+			WantErr: true,
+		},
+		{
+			Name:    "Mentions of the wrong type",
+			Doc:     bson.M{"_id": id, "mentions": "user2"},
+			WantErr: true,
+		},
+		{
+			Name:    "Id of the wrong type",
+			Doc:     bson.M{"_id": "message1"},
+			WantErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			raw := mustMarshal(t, tc.Doc)
+
+			var message Message
+			var err error
+			assert.NotPanics(t, func() {
+				message, err = DecodeMessage(raw)
+			})
+
+			if tc.WantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.MessageWant, message)
+		})
+	}
+}
+
+func TestDecodeUser(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tt := []struct {
+		Name     string
+		Doc      bson.M
+		UserWant User
+		WantErr  bool
+	}{
+		{
+			Name:     "Complete user",
+			Doc:      bson.M{"_id": id, "email": "budi@example.com", "username": "budi", "user_image": "localhost", "rooms": bson.A{"room1", "room2"}},
+			UserWant: User{ID: id.Hex(), Email: "budi@example.com", Username: "budi", UserImage: "localhost", Rooms: []string{"room1", "room2"}},
+		},
+		{
+			Name:     "User without rooms and image",
+			Doc:      bson.M{"_id": id, "email": "budi@example.com", "username": "budi"},
+			UserWant: User{ID: id.Hex(), Email: "budi@example.com", Username: "budi"},
+		},
+		{
+			Name:    "Rooms of the wrong type",
+			Doc:     bson.M{"_id": id, "email": "budi@example.com", "rooms": "room1"},
+			WantErr: true,
+		},
+		{
+			Name:    "Room id of the wrong type",
+			Doc:     bson.M{"_id": id, "email": "budi@example.com", "rooms": bson.A{"room1", 2}},
+			WantErr: true,
+		},
+		{
+			Name:    "Email of the wrong type",
+			Doc:     bson.M{"_id": id, "email": bson.M{"address": "budi@example.com"}},
+			WantErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			raw := mustMarshal(t, tc.Doc)
+
+			var user User
+			var err error
+			assert.NotPanics(t, func() {
+				user, err = DecodeUser(raw)
+			})
+
+			if tc.WantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.UserWant, user)
+		})
+	}
+}
+
+func TestDecodeRoom(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	room, err := DecodeRoom(mustMarshal(t, bson.M{"_id": id, "name": "room1"}))
+	assert.Nil(t, err)
+	assert.Equal(t, Room{ID: id.Hex(), Name: "room1"}, room)
+
+	assert.NotPanics(t, func() {
+		_, err = DecodeRoom(mustMarshal(t, bson.M{"_id": id, "name": 1}))
+	})
+	assert.NotNil(t, err)
+}
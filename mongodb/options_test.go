@@ -0,0 +1,54 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientOptions(t *testing.T) {
+	dbConfig := config.MongoDb{
+		URI:                    "mongodb://myslack@localhost:27017/?authSource=admin",
+		Password:               "secret",
+		Name:                   "myslack-db",
+		MinPoolSize:            5,
+		MaxPoolSize:            50,
+		ConnectTimeout:         3 * time.Second,
+		ServerSelectionTimeout: 4 * time.Second,
+		TLS:                    true,
+		TLSInsecure:            true,
+	}
+
+	clientOptions, err := newClientOptions(dbConfig)
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, "myslack", clientOptions.Auth.Username)
+		assert.Equal(t, "secret", clientOptions.Auth.Password)
+		assert.Equal(t, "admin", clientOptions.Auth.AuthSource)
+		assert.Equal(t, uint64(5), *clientOptions.MinPoolSize)
+		assert.Equal(t, uint64(50), *clientOptions.MaxPoolSize)
+		assert.Equal(t, 3*time.Second, *clientOptions.ConnectTimeout)
+		assert.Equal(t, 4*time.Second, *clientOptions.ServerSelectionTimeout)
+		assert.True(t, clientOptions.TLSConfig.InsecureSkipVerify)
+	}
+}
+
+func TestNewClientOptionsInvalid(t *testing.T) {
+	tt := []struct {
+		Name   string
+		config config.MongoDb
+	}{
+		{Name: "Invalid config", config: config.MongoDb{URI: "localhost"}},
+		{Name: "Invalid uri", config: config.MongoDb{URI: "mongodb://localhost/?maxPoolSize=many", Name: "myslack-db", ConnectTimeout: time.Second, ServerSelectionTimeout: time.Second}},
+		{Name: "Missing ca file", config: config.MongoDb{URI: "mongodb://localhost", Name: "myslack-db", ConnectTimeout: time.Second, ServerSelectionTimeout: time.Second, TLS: true, TLSCAFile: "missing.pem"}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := newClientOptions(tc.config)
+
+			assert.NotNil(t, err)
+		})
+	}
+}
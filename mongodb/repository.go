@@ -0,0 +1,105 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RoomRepository stores the rooms
+type RoomRepository interface {
+	GetRooms(ctx context.Context) ([]Room, error)
+	GetRoom(ctx context.Context, filter interface{}) (*Room, error)
+	GetAnyRoom(ctx context.Context) (*Room, error)
+	AddRoom(ctx context.Context, roomName string) (string, error)
+	AddRooms(ctx context.Context, rooms []interface{}) ([]string, error)
+}
+
+// PinRepository stores the messages pinned in the rooms, on the room documents
+type PinRepository interface {
+	AddPin(ctx context.Context, roomId string, pin Pin, maxPins int) error
+	RemovePin(ctx context.Context, roomId string, messageId string) error
+	GetPins(ctx context.Context, roomId string) ([]Pin, error)
+}
+
+// MessageRepository stores the messages with the previews of their links
+type MessageRepository interface {
+	GetMessages(ctx context.Context, filter interface{}) ([]Message, error)
+	GetMessagesAfter(ctx context.Context, roomId string, messageId string, limit int) ([]Message, error)
+	NextMessageSeq(ctx context.Context, roomId string) (int64, error)
+	GetMessage(ctx context.Context, filter interface{}) (Message, error)
+	AddMessage(ctx context.Context, message interface{}) (string, error)
+	AddMessages(ctx context.Context, messages []interface{}) ([]string, error)
+	GetLinkPreview(ctx context.Context, url string) (*LinkPreview, error)
+	SaveLinkPreview(ctx context.Context, preview LinkPreview) error
+	SetMessagePreviews(ctx context.Context, messageId string, previews []LinkPreview) error
+}
+
+// AttachmentRepository stores the metadata of the files attached to messages, their content is in a blob store
+type AttachmentRepository interface {
+	AddAttachment(ctx context.Context, attachment interface{}) (string, error)
+	GetAttachment(ctx context.Context, filter interface{}) (*Attachment, error)
+}
+
+// UserRepository stores the users with the rooms they are a member of
+type UserRepository interface {
+	GetUsers(ctx context.Context, filter interface{}) ([]User, error)
+	GetUser(ctx context.Context, filter interface{}) (*User, error)
+	AddUser(ctx context.Context, user interface{}) (string, error)
+	FindOrAddUser(ctx context.Context, userAuth UserAuth) (*User, bool, error)
+	UpdateUser(ctx context.Context, filter interface{}, update interface{}, options *options.UpdateOptions) error
+	AddUsers(ctx context.Context, users []interface{}) ([]string, error)
+}
+
+// SavedItemRepository stores the messages users saved for later
+type SavedItemRepository interface {
+	AddSavedItem(ctx context.Context, item SavedItem) (string, error)
+	RemoveSavedItem(ctx context.Context, userId string, messageId string) error
+	GetSavedItems(ctx context.Context, userId string, before string, limit int) ([]SavedItem, error)
+	RemoveSavedItemsOfMessages(ctx context.Context, messageIds []string) error
+}
+
+// ScheduledMessageRepository stores the messages to post later, claimed one at a time by the scheduler
+type ScheduledMessageRepository interface {
+	AddScheduledMessage(ctx context.Context, scheduled ScheduledMessage) (string, error)
+	GetScheduledMessages(ctx context.Context, userId string) ([]ScheduledMessage, error)
+	DeleteScheduledMessage(ctx context.Context, id string, userId string) error
+	ClaimScheduledMessage(ctx context.Context, now time.Time, staleBefore time.Time) (*ScheduledMessage, error)
+	FinishScheduledMessage(ctx context.Context, id string, messageId string, failure string) error
+}
+
+// ReminderRepository stores the reminders on messages, claimed one at a time by the scheduler
+type ReminderRepository interface {
+	SetReminder(ctx context.Context, reminder Reminder) (*Reminder, error)
+	GetReminders(ctx context.Context, userId string) ([]Reminder, error)
+	DeleteReminder(ctx context.Context, userId string, messageId string) error
+	ClaimReminder(ctx context.Context, now time.Time, staleBefore time.Time) (*Reminder, error)
+	FinishReminder(ctx context.Context, id string, deliveredVia string, failure string) error
+}
+
+// PollRepository stores the polls and their votes
+type PollRepository interface {
+	AddPoll(ctx context.Context, poll Poll) (string, error)
+	GetPoll(ctx context.Context, id string) (*Poll, error)
+	DeletePoll(ctx context.Context, id string) error
+	SetPollMessage(ctx context.Context, pollId string, messageId string) error
+	SetPollVote(ctx context.Context, vote PollVote) error
+	GetPollVotes(ctx context.Context, pollId string) ([]PollVote, error)
+}
+
+// Repository is every repository, for the services working across them.
+// it is implemented by MongoDB, and in memory by package memdb
+type Repository interface {
+	RoomRepository
+	PinRepository
+	MessageRepository
+	AttachmentRepository
+	UserRepository
+	SavedItemRepository
+	ScheduledMessageRepository
+	ReminderRepository
+	PollRepository
+}
+
+var _ IMongoDB = (*MongoDB)(nil)
@@ -0,0 +1,205 @@
+package msgformat
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Render will convert Slack-like markup to HTML which is safe to embed:
+//
+//	*bold*  _italic_  ~strike~  `code`  ```code block```
+//	<https://example.com|label>  https://example.com  > quote
+//
+// every character of the source is escaped, only the tags produced here
+// (strong, em, del, code, pre, blockquote, a, br) end up in the output,
+// and links are limited to http and https.
+func Render(source string) string {
+	var b strings.Builder
+	segments := strings.Split(source, "```")
+	// an unmatched fence is kept as text
+	if len(segments)%2 == 0 {
+		last := len(segments) - 1
+		segments[last-1] = segments[last-1] + "```" + segments[last]
+		segments = segments[:last]
+	}
+
+	for i, segment := range segments {
+		if i%2 == 1 {
+			code := strings.TrimSuffix(strings.TrimPrefix(segment, "\n"), "\n")
+			b.WriteString("<pre><code>" + html.EscapeString(code) + "</code></pre>")
+			continue
+		}
+		// new lines next to a code block are part of the fence
+		if i > 0 {
+			segment = strings.TrimPrefix(segment, "\n")
+		}
+		if i < len(segments)-1 {
+			segment = strings.TrimSuffix(segment, "\n")
+		}
+		if segment != "" {
+			renderLines(&b, segment)
+		}
+	}
+	return b.String()
+}
+
+// renderLines will render text outside code blocks, lines starting with > are grouped in a blockquote
+func renderLines(b *strings.Builder, text string) {
+	var quote []string
+	needBreak := false
+	flushQuote := func() {
+		if len(quote) == 0 {
+			return
+		}
+		b.WriteString("<blockquote>")
+		for i, line := range quote {
+			if i > 0 {
+				b.WriteString("<br>")
+			}
+			renderInline(b, []rune(line))
+		}
+		b.WriteString("</blockquote>")
+		quote = nil
+		needBreak = false
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, ">") {
+			quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(line, ">"), " "))
+			continue
+		}
+		flushQuote()
+		if needBreak {
+			b.WriteString("<br>")
+		}
+		renderInline(b, []rune(line))
+		needBreak = true
+	}
+	flushQuote()
+}
+
+// emphasis maps a delimiter to its tag
+var emphasis = map[rune]string{
+	'*': "strong",
+	'_': "em",
+	'~': "del",
+}
+
+// renderInline will render one line: code spans, links and emphasis, everything else is escaped
+func renderInline(b *strings.Builder, r []rune) {
+	for i := 0; i < len(r); {
+		switch {
+		case r[i] == '`':
+			if j := indexRune(r, i+1, '`'); j > i+1 {
+				b.WriteString("<code>" + html.EscapeString(string(r[i+1:j])) + "</code>")
+				i = j + 1
+				continue
+			}
+		case r[i] == '<':
+			if j := indexRune(r, i+1, '>'); j > i+1 {
+				if href, label, ok := slackLink(string(r[i+1 : j])); ok {
+					writeLink(b, href, label)
+					i = j + 1
+					continue
+				}
+			}
+		case emphasis[r[i]] != "":
+			if j := closingDelimiter(r, i); j > 0 {
+				tag := emphasis[r[i]]
+				b.WriteString("<" + tag + ">")
+				renderInline(b, r[i+1:j])
+				b.WriteString("</" + tag + ">")
+				i = j + 1
+				continue
+			}
+		case r[i] == 'h' && (i == 0 || !isWordRune(r[i-1])):
+			if n := urlLength(r[i:]); n > 0 {
+				url := string(r[i : i+n])
+				writeLink(b, url, url)
+				i += n
+				continue
+			}
+		}
+		b.WriteString(html.EscapeString(string(r[i])))
+		i++
+	}
+}
+
+// closingDelimiter will find the end of the emphasis opened at i, or return -1.
+// like Slack, delimiters must hug the text and can not sit inside a word
+func closingDelimiter(r []rune, i int) int {
+	delimiter := r[i]
+	if i > 0 && isWordRune(r[i-1]) {
+		return -1
+	}
+	if i+1 >= len(r) || unicode.IsSpace(r[i+1]) {
+		return -1
+	}
+	for j := i + 2; j < len(r); j++ {
+		if r[j] != delimiter || unicode.IsSpace(r[j-1]) {
+			continue
+		}
+		if j+1 < len(r) && isWordRune(r[j+1]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// slackLink will parse the inside of <https://example.com|label>
+func slackLink(s string) (string, string, bool) {
+	href, label := s, s
+	if k := strings.Index(s, "|"); k >= 0 {
+		href, label = s[:k], s[k+1:]
+	}
+	if !isSafeURL(href) || strings.ContainsAny(href, " \t") || label == "" {
+		return "", "", false
+	}
+	return href, label, true
+}
+
+// urlLength is the length of the http(s) url at the start of r, trailing punctuation is not part of it
+func urlLength(r []rune) int {
+	n := 0
+	for n < len(r) && !unicode.IsSpace(r[n]) && r[n] != '<' && r[n] != '>' {
+		n++
+	}
+	for n > 0 && strings.ContainsRune(".,;:!?)'\"", r[n-1]) {
+		n--
+	}
+	url := string(r[:n])
+	if !isSafeURL(url) {
+		return 0
+	}
+	return n
+}
+
+// isSafeURL allows http and https links only, so javascript: and data: never reach an href
+func isSafeURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range []string{"http://", "https://"} {
+		if strings.HasPrefix(lower, scheme) && len(url) > len(scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeLink(b *strings.Builder, href string, label string) {
+	b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="noopener noreferrer">` + html.EscapeString(label) + "</a>")
+}
+
+func indexRune(r []rune, from int, target rune) int {
+	for j := from; j < len(r); j++ {
+		if r[j] == target {
+			return j
+		}
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,41 @@
+package msgformat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Source string
+		Want   string
+	}{
+		{"Plain text", "hello", "hello"},
+		{"Escaped html", `<b>hi</b> & "you"`, "&lt;b&gt;hi&lt;/b&gt; &amp; &#34;you&#34;"},
+		{"Script tag", "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"Bold", "a *bold* word", "a <strong>bold</strong> word"},
+		{"Italic", "_italic_", "<em>italic</em>"},
+		{"Strike", "~gone~", "<del>gone</del>"},
+		{"Nested", "*bold _and italic_*", "<strong>bold <em>and italic</em></strong>"},
+		{"Delimiter inside word", "snake_case_name and 2*3*4", "snake_case_name and 2*3*4"},
+		{"Delimiter next to space", "* not bold *", "* not bold *"},
+		{"Escaped inside bold", "*<i>*", "<strong>&lt;i&gt;</strong>"},
+		{"Inline code", "run `*x* <y>`", "run <code>*x* &lt;y&gt;</code>"},
+		{"Code block", "look:\n```\nif a < b {\n}\n```\ndone", "look:<pre><code>if a &lt; b {\n}</code></pre>done"},
+		{"Unmatched fence", "a ``` b", "a ``` b"},
+		{"Quote", "> quoted\n> *twice*\nafter", "<blockquote>quoted<br><strong>twice</strong></blockquote>after"},
+		{"Line breaks", "a\n\nb", "a<br><br>b"},
+		{"Bare link", "see https://example.com/a?b=1&c=2.", `see <a href="https://example.com/a?b=1&amp;c=2" rel="noopener noreferrer">https://example.com/a?b=1&amp;c=2</a>.`},
+		{"Labelled link", "<https://example.com|the *site*>", `<a href="https://example.com" rel="noopener noreferrer">the *site*</a>`},
+		{"Javascript link", "<javascript:alert(1)|click>", "&lt;javascript:alert(1)|click&gt;"},
+		{"Quote in link", `<https://x.com/"onmouseover="alert(1)|x>`, `<a href="https://x.com/&#34;onmouseover=&#34;alert(1)" rel="noopener noreferrer">x</a>`},
+		{"Not a link", "httpd is up", "httpd is up"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Want, Render(tc.Source))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package msgformat
+
+import (
+	"strings"
+)
+
+// ParseLinks will find the http(s) links of source, bare or written as <url|label>,
+// in order of appearance and without duplicates. code spans and blocks are skipped
+func ParseLinks(source string) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	for i, segment := range strings.Split(source, "```") {
+		if i%2 == 1 {
+			continue
+		}
+		for j, text := range strings.Split(segment, "`") {
+			if j%2 == 1 {
+				continue
+			}
+			for _, link := range findLinks([]rune(text)) {
+				if !seen[link] {
+					seen[link] = true
+					links = append(links, link)
+				}
+			}
+		}
+	}
+	return links
+}
+
+// findLinks will return the links of r, recognized the same way as renderInline does
+func findLinks(r []rune) []string {
+	var links []string
+	for i := 0; i < len(r); i++ {
+		switch {
+		case r[i] == '<':
+			if j := indexRune(r, i+1, '>'); j > i+1 {
+				if href, _, ok := slackLink(string(r[i+1 : j])); ok {
+					links = append(links, href)
+					i = j
+				}
+			}
+		case r[i] == 'h' && (i == 0 || !isWordRune(r[i-1])):
+			if n := urlLength(r[i:]); n > 0 {
+				links = append(links, string(r[i:i+n]))
+				i += n - 1
+			}
+		}
+	}
+	return links
+}
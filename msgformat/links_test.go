@@ -0,0 +1,27 @@
+package msgformat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinks(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Source string
+		Want   []string
+	}{
+		{Name: "Bare link", Source: "see https://example.com/a?b=1.", Want: []string{"https://example.com/a?b=1"}},
+		{Name: "Slack link", Source: "<https://example.com|docs> and <http://example.org>", Want: []string{"https://example.com", "http://example.org"}},
+		{Name: "Duplicates", Source: "https://example.com https://example.com", Want: []string{"https://example.com"}},
+		{Name: "Code is skipped", Source: "`https://a.example` ```https://b.example``` https://c.example", Want: []string{"https://c.example"}},
+		{Name: "Unsafe scheme", Source: "<javascript:alert(1)|x> ftp://example.com", Want: nil},
+		{Name: "Inside a word", Source: "xhttps://example.com", Want: nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Want, ParseLinks(tc.Source))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package msgformat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Mentions are the @ tokens found in a message
+type Mentions struct {
+	// Usernames without the @, in order of appearance and without duplicates
+	Usernames []string
+	// Here is @here: the room members connected right now
+	Here bool
+	// Room is @room: every member of the room
+	Room bool
+}
+
+// Any tells whether the message mentions anybody
+func (m Mentions) Any() bool {
+	return len(m.Usernames) > 0 || m.Here || m.Room
+}
+
+// ParseMentions will find @username, @here and @room in source, code spans and blocks are skipped
+func ParseMentions(source string) Mentions {
+	var mentions Mentions
+	seen := make(map[string]bool)
+
+	for i, segment := range strings.Split(source, "```") {
+		if i%2 == 1 {
+			continue
+		}
+		for j, text := range strings.Split(segment, "`") {
+			if j%2 == 1 {
+				continue
+			}
+			for _, username := range findMentions([]rune(text)) {
+				switch username {
+				case "here":
+					mentions.Here = true
+				case "room":
+					mentions.Room = true
+				default:
+					if !seen[username] {
+						seen[username] = true
+						mentions.Usernames = append(mentions.Usernames, username)
+					}
+				}
+			}
+		}
+	}
+	return mentions
+}
+
+// findMentions will return the names after every @ which starts a word, so emails do not count
+func findMentions(r []rune) []string {
+	var usernames []string
+	for i := 0; i < len(r); i++ {
+		if r[i] != '@' || (i > 0 && isUsernameRune(r[i-1])) {
+			continue
+		}
+		j := i + 1
+		for j < len(r) && isUsernameRune(r[j]) {
+			j++
+		}
+		// a sentence may end right after the name
+		for j > i+1 && strings.ContainsRune(".-", r[j-1]) {
+			j--
+		}
+		if j > i+1 {
+			usernames = append(usernames, string(r[i+1:j]))
+		}
+		i = j - 1
+	}
+	return usernames
+}
+
+func isUsernameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-'
+}
@@ -0,0 +1,30 @@
+package msgformat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	tt := []struct {
+		Name   string
+		Source string
+		Want   Mentions
+	}{
+		{"No mention", "hello", Mentions{}},
+		{"Username", "hi @budi, how are you?", Mentions{Usernames: []string{"budi"}}},
+		{"Dotted username at end of sentence", "ask @ocean.king.digital.", Mentions{Usernames: []string{"ocean.king.digital"}}},
+		{"Duplicates", "@budi @budi @lumion", Mentions{Usernames: []string{"budi", "lumion"}}},
+		{"Here and room", "@here and @room", Mentions{Here: true, Room: true}},
+		{"Email is not a mention", "mail budi@gmail.com", Mentions{}},
+		{"Inline code", "`@budi` @lumion", Mentions{Usernames: []string{"lumion"}}},
+		{"Code block", "```\n@room\n``` @here", Mentions{Here: true}},
+		{"Lone at", "@ everyone", Mentions{}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.Want, ParseMentions(tc.Source))
+		})
+	}
+}
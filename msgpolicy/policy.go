@@ -0,0 +1,90 @@
+package msgpolicy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrEmptyMessage   = errors.New("message is empty")
+	ErrMessageTooLong = errors.New("message is too long")
+)
+
+// frameOverhead is room for the other fields of a client frame (ids, username, user_image, ...)
+const frameOverhead = 4096
+
+// Policy validates and cleans the text of chat messages, every message goes through Apply before it is stored
+type Policy struct {
+	config config.MessagePolicy
+	form   *norm.Form
+}
+
+// New will initialize Policy, it fails for an unknown normalization form
+func New(messagePolicy config.MessagePolicy) (*Policy, error) {
+	policy := &Policy{config: messagePolicy}
+	switch strings.ToUpper(messagePolicy.Normalization) {
+	case "", "NONE":
+	case "NFC":
+		form := norm.NFC
+		policy.form = &form
+	case "NFKC":
+		form := norm.NFKC
+		policy.form = &form
+	default:
+		return nil, fmt.Errorf("unknown unicode normalization form: %v", messagePolicy.Normalization)
+	}
+	if messagePolicy.MaxLength <= 0 {
+		return nil, fmt.Errorf("message max length must be positive: %v", messagePolicy.MaxLength)
+	}
+	return policy, nil
+}
+
+// Apply will return the cleaned message text, or an error telling why it is rejected
+func (p *Policy) Apply(text string) (string, error) {
+	text = strings.ToValidUTF8(text, string(utf8.RuneError))
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if p.config.StripControl {
+		text = strings.Map(stripControl, text)
+	}
+	if p.form != nil {
+		text = p.form.String(text)
+	}
+	if p.config.Trim {
+		text = strings.TrimSpace(text)
+	}
+
+	if !p.config.AllowEmpty && strings.TrimSpace(text) == "" {
+		return "", ErrEmptyMessage
+	}
+	if length := utf8.RuneCountInString(text); length > p.config.MaxLength {
+		return "", fmt.Errorf("%w: %v characters, at most %v allowed", ErrMessageTooLong, length, p.config.MaxLength)
+	}
+	return text, nil
+}
+
+// ReadLimit is the websocket frame size needed for the longest allowed message,
+// a rune is up to 6 bytes once JSON escaped
+func (p *Policy) ReadLimit() int64 {
+	return int64(p.config.MaxLength)*6 + frameOverhead
+}
+
+func (p *Policy) String() string {
+	return p.config.String()
+}
+
+// stripControl drops control characters except line feed and tab
+func stripControl(r rune) rune {
+	if r == '\n' || r == '\t' {
+		return r
+	}
+	if unicode.IsControl(r) {
+		return -1
+	}
+	return r
+}
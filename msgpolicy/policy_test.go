@@ -0,0 +1,82 @@
+package msgpolicy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func defaultConfig() config.MessagePolicy {
+	return config.MessagePolicy{MaxLength: 10, Trim: true, StripControl: true, Normalization: "NFC"}
+}
+
+func TestApply(t *testing.T) {
+	tt := []struct {
+		Name     string
+		config   config.MessagePolicy
+		Text     string
+		TextWant string
+		ErrWant  error
+	}{
+		{Name: "Plain text", config: defaultConfig(), Text: "hello", TextWant: "hello"},
+		{Name: "Trim", config: defaultConfig(), Text: "  hello \n", TextWant: "hello"},
+		{Name: "Keep inner new lines", config: defaultConfig(), Text: "a\r\nb\tc", TextWant: "a\nb\tc"},
+		{Name: "Strip control characters", config: defaultConfig(), Text: "he\x00l\x1bl\x7fo", TextWant: "hello"},
+		{Name: "NFC normalization", config: defaultConfig(), Text: "café", TextWant: "café"},
+		{Name: "Length counted after normalization", config: defaultConfig(), Text: "éééééé", TextWant: strings.Repeat("é", 6)},
+		{Name: "Empty", config: defaultConfig(), Text: "", ErrWant: ErrEmptyMessage},
+		{Name: "Only spaces and control characters", config: defaultConfig(), Text: " \x00 \n ", ErrWant: ErrEmptyMessage},
+		{Name: "Too long", config: defaultConfig(), Text: "hello world", ErrWant: ErrMessageTooLong},
+		{
+			Name:     "Empty allowed",
+			config:   config.MessagePolicy{MaxLength: 10, Trim: true, AllowEmpty: true},
+			Text:     "  ",
+			TextWant: "",
+		},
+		{
+			Name:     "No trim, no strip",
+			config:   config.MessagePolicy{MaxLength: 10, Normalization: "none"},
+			Text:     " a\x00 ",
+			TextWant: " a\x00 ",
+		},
+		{
+			Name:     "NFKC normalization",
+			config:   config.MessagePolicy{MaxLength: 10, Normalization: "NFKC"},
+			Text:     "ﬁne",
+			TextWant: "fine",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			policy, err := New(tc.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			text, err := policy.Apply(tc.Text)
+
+			if tc.ErrWant != nil {
+				assert.True(t, errors.Is(err, tc.ErrWant), "error want: %v, got: %v", tc.ErrWant, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.TextWant, text)
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	_, err := New(config.MessagePolicy{MaxLength: 10, Normalization: "NFX"})
+	assert.NotNil(t, err)
+
+	_, err = New(config.MessagePolicy{MaxLength: 0})
+	assert.NotNil(t, err)
+}
+
+func TestReadLimit(t *testing.T) {
+	policy, _ := New(defaultConfig())
+	assert.True(t, policy.ReadLimit() > 10*4)
+}
@@ -1,15 +1,19 @@
 package msgserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pranotobudi/myslack-happy-backend/config"
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+	"github.com/pranotobudi/myslack-happy-backend/ratelimit"
 )
 
 type wsClient struct {
@@ -37,8 +41,68 @@ type wsClient struct {
 	// Buffered channel of outbound messages.
 	// send chan []byte
 	// send chan ClientMsg
-	send        chan mongodb.Message
-	mongodbConn *mongodb.MongoDB
+	// messages and events (mongodb.Message, MentionEvent, ...) from the hub
+	send        chan interface{}
+	mongodbConn Store
+
+	// close frame written by writePump when the hub closes send, empty unless the hub is shutting down
+	closeMsg []byte
+
+	// lastSeen comes with the [USERINFO] hello frame: room_id -> last message id the client received.
+	// while replaying, broadcasts from the hub are held in pending and written after the missed messages
+	lastSeen  map[string]string
+	replayReq chan map[string]string
+	mu        sync.Mutex
+	replaying bool
+	pending   []interface{}
+	// maxPending bounds pending like the capacity of send bounds live delivery, a client above it is dropped
+	maxPending int
+	// maxReplay bounds the missed messages replayed per room
+	maxReplay int
+
+	// reply carries frames for this client only (ack, nack), done is closed when writePump returns
+	reply chan interface{}
+	done  chan struct{}
+
+	// limits is nil when frames are not rate limited, violations counts limited frames in a row
+	limits     *wsLimits
+	connBucket *ratelimit.Bucket
+	violations int
+
+	// policy cleans and validates message text before it is stored, nil keeps the text as is
+	policy *msgpolicy.Policy
+
+	// unfurler gets every stored message to add link previews in the background, nil disables it
+	unfurler Unfurler
+
+	// ctx lives as long as the connection, the database work of a frame is bounded by dbTimeout as well
+	ctx       context.Context
+	cancel    context.CancelFunc
+	dbTimeout time.Duration
+}
+
+// Unfurler adds link previews to a message after it was stored and broadcast,
+// it must not block: the room is locked while a message is added
+type Unfurler interface {
+	Enqueue(msg mongodb.Message)
+}
+
+// wsLimits holds the websocket rate limits, roomLimiter is shared by every connection
+type wsLimits struct {
+	roomLimiter     *ratelimit.Limiter
+	connPerSecond   float64
+	connBurst       int
+	disconnectAfter int
+}
+
+// newWsLimits will initialize wsLimits from the rate limit config
+func newWsLimits(rateLimit config.RateLimit) *wsLimits {
+	return &wsLimits{
+		roomLimiter:     ratelimit.NewLimiter(rateLimit.WsRoomPerSecond, rateLimit.WsRoomBurst),
+		connPerSecond:   rateLimit.WsConnPerSecond,
+		connBurst:       rateLimit.WsConnBurst,
+		disconnectAfter: rateLimit.WsDisconnectAfter,
+	}
 }
 
 var (
@@ -46,8 +110,18 @@ var (
 	space   = []byte{' '}
 )
 
+// maxAttachments is how many uploaded files a single message can carry
+const maxAttachments = 10
+
+// sendBuffer is how many frames from the hub wait for writePump, a client falling further behind is dropped
+const sendBuffer = 256
+
+// maxReplay is how many missed messages of a room are replayed on reconnect, the client fetches more through GET /messages
+const maxReplay = 500
+
 // NewWsClient will initiate new client of this websocket connection
-func NewWsClient(conn *websocket.Conn, hub *Hub, mongodbConn *mongodb.MongoDB) *wsClient {
+func NewWsClient(conn *websocket.Conn, hub *Hub, mongodbConn Store) *wsClient {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &wsClient{
 		conn:              conn,
 		clientId:          "",
@@ -68,25 +142,56 @@ func NewWsClient(conn *websocket.Conn, hub *Hub, mongodbConn *mongodb.MongoDB) *
 
 		// Buffered channel of outbound messages.
 		// send: make(chan []byte, 256),
-		send:        make(chan mongodb.Message),
+		send:        make(chan interface{}, sendBuffer),
+		maxPending:  sendBuffer,
+		maxReplay:   maxReplay,
 		mongodbConn: mongodbConn,
+		closeMsg:    []byte{},
+		replayReq:   make(chan map[string]string, 1),
+		reply:       make(chan interface{}, 16),
+		done:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		dbTimeout:   10 * time.Second,
+	}
+}
+
+type IWsHandler interface {
+	InitWebsocket(w http.ResponseWriter, r *http.Request)
+}
+type wsHandler struct {
+	hub       *Hub
+	repo      Store
+	limits    *wsLimits
+	policy    *msgpolicy.Policy
+	unfurler  Unfurler
+	dbTimeout time.Duration
+}
+
+// NewWsHandler will initialize wsHandler object, every connection is served by the same hub and repo.
+// unfurler may be nil
+func NewWsHandler(hub *Hub, repo Store, policy *msgpolicy.Policy, unfurler Unfurler, rateLimit config.RateLimit, timeout config.Timeout) *wsHandler {
+	return &wsHandler{
+		hub:       hub,
+		repo:      repo,
+		limits:    newWsLimits(rateLimit),
+		policy:    policy,
+		unfurler:  unfurler,
+		dbTimeout: timeout.Websocket,
 	}
 }
 
 // InitWebsocket will initialize websocket chat system
-func InitWebsocket(w http.ResponseWriter, r *http.Request) {
+func (h *wsHandler) InitWebsocket(w http.ResponseWriter, r *http.Request) {
 
 	// init websocket
 	log.Println("initWebsocket")
 	//mongoDB
-	mongodbConn := mongodb.NewMongoDB()
-	// mongodbConn := mongodb.MongoDBInstance
-	// mongodbConn.DataSeeder()
+	mongodbConn := h.repo
 
 	// chat server
-	// #1 init global message server as goroutine. this server will be an argument for each client
-	hub := NewHub()
-	go hub.Run()
+	// #1 the global message server is started by the application and shared by every client
+	hub := h.hub
 
 	var upgrader websocket.Upgrader
 	upgrader = websocket.Upgrader{
@@ -106,14 +211,30 @@ func InitWebsocket(w http.ResponseWriter, r *http.Request) {
 
 	// notify hub for client initiation event
 	client := NewWsClient(conn, hub, mongodbConn)
+	client.setLimits(h.limits)
+	client.setPolicy(h.policy)
+	client.unfurler = h.unfurler
+	client.dbTimeout = h.dbTimeout
 	// hub.addClient("room1", client)
 	// log.Println("register client to hub (will load client snapshot to hub)...", client)
 	// client.hub.register <- client
+	client.start()
+}
+
+// start will hand the client over to the hub and run its pumps.
+// when the hub is already stopped the connection is refused with CloseGoingAway
+func (c *wsClient) start() {
+	if !c.hub.attach(c) {
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(c.writeWait))
+		c.conn.Close()
+		return
+	}
 
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
-	go client.writePump()
-	go client.readPump()
+	go c.writePump()
+	go c.readPump()
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -124,8 +245,11 @@ func InitWebsocket(w http.ResponseWriter, r *http.Request) {
 func (c *wsClient) readPump() {
 	log.Println("ReadPump run...")
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.detach(c)
 		c.conn.Close()
+		// stops the database work of the connection, a replay included
+		c.cancel()
+		c.hub.pumps.Done()
 	}()
 	c.conn.SetReadLimit(c.maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(c.pongWait))
@@ -136,6 +260,11 @@ func (c *wsClient) readPump() {
 		err := c.conn.ReadJSON(&clientMsg)
 		log.Println(fmt.Sprintf("clientMsg: %+v", clientMsg))
 		log.Println("text: ", clientMsg.Message, "roomID: ", clientMsg.RoomID, " userID: ", clientMsg.UserID, "timestamp: ", clientMsg.Timestamp)
+		if err == websocket.ErrReadLimit {
+			// far above the policy max length, the websocket library already sent CloseMessageTooBig
+			log.Println("inside readPump - frame above read limit: ", c.maxMessageSize)
+			break
+		}
 		if err != nil {
 			log.Println("inside readPump - ERROR READJSON")
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -144,40 +273,41 @@ func (c *wsClient) readPump() {
 			break
 		}
 
+		if !c.allow(clientMsg) {
+			c.violations++
+			log.Println("inside readPump - rate limited, user: ", clientMsg.UserID, " room: ", clientMsg.RoomID, " violations: ", c.violations)
+			c.sendReply(newErrorFrame(clientMsg.ClientMsgID, errorRateLimited, "too many messages, slow down"))
+			if c.limits.disconnectAfter > 0 && c.violations >= c.limits.disconnectAfter {
+				// WriteControl is safe to call next to writePump
+				closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+				c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(c.writeWait))
+				break
+			}
+			continue
+		}
+		c.violations = 0
+
+		if clientMsg.Message == "[USERINFO]" && c.clientId != "" && clientMsg.UserID != c.clientId {
+			// a connection is one user, switching would give it the fresh rate limit bucket of another user
+			c.sendReply(newErrorFrame(clientMsg.ClientMsgID, errorInvalidUser, "the connection is registered as another user"))
+			continue
+		}
+		if clientMsg.Message != "[USERINFO]" && (c.clientId == "" || clientMsg.UserID != c.clientId) {
+			log.Println("inside readPump - message of another user rejected, user: ", clientMsg.UserID, " client: ", c.clientId)
+			c.sendReply(newErrorFrame(clientMsg.ClientMsgID, errorInvalidUser, "user_id must be the user registered by [USERINFO]"))
+			continue
+		}
+
 		if clientMsg.Message == "[USERINFO]" {
 			// special message - initial message for user info
 			c.clientId = clientMsg.UserID
+			c.lastSeen = clientMsg.LastSeen
 			log.Println("inside readPump - special Message: ", c.clientId)
 			log.Println("register client to hub (will load client snapshot to hub)...", c)
-			c.hub.register <- c
+			c.hub.join(c)
 		} else {
 			// normal message
-
-			// save to mongoDB
-			message := bson.D{{"message", clientMsg.Message}, {"user_id", clientMsg.UserID}, {"room_id", clientMsg.RoomID}, {"username", clientMsg.Username}, {"user_image", clientMsg.UserImage}, {"timestamp", clientMsg.Timestamp}}
-			docId, err := c.mongodbConn.AddMessage(message)
-			if err != nil {
-				log.Println("inside readPump - normal Message, add message to MongoDB FAILED")
-			}
-			log.Println("inside readPump - normal Message, add message to MongoDB success, id: ", docId)
-			// TODO
-
-			// convert clientMessage to Message
-
-			objID, err := primitive.ObjectIDFromHex(docId)
-			if err != nil {
-				log.Println(err)
-			}
-
-			filter := bson.M{"_id": objID}
-			messageWithId, err := c.mongodbConn.GetMessage(filter)
-			if err != nil {
-				log.Println("failed to getMessage: ", err)
-			}
-
-			// broadcast to other clients
-			c.hub.broadcastMsg <- messageWithId
-			log.Println("inside readPump - normal Message: ", messageWithId)
+			c.addMessage(clientMsg)
 		}
 		// _, message, err := c.conn.ReadMessage()
 		// message := clientMsg.Text
@@ -186,6 +316,73 @@ func (c *wsClient) readPump() {
 	}
 }
 
+// setLimits will rate limit the frames of this client, nil disables it
+func (c *wsClient) setLimits(limits *wsLimits) {
+	c.limits = limits
+	if limits != nil {
+		c.connBucket = ratelimit.NewBucket(limits.connPerSecond, limits.connBurst)
+	}
+}
+
+// setPolicy will validate messages of this client with policy, the read limit follows its max length
+func (c *wsClient) setPolicy(policy *msgpolicy.Policy) {
+	c.policy = policy
+	if policy != nil {
+		c.maxMessageSize = policy.ReadLimit()
+	}
+}
+
+// allow will take a token for the frame from the connection bucket
+// and, for messages posted to a room, from the bucket of the registered user in that room.
+// the user_id of the frame is not the key, a connection could change it on every frame to get a full bucket
+func (c *wsClient) allow(clientMsg mongodb.ClientMessage) bool {
+	if c.limits == nil {
+		return true
+	}
+	if !c.connBucket.Allow() {
+		return false
+	}
+	if clientMsg.Message == "[USERINFO]" || c.clientId == "" || clientMsg.UserID != c.clientId {
+		// readPump rejects a frame of another user, it only counts for the connection
+		return true
+	}
+	return c.limits.roomLimiter.Allow(c.clientId + ":" + clientMsg.RoomID)
+}
+
+// frameContext will bound the database work of one frame, it is cancelled as well when the connection closes
+func (c *wsClient) frameContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.ctx, c.dbTimeout)
+}
+
+// addMessage will save the client message to mongoDB, acknowledge it to the sender
+// and broadcast it to the room. a retried client_msg_id is acknowledged again but not broadcast
+func (c *wsClient) addMessage(clientMsg mongodb.ClientMessage) {
+	ctx, cancel := c.frameContext()
+	defer cancel()
+	p := &poster{hub: c.hub, repo: c.mongodbConn, policy: c.policy, unfurler: c.unfurler}
+	_, err := p.post(ctx, clientMsg, func(messageId string, duplicate bool) {
+		c.sendReply(newAck(clientMsg.ClientMsgID, messageId, duplicate))
+	})
+	var rejected *rejectedError
+	if errors.As(err, &rejected) {
+		log.Println("inside readPump - normal Message rejected: ", err)
+		c.sendReply(newErrorFrame(clientMsg.ClientMsgID, rejected.code, rejected.Error()))
+		return
+	}
+	if err != nil {
+		log.Println("inside readPump - normal Message, add message FAILED: ", err)
+		c.sendReply(newNack(clientMsg.ClientMsgID, err.Error()))
+	}
+}
+
+// sendReply will queue a frame for this client only, it gives up once writePump is gone
+func (c *wsClient) sendReply(frame interface{}) {
+	select {
+	case c.reply <- frame:
+	case <-c.done:
+	}
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 //
 // A goroutine running writePump is started for each connection. The
@@ -197,6 +394,7 @@ func (c *wsClient) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		close(c.done)
 	}()
 	for {
 		select {
@@ -205,7 +403,7 @@ func (c *wsClient) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMsg)
 				return
 			}
 			err := c.conn.WriteJSON(clientMsg)
@@ -231,6 +429,16 @@ func (c *wsClient) writePump() {
 			// if err := w.Close(); err != nil {
 			// 	return
 			// }
+		case frame := <-c.reply:
+			if err := c.write(frame); err != nil {
+				log.Println("inside writePump.. reply err: ", err.Error())
+				return
+			}
+		case lastSeen := <-c.replayReq:
+			if err := c.replayMissed(lastSeen); err != nil {
+				log.Println("inside writePump.. replay err: ", err.Error())
+				return
+			}
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -239,3 +447,105 @@ func (c *wsClient) writePump() {
 		}
 	}
 }
+
+// deliver will queue msg for writePump, it is called by the hub only.
+// it returns false when the client can not keep up, while replaying as well
+func (c *wsClient) deliver(frame interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replaying {
+		if len(c.pending) >= c.maxPending {
+			// the hub drops the client, what was held back is not written anymore
+			c.pending = nil
+			return false
+		}
+		c.pending = append(c.pending, frame)
+		return true
+	}
+	select {
+	case c.send <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+// requestReplay will hold back live messages and ask writePump to replay the missed ones
+func (c *wsClient) requestReplay(lastSeen map[string]string) {
+	c.mu.Lock()
+	c.replaying = true
+	c.mu.Unlock()
+	select {
+	case c.replayReq <- lastSeen:
+	default:
+		// a replay is already waiting, it will flush pending as well
+		log.Println("requestReplay - replay already requested, client: ", c.clientId)
+	}
+}
+
+// replayMissed will write the messages newer than lastSeen from mongoDB, up to maxReplay per room,
+// then the live messages held back meanwhile, skipping the ones already replayed.
+// a room with more missed messages gets a replay_truncated event after the replayed ones.
+// the client was added to its rooms before the query, so nothing falls in between
+func (c *wsClient) replayMissed(lastSeen map[string]string) error {
+	replayed := make(map[string]bool)
+	for roomId, messageId := range lastSeen {
+		messages, err := c.getMessagesAfter(roomId, messageId)
+		if err != nil {
+			log.Println("replayMissed - failed to get messages, room: ", roomId, " err: ", err)
+			continue
+		}
+		// one more than replayed tells whether the replay is truncated
+		truncated := len(messages) > c.maxReplay
+		if truncated {
+			messages = messages[:c.maxReplay]
+		}
+		log.Println("replayMissed - room: ", roomId, " missed messages: ", len(messages), " truncated: ", truncated)
+		for _, message := range messages {
+			replayed[message.ID] = true
+			if err := c.write(message); err != nil {
+				return err
+			}
+		}
+		if truncated {
+			if err := c.write(newReplayTruncatedEvent(roomId)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		if len(pending) == 0 {
+			// switch to live delivery
+			c.replaying = false
+			c.mu.Unlock()
+			return nil
+		}
+		c.mu.Unlock()
+
+		for _, frame := range pending {
+			if message, ok := frame.(mongodb.Message); ok && replayed[message.ID] {
+				continue
+			}
+			if err := c.write(frame); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// getMessagesAfter will get up to maxReplay+1 messages of the room newer than messageId, within the deadline of a frame
+func (c *wsClient) getMessagesAfter(roomId string, messageId string) ([]mongodb.Message, error) {
+	ctx, cancel := c.frameContext()
+	defer cancel()
+	return c.mongodbConn.GetMessagesAfter(ctx, roomId, messageId, c.maxReplay+1)
+}
+
+// write will write one frame to the peer, only writePump may call it
+func (c *wsClient) write(frame interface{}) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+	return c.conn.WriteJSON(frame)
+}
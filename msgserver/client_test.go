@@ -0,0 +1,1008 @@
+package msgserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	getUserRepoFunc          func(filter interface{}) (*mongodb.User, error)
+	getMessagesAfterRepoFunc func(roomId string, messageId string, limit int) ([]mongodb.Message, error)
+	addMessageRepoFunc       func(message interface{}) (string, error)
+	getMessageRepoFunc       func(filter interface{}) (mongodb.Message, error)
+	nextMessageSeqRepoFunc   func(roomId string) (int64, error)
+	getUsersRepoFunc         func(filter interface{}) ([]mongodb.User, error)
+	getAttachmentRepoFunc    func(filter interface{}) (*mongodb.Attachment, error)
+)
+
+type mockRepo struct {
+	mongodb.MessageRepository
+	mongodb.AttachmentRepository
+	mongodb.UserRepository
+}
+
+func (m *mockRepo) GetUser(ctx context.Context, filter interface{}) (*mongodb.User, error) {
+	return getUserRepoFunc(filter)
+}
+func (m *mockRepo) GetMessagesAfter(ctx context.Context, roomId string, messageId string, limit int) ([]mongodb.Message, error) {
+	return getMessagesAfterRepoFunc(roomId, messageId, limit)
+}
+
+func (m *mockRepo) AddMessage(ctx context.Context, message interface{}) (string, error) {
+	return addMessageRepoFunc(message)
+}
+func (m *mockRepo) GetMessage(ctx context.Context, filter interface{}) (mongodb.Message, error) {
+	return getMessageRepoFunc(filter)
+}
+
+func (m *mockRepo) NextMessageSeq(ctx context.Context, roomId string) (int64, error) {
+	return nextMessageSeqRepoFunc(roomId)
+}
+
+func (m *mockRepo) GetUsers(ctx context.Context, filter interface{}) ([]mongodb.User, error) {
+	return getUsersRepoFunc(filter)
+}
+
+func (m *mockRepo) GetAttachment(ctx context.Context, filter interface{}) (*mongodb.Attachment, error) {
+	return getAttachmentRepoFunc(filter)
+}
+
+// registerTestClient will send the [USERINFO] frame of userId on conn and wait until hub registered it,
+// a connection only posts as its registered user. conn is subscribed to the lobby room only, the user is then
+// a member of room1 as well to post there, so conn only gets the replies to its own frames
+func registerTestClient(t *testing.T, hub *Hub, conn *websocket.Conn, userId string) {
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: userId, Rooms: []string{"lobby"}}, nil
+	}
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "[USERINFO]", UserID: userId}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !contains(hub.onlineUsers("lobby"), userId) {
+		if time.Now().After(deadline) {
+			t.Fatal("client was not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: userId, Rooms: []string{"lobby", "room1"}}, nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReplayMissedMessages(t *testing.T) {
+	replayStarted := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var replayedRooms []string
+
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: "61f61d94fc663b6f4c8f3172", Rooms: []string{"room1"}}, nil
+	}
+	getMessagesAfterRepoFunc = func(roomId string, messageId string, limit int) ([]mongodb.Message, error) {
+		mu.Lock()
+		replayedRooms = append(replayedRooms, roomId+":"+messageId)
+		mu.Unlock()
+		close(replayStarted)
+		<-release
+		return []mongodb.Message{{ID: "m1", RoomID: "room1"}, {ID: "m2", RoomID: "room1"}}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	server := newTestServerWithRepo(hub, &mockRepo{})
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	hello := mongodb.ClientMessage{
+		Message: "[USERINFO]",
+		UserID:  "61f61d94fc663b6f4c8f3172",
+		// room9 is not one of the user rooms, it must not be replayed
+		LastSeen: map[string]string{"room1": "m0", "room9": "x0"},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-replayStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay was not started")
+	}
+	// live messages arriving while replaying: m2 is also part of the replay, m3 is new
+	hub.broadcast(mongodb.Message{ID: "m2", RoomID: "room1"})
+	hub.broadcast(mongodb.Message{ID: "m3", RoomID: "room1"})
+	close(release)
+
+	var received []string
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(received) < 3 {
+		var message mongodb.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, message.ID)
+	}
+	assert.Equal(t, []string{"m1", "m2", "m3"}, received)
+
+	// back to live delivery
+	hub.broadcast(mongodb.Message{ID: "m4", RoomID: "room1"})
+	var message mongodb.Message
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "m4", message.ID)
+
+	mu.Lock()
+	assert.Equal(t, []string{"room1:m0"}, replayedRooms)
+	mu.Unlock()
+}
+
+func TestReplayPendingLimit(t *testing.T) {
+	replayStarted := make(chan struct{})
+	release := make(chan struct{})
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: "61f61d94fc663b6f4c8f3172", Rooms: []string{"room1"}}, nil
+	}
+	getMessagesAfterRepoFunc = func(roomId string, messageId string, limit int) ([]mongodb.Message, error) {
+		close(replayStarted)
+		<-release
+		return []mongodb.Message{{ID: "m1", RoomID: "room1"}}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewWsClient(conn, hub, &mockRepo{})
+		client.maxPending = 2
+		client.start()
+	}))
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	hello := mongodb.ClientMessage{Message: "[USERINFO]", UserID: "61f61d94fc663b6f4c8f3172", LastSeen: map[string]string{"room1": "m0"}}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-replayStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay was not started")
+	}
+	// a stalled replay in a busy room, one more than the client may hold back
+	for _, id := range []string{"m2", "m3", "m4"} {
+		hub.broadcast(mongodb.Message{ID: id, RoomID: "room1"})
+	}
+	// the hub handles one broadcast at a time, this one comes after the drop
+	assert.Empty(t, hub.onlineUsers("room1"), "the client is dropped like one with a full send buffer")
+	close(release)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var received []string
+	for {
+		var message mongodb.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			_, closed := err.(*websocket.CloseError)
+			assert.True(t, closed, "the connection is closed: %v", err)
+			break
+		}
+		received = append(received, message.ID)
+	}
+	assert.Equal(t, []string{"m1"}, received, "the held back messages are not written")
+}
+
+func TestReplayTruncated(t *testing.T) {
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: "61f61d94fc663b6f4c8f3172", Rooms: []string{"room1"}}, nil
+	}
+	getMessagesAfterRepoFunc = func(roomId string, messageId string, limit int) ([]mongodb.Message, error) {
+		assert.Equal(t, 3, limit, "one more than replayed")
+		return []mongodb.Message{{ID: "m1", RoomID: "room1"}, {ID: "m2", RoomID: "room1"}, {ID: "m3", RoomID: "room1"}}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewWsClient(conn, hub, &mockRepo{})
+		client.maxReplay = 2
+		client.start()
+	}))
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	hello := mongodb.ClientMessage{Message: "[USERINFO]", UserID: "61f61d94fc663b6f4c8f3172", LastSeen: map[string]string{"room1": "m0"}}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var received []string
+	for len(received) < 2 {
+		var message mongodb.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, message.ID)
+	}
+	assert.Equal(t, []string{"m1", "m2"}, received)
+	// the client fetches the messages beyond the replay itself
+	var truncated ReplayTruncatedEvent
+	if err := conn.ReadJSON(&truncated); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, newReplayTruncatedEvent("room1"), truncated)
+}
+
+func TestNoReplayWithoutLastSeen(t *testing.T) {
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: "61f61d94fc663b6f4c8f3172", Rooms: []string{"room1"}}, nil
+	}
+	getMessagesAfterRepoFunc = func(roomId string, messageId string, limit int) ([]mongodb.Message, error) {
+		t.Error("GetMessagesAfter must not be called without last_seen")
+		return nil, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	server := newTestServerWithRepo(hub, &mockRepo{})
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "[USERINFO]", UserID: "61f61d94fc663b6f4c8f3172"}); err != nil {
+		t.Fatal(err)
+	}
+	// let the hub register the client
+	time.Sleep(100 * time.Millisecond)
+
+	hub.broadcast(mongodb.Message{ID: "m1", RoomID: "room1"})
+	var message mongodb.Message
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	err := conn.ReadJSON(&message)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "m1", message.ID)
+	}
+}
+
+func TestAddMessageAck(t *testing.T) {
+	tt := []struct {
+		Name           string
+		addMessageFunc func(message interface{}) (string, error)
+		getMessageFunc func(filter interface{}) (mongodb.Message, error)
+		AckWant        Ack
+	}{
+		{
+			Name: "AddMessage Success",
+			addMessageFunc: func(message interface{}) (string, error) {
+				return "61f61d94fc663b6f4c8f3172", nil
+			},
+			getMessageFunc: func(filter interface{}) (mongodb.Message, error) {
+				return mongodb.Message{ID: "61f61d94fc663b6f4c8f3172", ClientMsgID: "c1"}, nil
+			},
+			AckWant: Ack{Type: "ack", ClientMsgID: "c1", MessageID: "61f61d94fc663b6f4c8f3172"},
+		},
+		{
+			Name: "AddMessage Duplicate",
+			addMessageFunc: func(message interface{}) (string, error) {
+				return "", mongodb.ErrDuplicateMessage
+			},
+			getMessageFunc: func(filter interface{}) (mongodb.Message, error) {
+				return mongodb.Message{ID: "61f61d94fc663b6f4c8f3172", ClientMsgID: "c1"}, nil
+			},
+			AckWant: Ack{Type: "ack", ClientMsgID: "c1", MessageID: "61f61d94fc663b6f4c8f3172", Duplicate: true},
+		},
+		{
+			Name: "AddMessage Failed",
+			addMessageFunc: func(message interface{}) (string, error) {
+				return "", errors.New("insert failed")
+			},
+			getMessageFunc: func(filter interface{}) (mongodb.Message, error) {
+				t.Error("GetMessage must not be called when insert failed")
+				return mongodb.Message{}, nil
+			},
+			AckWant: Ack{Type: "nack", ClientMsgID: "c1", Reason: "insert failed"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			addMessageRepoFunc = tc.addMessageFunc
+			getMessageRepoFunc = tc.getMessageFunc
+			nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+				return 1, nil
+			}
+
+			hub := NewHub()
+			go hub.Run()
+			defer hub.Shutdown(context.Background())
+			server := newTestServerWithRepo(hub, &mockRepo{})
+			defer server.Close()
+
+			conn := dialTestServer(t, server)
+			defer conn.Close()
+			registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+			clientMsg := mongodb.ClientMessage{Message: "hello", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", ClientMsgID: "c1"}
+			if err := conn.WriteJSON(clientMsg); err != nil {
+				t.Fatal(err)
+			}
+
+			var ack Ack
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.ReadJSON(&ack); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.AckWant, ack)
+		})
+	}
+}
+
+func TestAddMessageServerTimestamp(t *testing.T) {
+	clientTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	inserted := make(chan bson.M, 1)
+	nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+		return 42, nil
+	}
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		doc := bson.M{}
+		for _, e := range message.(bson.D) {
+			doc[e.Key] = e.Value
+		}
+		inserted <- doc
+		return "61f61d94fc663b6f4c8f3172", nil
+	}
+	getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+		return mongodb.Message{ID: "61f61d94fc663b6f4c8f3172"}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	server := newTestServerWithRepo(hub, &mockRepo{})
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	before := time.Now()
+	registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+	clientMsg := mongodb.ClientMessage{Message: "hello", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", Timestamp: clientTime}
+	if err := conn.WriteJSON(clientMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case doc := <-inserted:
+		assert.EqualValues(t, 42, doc["seq"])
+		assert.True(t, clientTime.Equal(doc["client_timestamp"].(time.Time)))
+		assert.False(t, doc["timestamp"].(time.Time).Before(before))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not inserted")
+	}
+}
+
+func TestAddMessageSeqFailed(t *testing.T) {
+	nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+		return 0, errors.New("counter unavailable")
+	}
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		t.Error("AddMessage must not be called without a seq")
+		return "", nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	server := newTestServerWithRepo(hub, &mockRepo{})
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "hello", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", ClientMsgID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ack Ack
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&ack); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Ack{Type: "nack", ClientMsgID: "c1", Reason: "counter unavailable"}, ack)
+}
+
+func TestRateLimitedFrames(t *testing.T) {
+	tt := []struct {
+		Name            string
+		disconnectAfter int
+	}{
+		{Name: "Error frame only", disconnectAfter: 0},
+		{Name: "Error frame and disconnect", disconnectAfter: 1},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+				return 1, nil
+			}
+			addMessageRepoFunc = func(message interface{}) (string, error) {
+				return "61f61d94fc663b6f4c8f3172", nil
+			}
+			getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+				return mongodb.Message{ID: "61f61d94fc663b6f4c8f3172"}, nil
+			}
+
+			hub := NewHub()
+			go hub.Run()
+			defer hub.Shutdown(context.Background())
+			// one message per user and room, nearly no refill
+			limits := newWsLimits(config.RateLimit{
+				WsConnPerSecond:   100,
+				WsConnBurst:       100,
+				WsRoomPerSecond:   0.001,
+				WsRoomBurst:       1,
+				WsDisconnectAfter: tc.disconnectAfter,
+			})
+			upgrader := websocket.Upgrader{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				client := NewWsClient(conn, hub, &mockRepo{})
+				client.setLimits(limits)
+				client.start()
+			}))
+			defer server.Close()
+
+			conn := dialTestServer(t, server)
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+			for _, clientMsgId := range []string{"c1", "c2"} {
+				clientMsg := mongodb.ClientMessage{Message: "hello", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", ClientMsgID: clientMsgId}
+				if err := conn.WriteJSON(clientMsg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.disconnectAfter > 0 {
+				// the close frame may overtake the ack and error frames
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						closeErr, ok := err.(*websocket.CloseError)
+						if assert.True(t, ok) {
+							assert.EqualValues(t, websocket.ClosePolicyViolation, closeErr.Code)
+						}
+						return
+					}
+				}
+			}
+
+			var ack Ack
+			if err := conn.ReadJSON(&ack); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "ack", ack.Type)
+
+			var errorFrame ErrorFrame
+			if err := conn.ReadJSON(&errorFrame); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, ErrorFrame{Type: "error", Code: "rate_limited", Reason: "too many messages, slow down", ClientMsgID: "c2"}, errorFrame)
+		})
+	}
+}
+
+func TestRotatingUserIds(t *testing.T) {
+	const userId = "61f61d94fc663b6f4c8f3172"
+	nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+		return 1, nil
+	}
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		return "61f61d94fc663b6f4c8f3190", nil
+	}
+	getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+		return mongodb.Message{ID: "61f61d94fc663b6f4c8f3190"}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	// one message per user and room, nearly no refill
+	limits := newWsLimits(config.RateLimit{WsConnPerSecond: 100, WsConnBurst: 100, WsRoomPerSecond: 0.001, WsRoomBurst: 1})
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewWsClient(conn, hub, &mockRepo{})
+		client.setLimits(limits)
+		client.start()
+	}))
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// not registered yet
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "hello", UserID: userId, RoomID: "room1", ClientMsgID: "c0"}); err != nil {
+		t.Fatal(err)
+	}
+	var errorFrame ErrorFrame
+	if err := conn.ReadJSON(&errorFrame); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "invalid_user", errorFrame.Code)
+	assert.Equal(t, "c0", errorFrame.ClientMsgID)
+
+	registerTestClient(t, hub, conn, userId)
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "hello", UserID: userId, RoomID: "room1", ClientMsgID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	var ack Ack
+	if err := conn.ReadJSON(&ack); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "ack", ack.Type)
+
+	// a new user_id on every frame gets no new bucket, the frames are rejected
+	for i, rotated := range []string{"61f61d94fc663b6f4c8f3173", "61f61d94fc663b6f4c8f3174"} {
+		clientMsgId := fmt.Sprintf("r%v", i)
+		if err := conn.WriteJSON(mongodb.ClientMessage{Message: "hello", UserID: rotated, RoomID: "room1", ClientMsgID: clientMsgId}); err != nil {
+			t.Fatal(err)
+		}
+		var errorFrame ErrorFrame
+		if err := conn.ReadJSON(&errorFrame); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, ErrorFrame{Type: "error", Code: "invalid_user", Reason: "user_id must be the user registered by [USERINFO]", ClientMsgID: clientMsgId}, errorFrame)
+	}
+	// registering again as another user is rejected as well
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "[USERINFO]", UserID: "61f61d94fc663b6f4c8f3175", ClientMsgID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&errorFrame); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "invalid_user", errorFrame.Code)
+
+	// the registered user is still limited
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "hello", UserID: userId, RoomID: "room1", ClientMsgID: "c2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&errorFrame); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ErrorFrame{Type: "error", Code: "rate_limited", Reason: "too many messages, slow down", ClientMsgID: "c2"}, errorFrame)
+}
+
+func TestInvalidMessage(t *testing.T) {
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		t.Error("AddMessage must not be called for an invalid message")
+		return "", nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	policy, err := msgpolicy.New(config.MessagePolicy{MaxLength: 600, Trim: true, StripControl: true, Normalization: "NFC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewWsClient(conn, hub, &mockRepo{})
+		client.setPolicy(policy)
+		client.start()
+	}))
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+	// above the old 512 bytes read limit, the connection must stay open
+	texts := []string{"   ", strings.Repeat("a", 601)}
+	for i, text := range texts {
+		clientMsgId := fmt.Sprintf("c%v", i)
+		if err := conn.WriteJSON(mongodb.ClientMessage{Message: text, UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", ClientMsgID: clientMsgId}); err != nil {
+			t.Fatal(err)
+		}
+		var errorFrame ErrorFrame
+		if err := conn.ReadJSON(&errorFrame); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "invalid_message", errorFrame.Code)
+		assert.Equal(t, clientMsgId, errorFrame.ClientMsgID)
+		assert.NotEmpty(t, errorFrame.Reason)
+	}
+}
+
+func TestNotMember(t *testing.T) {
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		t.Error("AddMessage must not be called for a room of other users")
+		return "", nil
+	}
+	getUsersRepoFunc = func(filter interface{}) ([]mongodb.User, error) {
+		t.Error("the members of a room of other users must not be notified")
+		return nil, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	server := newTestServerWithRepo(hub, &mockRepo{})
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "@room hello", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room2", ClientMsgID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var errorFrame ErrorFrame
+	if err := conn.ReadJSON(&errorFrame); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ErrorFrame{Type: "error", Code: "not_member", Reason: mongodb.ErrNotMember.Error(), ClientMsgID: "c1"}, errorFrame)
+}
+
+func TestMentions(t *testing.T) {
+	const (
+		aliceId = "61f61d94fc663b6f4c8f3171"
+		bobId   = "61f61d94fc663b6f4c8f3172"
+		carolId = "61f61d94fc663b6f4c8f3173"
+	)
+	tt := []struct {
+		Name         string
+		Text         string
+		MentionsWant []string
+	}{
+		{Name: "Username", Text: "hi @bob", MentionsWant: []string{bobId}},
+		{Name: "Sender is left out", Text: "@alice @bob", MentionsWant: []string{bobId}},
+		{Name: "Room", Text: "@room lunch?", MentionsWant: []string{bobId, carolId}},
+		{Name: "Here, only bob is online", Text: "@here lunch?", MentionsWant: []string{bobId}},
+		{Name: "Unknown user", Text: "@dave", MentionsWant: nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			inserted := make(chan bson.M, 1)
+			getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+				return &mongodb.User{ID: bobId, Username: "bob", Rooms: []string{"room1"}}, nil
+			}
+			getUsersRepoFunc = func(filter interface{}) ([]mongodb.User, error) {
+				return []mongodb.User{
+					{ID: aliceId, Username: "alice"},
+					{ID: bobId, Username: "bob"},
+					{ID: carolId, Username: "carol"},
+				}, nil
+			}
+			nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+				return 1, nil
+			}
+			addMessageRepoFunc = func(message interface{}) (string, error) {
+				doc := bson.M{}
+				for _, e := range message.(bson.D) {
+					doc[e.Key] = e.Value
+				}
+				inserted <- doc
+				return "61f61d94fc663b6f4c8f3180", nil
+			}
+			getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+				return mongodb.Message{ID: "61f61d94fc663b6f4c8f3180", RoomID: "room1", Message: tc.Text}, nil
+			}
+
+			hub := NewHub()
+			go hub.Run()
+			defer hub.Shutdown(context.Background())
+			server := newTestServerWithRepo(hub, &mockRepo{})
+			defer server.Close()
+
+			bob := dialTestServer(t, server)
+			defer bob.Close()
+			if err := bob.WriteJSON(mongodb.ClientMessage{Message: "[USERINFO]", UserID: bobId}); err != nil {
+				t.Fatal(err)
+			}
+			// let the hub register bob
+			time.Sleep(100 * time.Millisecond)
+
+			alice := dialTestServer(t, server)
+			defer alice.Close()
+			if err := alice.WriteJSON(mongodb.ClientMessage{Message: "[USERINFO]", UserID: aliceId}); err != nil {
+				t.Fatal(err)
+			}
+			if err := alice.WriteJSON(mongodb.ClientMessage{Message: tc.Text, UserID: aliceId, RoomID: "room1"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var doc bson.M
+			select {
+			case doc = <-inserted:
+			case <-time.After(5 * time.Second):
+				t.Fatal("message was not inserted")
+			}
+			if tc.MentionsWant == nil {
+				assert.NotContains(t, doc, "mentions")
+				return
+			}
+			assert.Equal(t, tc.MentionsWant, doc["mentions"])
+
+			// bob gets the message as room participant, then the mention event
+			bob.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var message mongodb.Message
+			if err := bob.ReadJSON(&message); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "61f61d94fc663b6f4c8f3180", message.ID)
+			var mention MentionEvent
+			if err := bob.ReadJSON(&mention); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "mention", mention.Type)
+			assert.Equal(t, "61f61d94fc663b6f4c8f3180", mention.Message.ID)
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	const (
+		senderId     = "61f61d94fc663b6f4c8f3172"
+		attachmentId = "61f61d94fc663b6f4c8f3180"
+	)
+	tt := []struct {
+		Name        string
+		Text        string
+		Attachments []string
+		Attachment  mongodb.Attachment
+		ErrorWant   bool
+	}{
+		{
+			Name:        "Attachment with text",
+			Text:        "look",
+			Attachments: []string{attachmentId},
+			Attachment:  mongodb.Attachment{ID: attachmentId, Name: "photo.png", RoomID: "room1", UserID: senderId},
+		},
+		{
+			Name:        "Attachment without text",
+			Text:        " ",
+			Attachments: []string{attachmentId},
+			Attachment:  mongodb.Attachment{ID: attachmentId, Name: "photo.png", RoomID: "room1", UserID: senderId},
+		},
+		{
+			Name:        "Attachment of another user",
+			Text:        "look",
+			Attachments: []string{attachmentId},
+			Attachment:  mongodb.Attachment{ID: attachmentId, Name: "photo.png", RoomID: "room1", UserID: "61f61d94fc663b6f4c8f3173"},
+			ErrorWant:   true,
+		},
+		{
+			Name:        "Attachment of another room",
+			Text:        "look",
+			Attachments: []string{attachmentId},
+			Attachment:  mongodb.Attachment{ID: attachmentId, Name: "photo.png", RoomID: "room2", UserID: senderId},
+			ErrorWant:   true,
+		},
+		{
+			Name:        "Invalid attachment id",
+			Text:        "look",
+			Attachments: []string{"abc"},
+			ErrorWant:   true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			inserted := make(chan bson.D, 1)
+			getAttachmentRepoFunc = func(filter interface{}) (*mongodb.Attachment, error) {
+				attachment := tc.Attachment
+				return &attachment, nil
+			}
+			nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+				return 1, nil
+			}
+			addMessageRepoFunc = func(message interface{}) (string, error) {
+				inserted <- message.(bson.D)
+				return "61f61d94fc663b6f4c8f3190", nil
+			}
+			getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+				return mongodb.Message{ID: "61f61d94fc663b6f4c8f3190", RoomID: "room1"}, nil
+			}
+
+			hub := NewHub()
+			go hub.Run()
+			defer hub.Shutdown(context.Background())
+			policy, err := msgpolicy.New(config.MessagePolicy{MaxLength: 600, Trim: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			upgrader := websocket.Upgrader{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				client := NewWsClient(conn, hub, &mockRepo{})
+				client.setPolicy(policy)
+				client.start()
+			}))
+			defer server.Close()
+
+			conn := dialTestServer(t, server)
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			registerTestClient(t, hub, conn, senderId)
+			clientMsg := mongodb.ClientMessage{Message: tc.Text, UserID: senderId, RoomID: "room1", ClientMsgID: "c1", Attachments: tc.Attachments}
+			if err := conn.WriteJSON(clientMsg); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.ErrorWant {
+				var errorFrame ErrorFrame
+				if err := conn.ReadJSON(&errorFrame); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, "invalid_attachment", errorFrame.Code)
+				assert.Equal(t, "c1", errorFrame.ClientMsgID)
+				return
+			}
+			var ack Ack
+			if err := conn.ReadJSON(&ack); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "ack", ack.Type)
+			doc := <-inserted
+			var attachments interface{}
+			for _, e := range doc {
+				if e.Key == "attachments" {
+					attachments = e.Value
+				}
+			}
+			assert.Equal(t, []mongodb.Attachment{tc.Attachment}, attachments)
+		})
+	}
+}
+
+// mockUnfurler hands the enqueued messages over to the test
+type mockUnfurler chan mongodb.Message
+
+func (u mockUnfurler) Enqueue(msg mongodb.Message) {
+	u <- msg
+}
+
+func TestAddMessageUnfurl(t *testing.T) {
+	nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+		return 1, nil
+	}
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		return "61f61d94fc663b6f4c8f3190", nil
+	}
+	getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+		return mongodb.Message{ID: "61f61d94fc663b6f4c8f3190", RoomID: "room1", Message: "see https://example.com"}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	unfurler := make(mockUnfurler, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := NewWsClient(conn, hub, &mockRepo{})
+		client.unfurler = unfurler
+		client.start()
+	}))
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	registerTestClient(t, hub, conn, "61f61d94fc663b6f4c8f3172")
+	clientMsg := mongodb.ClientMessage{Message: "see https://example.com", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", ClientMsgID: "c1"}
+	if err := conn.WriteJSON(clientMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-unfurler:
+		assert.Equal(t, "61f61d94fc663b6f4c8f3190", msg.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handed to the unfurler")
+	}
+}
+
+func TestPosterPollMessage(t *testing.T) {
+	nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+		return 1, nil
+	}
+	var added bson.D
+	addMessageRepoFunc = func(message interface{}) (string, error) {
+		added = message.(bson.D)
+		return "61f61d94fc663b6f4c8f3190", nil
+	}
+	getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+		return mongodb.Message{ID: "61f61d94fc663b6f4c8f3190", RoomID: "room1", Message: "Lunch?", PollID: "61f61d94fc663b6f4c8f3199"}, nil
+	}
+
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: "61f61d94fc663b6f4c8f3172", Rooms: []string{"room1"}}, nil
+	}
+	poster := NewPoster(hub, &mockRepo{}, nil, nil)
+
+	clientMsg := mongodb.ClientMessage{Message: "Lunch?", UserID: "61f61d94fc663b6f4c8f3172", RoomID: "room1", ClientMsgID: "poll-61f61d94fc663b6f4c8f3199", PollID: "61f61d94fc663b6f4c8f3199"}
+	messageId, err := poster.PostMessage(context.Background(), clientMsg)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "61f61d94fc663b6f4c8f3190", messageId)
+	stored := added.Map()
+	assert.Equal(t, "61f61d94fc663b6f4c8f3199", stored["poll_id"])
+	assert.Equal(t, "poll-61f61d94fc663b6f4c8f3199", stored["client_msg_id"])
+}
+
+func TestFrameContext(t *testing.T) {
+	client := NewWsClient(nil, NewHub(), &mockRepo{})
+	client.dbTimeout = time.Minute
+
+	ctx, cancel := client.frameContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+
+	// closing the connection stops its database work
+	client.cancel()
+	select {
+	case <-ctx.Done():
+		assert.Equal(t, context.Canceled, ctx.Err())
+	case <-time.After(5 * time.Second):
+		t.Fatal("frame context not cancelled with the connection")
+	}
+}
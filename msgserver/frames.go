@@ -0,0 +1,175 @@
+package msgserver
+
+import (
+	"fmt"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+)
+
+// frame types sent to the client next to the plain mongodb.Message frames
+const (
+	frameAck             = "ack"
+	frameNack            = "nack"
+	frameError           = "error"
+	frameMention         = "mention"
+	frameMessageUpdated  = "message_updated"
+	framePinAdded        = "pin_added"
+	framePinRemoved      = "pin_removed"
+	frameReminder        = "reminder"
+	framePollUpdated     = "poll_updated"
+	frameReplayTruncated = "replay_truncated"
+)
+
+// codes of ErrorFrame
+const (
+	errorRateLimited       = "rate_limited"
+	errorInvalidMessage    = "invalid_message"
+	errorInvalidAttachment = "invalid_attachment"
+	errorInvalidUser       = "invalid_user"
+	errorNotMember         = "not_member"
+)
+
+// Ack is sent to the sender only, it tells whether its message was stored
+type Ack struct {
+	Type        string `json:"type"`
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// MessageID is the server id of the stored message, empty for nack
+	MessageID string `json:"message_id,omitempty"`
+	// Duplicate is true when the client_msg_id was already stored by an earlier send
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Reason tells why the message was not stored, only for nack
+	Reason string `json:"reason,omitempty"`
+}
+
+func (a Ack) String() string {
+	return fmt.Sprintf("type:%v\n client_msg_id:%v\n message_id:%v\n reason:%v\n", a.Type, a.ClientMsgID, a.MessageID, a.Reason)
+}
+
+// newAck will create ack frame for a stored message
+func newAck(clientMsgId string, messageId string, duplicate bool) Ack {
+	return Ack{Type: frameAck, ClientMsgID: clientMsgId, MessageID: messageId, Duplicate: duplicate}
+}
+
+// newNack will create nack frame for a message which was not stored
+func newNack(clientMsgId string, reason string) Ack {
+	return Ack{Type: frameNack, ClientMsgID: clientMsgId, Reason: reason}
+}
+
+// ErrorFrame is sent to the client when one of its frames is rejected before it is processed
+type ErrorFrame struct {
+	Type        string `json:"type"`
+	Code        string `json:"code"`
+	Reason      string `json:"reason"`
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+func (e ErrorFrame) String() string {
+	return fmt.Sprintf("code:%v\n reason:%v\n client_msg_id:%v\n", e.Code, e.Reason, e.ClientMsgID)
+}
+
+// newErrorFrame will create error frame for a rejected client frame
+func newErrorFrame(clientMsgId string, code string, reason string) ErrorFrame {
+	return ErrorFrame{Type: frameError, Code: code, Reason: reason, ClientMsgID: clientMsgId}
+}
+
+// MentionEvent is sent to every connection of a mentioned user, whatever room it is looking at
+type MentionEvent struct {
+	Type    string          `json:"type"`
+	Message mongodb.Message `json:"message"`
+}
+
+func (m MentionEvent) String() string {
+	return fmt.Sprintf("type:%v\n message:%v\n", m.Type, m.Message)
+}
+
+// newMentionEvent will create mention event for the message
+func newMentionEvent(message mongodb.Message) MentionEvent {
+	return MentionEvent{Type: frameMention, Message: message}
+}
+
+// MessageUpdatedEvent is sent to the room when a stored message changed, e.g. a link preview was added,
+// the client replaces the message it shows
+type MessageUpdatedEvent struct {
+	Type    string          `json:"type"`
+	Message mongodb.Message `json:"message"`
+}
+
+func (m MessageUpdatedEvent) String() string {
+	return fmt.Sprintf("type:%v\n message:%v\n", m.Type, m.Message)
+}
+
+// NewMessageUpdatedEvent will create message_updated event for the message, to send with Hub.BroadcastEvent
+func NewMessageUpdatedEvent(message mongodb.Message) MessageUpdatedEvent {
+	return MessageUpdatedEvent{Type: frameMessageUpdated, Message: message}
+}
+
+// PinEvent is sent to the room when a message is pinned or unpinned, Message is only set for pin_added
+type PinEvent struct {
+	Type      string           `json:"type"`
+	RoomID    string           `json:"room_id"`
+	MessageID string           `json:"message_id"`
+	UserID    string           `json:"user_id"`
+	Message   *mongodb.Message `json:"message,omitempty"`
+}
+
+func (p PinEvent) String() string {
+	return fmt.Sprintf("type:%v\n room id:%v\n message id:%v\n", p.Type, p.RoomID, p.MessageID)
+}
+
+// NewPinAddedEvent will create pin_added event, userId pinned the message
+func NewPinAddedEvent(message mongodb.Message, userId string) PinEvent {
+	return PinEvent{Type: framePinAdded, RoomID: message.RoomID, MessageID: message.ID, UserID: userId, Message: &message}
+}
+
+// NewPinRemovedEvent will create pin_removed event, userId unpinned the message
+func NewPinRemovedEvent(roomId string, messageId string, userId string) PinEvent {
+	return PinEvent{Type: framePinRemoved, RoomID: roomId, MessageID: messageId, UserID: userId}
+}
+
+// ReminderEvent is sent to every connection of a user when a reminder on a message is due
+type ReminderEvent struct {
+	Type       string          `json:"type"`
+	ReminderID string          `json:"reminder_id"`
+	Message    mongodb.Message `json:"message"`
+}
+
+func (r ReminderEvent) String() string {
+	return fmt.Sprintf("type:%v\n reminder id:%v\n message:%v\n", r.Type, r.ReminderID, r.Message)
+}
+
+// NewReminderEvent will create reminder event for the message, to send with Hub.NotifyDelivered
+func NewReminderEvent(reminderId string, message mongodb.Message) ReminderEvent {
+	return ReminderEvent{Type: frameReminder, ReminderID: reminderId, Message: message}
+}
+
+// PollUpdatedEvent is sent to the room when a vote changed the tally of a poll, Results is the tally seen by everyone
+type PollUpdatedEvent struct {
+	Type    string      `json:"type"`
+	PollID  string      `json:"poll_id"`
+	Results interface{} `json:"results"`
+}
+
+func (p PollUpdatedEvent) String() string {
+	return fmt.Sprintf("type:%v\n poll id:%v\n", p.Type, p.PollID)
+}
+
+// NewPollUpdatedEvent will create poll_updated event with the results of the poll, to send with Hub.BroadcastEvent
+func NewPollUpdatedEvent(pollId string, results interface{}) PollUpdatedEvent {
+	return PollUpdatedEvent{Type: framePollUpdated, PollID: pollId, Results: results}
+}
+
+// ReplayTruncatedEvent is sent after the missed messages of a room when there were more than a replay carries,
+// the client fetches the messages of the room with GET /messages instead
+type ReplayTruncatedEvent struct {
+	Type   string `json:"type"`
+	RoomID string `json:"room_id"`
+}
+
+func (r ReplayTruncatedEvent) String() string {
+	return fmt.Sprintf("type:%v\n room id:%v\n", r.Type, r.RoomID)
+}
+
+// newReplayTruncatedEvent will create replay_truncated event for the room
+func newReplayTruncatedEvent(roomId string) ReplayTruncatedEvent {
+	return ReplayTruncatedEvent{Type: frameReplayTruncated, RoomID: roomId}
+}
@@ -1,7 +1,11 @@
 package msgserver
 
 import (
+	"context"
 	"log"
+	"sync"
+
+	"github.com/gorilla/websocket"
 
 	"github.com/pranotobudi/myslack-happy-backend/mongodb"
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,10 +21,53 @@ type Hub struct {
 	register     chan *wsClient
 	unregister   chan *wsClient
 
+	// connections holds every live websocket connection, registered or not,
+	// so shutdown can say goodbye to clients which never sent [USERINFO]
+	connections map[*wsClient]bool
+	connect     chan *wsClient
+
+	// quit asks Run to stop, done is closed once Run has returned.
+	// pumps counts the running readPump goroutines, used to drain connections
+	quit     chan struct{}
+	done     chan struct{}
+	quitOnce sync.Once
+	pumps    sync.WaitGroup
+
+	// roomLocks serialize sequence assignment, insert and broadcast per room,
+	// so live broadcasts reach the hub in the same order as the room sequence
+	roomLocksMu sync.Mutex
+	roomLocks   map[string]*sync.Mutex
+
+	// users holds the live connections of each registered user, for frames addressed to users instead of rooms
+	users          map[string]map[*wsClient]bool
+	broadcastEvent chan roomEvent
+	notify         chan userEvent
+	online         chan onlineRequest
+
 	// broadcastMsg     chan []byte
 	// broadcastMsg chan ClientMsg
 }
 
+// roomEvent is a frame for every participant of a room
+type roomEvent struct {
+	roomId string
+	frame  interface{}
+}
+
+// userEvent is a frame for every live connection of the users,
+// delivered gets the users which had a live connection when it is not nil
+type userEvent struct {
+	userIds   []string
+	frame     interface{}
+	delivered chan []string
+}
+
+// onlineRequest asks Run which users of a room have a live connection
+type onlineRequest struct {
+	roomId string
+	reply  chan []string
+}
+
 type ClientMsg struct {
 	// deprecated, only for initial app
 	ClientId string `json:"client_id"`
@@ -37,9 +84,32 @@ func NewHub() *Hub {
 		unregister:   make(chan *wsClient),
 		broadcastMsg: make(chan mongodb.Message),
 		// broadcastMsg: make(chan ClientMsg),
+		connections:    make(map[*wsClient]bool),
+		connect:        make(chan *wsClient),
+		quit:           make(chan struct{}),
+		done:           make(chan struct{}),
+		roomLocks:      make(map[string]*sync.Mutex),
+		users:          make(map[string]map[*wsClient]bool),
+		broadcastEvent: make(chan roomEvent),
+		notify:         make(chan userEvent),
+		online:         make(chan onlineRequest),
 	}
 }
 
+// lockRoom will lock the room for posting a message, call the returned func to unlock it
+func (h *Hub) lockRoom(roomId string) func() {
+	h.roomLocksMu.Lock()
+	lock, ok := h.roomLocks[roomId]
+	if !ok {
+		lock = &sync.Mutex{}
+		h.roomLocks[roomId] = lock
+	}
+	h.roomLocksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
 // addClient will add client c to the room roomName
 func (h *Hub) addClient(roomName string, c *wsClient) {
 	h.participants[roomName][c.clientId] = c
@@ -49,22 +119,57 @@ func (h *Hub) addClient(roomName string, c *wsClient) {
 // Run will run hub in infinite looping
 func (h *Hub) Run() {
 	log.Println("inside Run")
+	defer close(h.done)
 	for {
 		select {
+		case <-h.quit:
+			log.Println("inside Run: shutdown, closing", len(h.connections), "connections")
+			h.closeConnections()
+			return
+		case client := <-h.connect:
+			// counted here, so pumps.Add always happens before Shutdown waits on it
+			h.pumps.Add(1)
+			h.connections[client] = true
 		case msg := <-h.broadcastMsg:
 			log.Println("inside Run: new message, send to room participants, clientMsg:", msg)
 			log.Println("<- h.broadcastMsg total member: ", len(h.participants[msg.RoomID]))
 			// broadcast to its room participants
 			for _, client := range h.participants[msg.RoomID] {
 				log.Println("inside Run - h.broadcasting, room: ", msg.RoomID, " clientID: ", client.clientId)
-				select {
-				case client.send <- msg:
-				default:
+				if !client.deliver(msg) {
 					log.Println("inside Run- h.broadcastMsg default")
-					close(client.send)
-					delete(h.participants[msg.RoomID], client.clientId)
+					h.dropClient(client)
 				}
 			}
+		case event := <-h.broadcastEvent:
+			log.Println("inside Run: new event, send to room participants, room:", event.roomId)
+			for _, client := range h.participants[event.roomId] {
+				if !client.deliver(event.frame) {
+					h.dropClient(client)
+				}
+			}
+		case event := <-h.notify:
+			var delivered []string
+			for _, userId := range event.userIds {
+				log.Println("inside Run: new event, send to user:", userId, " connections: ", len(h.users[userId]))
+				for client := range h.users[userId] {
+					if !client.deliver(event.frame) {
+						h.dropClient(client)
+					}
+				}
+				if len(h.users[userId]) > 0 {
+					delivered = append(delivered, userId)
+				}
+			}
+			if event.delivered != nil {
+				event.delivered <- delivered
+			}
+		case request := <-h.online:
+			var userIds []string
+			for userId := range h.participants[request.roomId] {
+				userIds = append(userIds, userId)
+			}
+			request.reply <- userIds
 		case client := <-h.register:
 			log.Println("inside Run: register new client:", client.clientId)
 			err := h.registerClient(client)
@@ -75,6 +180,7 @@ func (h *Hub) Run() {
 
 		case client := <-h.unregister:
 			log.Println("inside Run: unregister client:", client)
+			delete(h.connections, client)
 			err := h.unregisterClient(client)
 			if err != nil {
 				log.Println("client unregistration from hub failed..: ", err)
@@ -84,6 +190,142 @@ func (h *Hub) Run() {
 	}
 }
 
+// Shutdown will stop Run, send a CloseGoingAway frame to every connected client
+// and wait until their connections are drained or ctx is done
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.quitOnce.Do(func() { close(h.quit) })
+
+	drained := make(chan struct{})
+	go func() {
+		<-h.done
+		h.pumps.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Println("hub shutdown: all connections drained")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeConnections will close the send channel of every live client,
+// writePump then sends the close frame and closes the connection
+func (h *Hub) closeConnections() {
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for client := range h.connections {
+		client.closeMsg = closeMsg
+		close(client.send)
+		delete(h.connections, client)
+	}
+	h.participants = make(map[string]map[string]*wsClient)
+	h.users = make(map[string]map[*wsClient]bool)
+}
+
+// dropClient will close a client which can not keep up with broadcasts.
+// a client is member of many rooms, so it is removed from all of them to avoid closing send twice
+func (h *Hub) dropClient(c *wsClient) {
+	if !h.connections[c] {
+		return
+	}
+	close(c.send)
+	delete(h.connections, c)
+	h.removeUserConnection(c)
+	for room, members := range h.participants {
+		if members[c.clientId] == c {
+			delete(members, c.clientId)
+		}
+		if len(members) == 0 {
+			delete(h.participants, room)
+		}
+	}
+}
+
+// attach, detach and broadcast deliver to Run, or give up once the hub is stopped
+func (h *Hub) attach(c *wsClient) bool {
+	select {
+	case h.connect <- c:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+func (h *Hub) detach(c *wsClient) {
+	select {
+	case h.unregister <- c:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) join(c *wsClient) {
+	select {
+	case h.register <- c:
+	case <-h.done:
+	}
+}
+
+func (h *Hub) broadcast(msg mongodb.Message) {
+	select {
+	case h.broadcastMsg <- msg:
+	case <-h.done:
+	}
+}
+
+// BroadcastEvent will send frame to every participant of the room
+func (h *Hub) BroadcastEvent(roomId string, frame interface{}) {
+	select {
+	case h.broadcastEvent <- roomEvent{roomId: roomId, frame: frame}:
+	case <-h.done:
+	}
+}
+
+// Notify will send frame to every live connection of the users, whatever room they are looking at
+func (h *Hub) Notify(userIds []string, frame interface{}) {
+	if len(userIds) == 0 {
+		return
+	}
+	select {
+	case h.notify <- userEvent{userIds: userIds, frame: frame}:
+	case <-h.done:
+	}
+}
+
+// NotifyDelivered will send frame like Notify and return the users which had a live connection to get it
+func (h *Hub) NotifyDelivered(userIds []string, frame interface{}) []string {
+	if len(userIds) == 0 {
+		return nil
+	}
+	event := userEvent{userIds: userIds, frame: frame, delivered: make(chan []string, 1)}
+	select {
+	case h.notify <- event:
+		return <-event.delivered
+	case <-h.done:
+		return nil
+	}
+}
+
+// onlineUsers will return the ids of the room participants with a live connection
+func (h *Hub) onlineUsers(roomId string) []string {
+	request := onlineRequest{roomId: roomId, reply: make(chan []string, 1)}
+	select {
+	case h.online <- request:
+		return <-request.reply
+	case <-h.done:
+		return nil
+	}
+}
+
+// removeUserConnection will forget c as a live connection of its user
+func (h *Hub) removeUserConnection(c *wsClient) {
+	delete(h.users[c.clientId], c)
+	if len(h.users[c.clientId]) == 0 {
+		delete(h.users, c.clientId)
+	}
+}
+
 // registerClient will register the client to the hub
 func (h *Hub) registerClient(c *wsClient) error {
 	userId := c.clientId
@@ -96,12 +338,19 @@ func (h *Hub) registerClient(c *wsClient) error {
 	}
 
 	filter := bson.M{"_id": objID}
-	user, err := c.mongodbConn.GetUser(filter)
+	ctx, cancel := c.frameContext()
+	defer cancel()
+	user, err := c.mongodbConn.GetUser(ctx, filter)
 	if err != nil {
 		log.Println("loadRooms - failed to get user: ", err)
 		return err
 	}
 
+	if h.users[c.clientId] == nil {
+		h.users[c.clientId] = make(map[*wsClient]bool)
+	}
+	h.users[c.clientId][c] = true
+
 	for _, room := range user.Rooms {
 		if h.participants[room] == nil {
 			// because each room is a map which has not been initialized, don't forget make(map[*client]bool)
@@ -112,11 +361,23 @@ func (h *Hub) registerClient(c *wsClient) error {
 		h.participants[room][c.clientId] = c
 		log.Println("--- after total member in: ", room, ": ", len(h.participants[room]))
 	}
+
+	// replay what the client missed while disconnected, only for rooms it is a member of
+	replay := make(map[string]string)
+	for _, room := range user.Rooms {
+		if messageId, ok := c.lastSeen[room]; ok {
+			replay[room] = messageId
+		}
+	}
+	if len(replay) > 0 {
+		c.requestReplay(replay)
+	}
 	return nil
 }
 
 // unregisterClient will unregister the client from the hub
 func (h *Hub) unregisterClient(c *wsClient) error {
+	h.removeUserConnection(c)
 	userId := c.clientId
 	objID, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
@@ -126,7 +387,10 @@ func (h *Hub) unregisterClient(c *wsClient) error {
 	}
 
 	filter := bson.M{"_id": objID}
-	user, err := c.mongodbConn.GetUser(filter)
+	// the connection is closed already, so its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), c.dbTimeout)
+	defer cancel()
+	user, err := c.mongodbConn.GetUser(ctx, filter)
 	if err != nil {
 		log.Println("loadRooms - failed to get user: ", err)
 		return err
@@ -136,7 +400,10 @@ func (h *Hub) unregisterClient(c *wsClient) error {
 		// delete client from map
 		// close(client.send) // remove send channel from memory, actually no need for this line, it will be garbage collected automatically later, but for channel it is better do it manually. it should be done first before remove the client
 		// when connection cut, it is closed automatically, so no need to close it, otherside panic
-		delete(h.participants[room], c.clientId)
+		// the user may have connected again meanwhile, keep the newer connection
+		if h.participants[room][c.clientId] == c {
+			delete(h.participants[room], c.clientId)
+		}
 
 		if len(h.participants) == 0 {
 			//delete the room from map
@@ -0,0 +1,150 @@
+package msgserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer will serve websocket connections attached to hub without mongoDB
+func newTestServer(hub *Hub) *httptest.Server {
+	return newTestServerWithRepo(hub, nil)
+}
+
+// newTestServerWithRepo will serve websocket connections attached to hub using repo as mongoDB
+func newTestServerWithRepo(hub *Hub, repo Store) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		NewWsClient(conn, hub, repo).start()
+	}))
+}
+
+func dialTestServer(t *testing.T, server *httptest.Server) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestHubShutdown(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	server := newTestServer(hub)
+	defer server.Close()
+
+	conns := []*websocket.Conn{dialTestServer(t, server), dialTestServer(t, server)}
+	// make sure both connections reached the hub before shutting down
+	time.Sleep(100 * time.Millisecond)
+
+	closeCodes := make(chan int, len(conns))
+	for _, conn := range conns {
+		go func(conn *websocket.Conn) {
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					if closeErr, ok := err.(*websocket.CloseError); ok {
+						closeCodes <- closeErr.Code
+					} else {
+						closeCodes <- 0
+					}
+					return
+				}
+			}
+		}(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := hub.Shutdown(ctx)
+	assert.Nil(t, err)
+
+	for range conns {
+		assert.EqualValues(t, websocket.CloseGoingAway, <-closeCodes)
+	}
+
+	select {
+	case <-hub.done:
+	default:
+		t.Error("hub Run is still running after Shutdown")
+	}
+}
+
+func TestHubShutdownRefusesNewConnections(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	server := newTestServer(hub)
+	defer server.Close()
+
+	err := hub.Shutdown(context.Background())
+	assert.Nil(t, err)
+	// calling it twice is harmless
+	err = hub.Shutdown(context.Background())
+	assert.Nil(t, err)
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if assert.True(t, ok) {
+		assert.EqualValues(t, websocket.CloseGoingAway, closeErr.Code)
+	}
+}
+
+func TestHubShutdownTimeout(t *testing.T) {
+	hub := NewHub()
+	// Run is never started, so the hub can not drain
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := hub.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestHubNotifyDelivered(t *testing.T) {
+	getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+		return &mongodb.User{ID: "61f61d94fc663b6f4c8f3172", Rooms: []string{"room1"}}, nil
+	}
+	hub := NewHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	server := newTestServerWithRepo(hub, &mockRepo{})
+	defer server.Close()
+
+	conn := dialTestServer(t, server)
+	defer conn.Close()
+	if err := conn.WriteJSON(mongodb.ClientMessage{Message: "[USERINFO]", UserID: "61f61d94fc663b6f4c8f3172"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hub.onlineUsers("room1")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not register")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	frame := NewReminderEvent("r1", mongodb.Message{ID: "61f61d94fc663b6f4c8f3190"})
+	delivered := hub.NotifyDelivered([]string{"61f61d94fc663b6f4c8f3172", "61f61d94fc663b6f4c8f3173"}, frame)
+	assert.Equal(t, []string{"61f61d94fc663b6f4c8f3172"}, delivered)
+
+	var event ReminderEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, frame, event)
+
+	assert.Nil(t, hub.NotifyDelivered(nil, frame))
+}
@@ -0,0 +1,243 @@
+package msgserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgformat"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store is the part of the repository the websocket server works with:
+// the messages, the files attached to them and the users sending them
+type Store interface {
+	mongodb.MessageRepository
+	mongodb.AttachmentRepository
+	mongodb.UserRepository
+}
+
+// poster stores a message and hands it over to its room,
+// it is the one path for messages sent through a websocket, scheduled messages and poll messages
+type poster struct {
+	hub  *Hub
+	repo Store
+	// policy is nil when the text is kept as is, unfurler is nil when messages get no link previews
+	policy   *msgpolicy.Policy
+	unfurler Unfurler
+}
+
+// rejectedError is a message refused before it was stored, code is the ErrorFrame code
+type rejectedError struct {
+	code string
+	err  error
+}
+
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+// post will validate the message, store it and broadcast it to the room.
+// stored is called, if not nil, as soon as the message is in mongoDB, before the broadcast;
+// duplicate tells that the client_msg_id was already stored by an earlier send, which is not broadcast again.
+// it returns the id of the stored message, or a *rejectedError for a message of a user who is not a member of the room
+// or refused by the policy
+func (p *poster) post(ctx context.Context, clientMsg mongodb.ClientMessage, stored func(messageId string, duplicate bool)) (string, error) {
+	if stored == nil {
+		stored = func(string, bool) {}
+	}
+	// a message is only stored, and its mentions notified, in a room of the sender
+	if _, err := mongodb.RoomMember(ctx, p.repo, clientMsg.UserID, clientMsg.RoomID); err != nil {
+		if errors.Is(err, mongodb.ErrNotMember) {
+			return "", &rejectedError{code: errorNotMember, err: err}
+		}
+		log.Println("post - failed to check room member: ", err)
+		return "", err
+	}
+	if p.policy != nil {
+		text, err := p.policy.Apply(clientMsg.Message)
+		// a message may carry attachments only
+		if err == msgpolicy.ErrEmptyMessage && len(clientMsg.Attachments) > 0 {
+			err = nil
+		}
+		if err != nil {
+			return "", &rejectedError{code: errorInvalidMessage, err: err}
+		}
+		clientMsg.Message = text
+	}
+
+	attachments, err := p.resolveAttachments(ctx, clientMsg)
+	if err != nil {
+		return "", &rejectedError{code: errorInvalidAttachment, err: err}
+	}
+
+	// a failed lookup only costs the notifications, the message is stored anyway
+	mentions, err := p.resolveMentions(ctx, clientMsg)
+	if err != nil {
+		log.Println("post - failed to resolve mentions: ", err)
+	}
+
+	unlock := p.hub.lockRoom(clientMsg.RoomID)
+	defer unlock()
+
+	// the server clock and the room sequence are authoritative, the client time is kept as metadata
+	seq, err := p.repo.NextMessageSeq(ctx, clientMsg.RoomID)
+	if err != nil {
+		log.Println("post - failed to get message seq: ", err)
+		return "", err
+	}
+
+	// save to mongoDB
+	message := bson.D{
+		{Key: "message", Value: clientMsg.Message},
+		{Key: "message_html", Value: msgformat.Render(clientMsg.Message)},
+		{Key: "user_id", Value: clientMsg.UserID},
+		{Key: "room_id", Value: clientMsg.RoomID},
+		{Key: "username", Value: clientMsg.Username},
+		{Key: "user_image", Value: clientMsg.UserImage},
+		{Key: "timestamp", Value: time.Now()},
+		{Key: "client_timestamp", Value: clientMsg.Timestamp},
+		{Key: "seq", Value: seq},
+	}
+	if clientMsg.ClientMsgID != "" {
+		message = append(message, bson.E{Key: "client_msg_id", Value: clientMsg.ClientMsgID})
+	}
+	if len(mentions) > 0 {
+		message = append(message, bson.E{Key: "mentions", Value: mentions})
+	}
+	if len(attachments) > 0 {
+		message = append(message, bson.E{Key: "attachments", Value: attachments})
+	}
+	if clientMsg.PollID != "" {
+		message = append(message, bson.E{Key: "poll_id", Value: clientMsg.PollID})
+	}
+	docId, err := p.repo.AddMessage(ctx, message)
+	if err == mongodb.ErrDuplicateMessage {
+		filter := bson.M{"user_id": clientMsg.UserID, "client_msg_id": clientMsg.ClientMsgID}
+		existing, err := p.repo.GetMessage(ctx, filter)
+		if err != nil {
+			log.Println("post - duplicate Message, failed to getMessage: ", err)
+			return "", err
+		}
+		log.Println("post - duplicate Message, already stored with id: ", existing.ID)
+		stored(existing.ID, true)
+		return existing.ID, nil
+	}
+	if err != nil {
+		log.Println("post - add message to MongoDB FAILED: ", err)
+		return "", err
+	}
+	log.Println("post - add message to MongoDB success, id: ", docId)
+	stored(docId, false)
+
+	// convert clientMessage to Message
+	objID, err := primitive.ObjectIDFromHex(docId)
+	if err != nil {
+		log.Println(err)
+		return docId, nil
+	}
+
+	filter := bson.M{"_id": objID}
+	messageWithId, err := p.repo.GetMessage(ctx, filter)
+	if err != nil {
+		log.Println("failed to getMessage: ", err)
+		return docId, nil
+	}
+
+	// broadcast to other clients
+	p.hub.broadcast(messageWithId)
+	log.Println("post - broadcast Message: ", messageWithId)
+
+	// mentioned users get a dedicated event, even when they do not follow the room right now
+	p.hub.Notify(mentions, newMentionEvent(messageWithId))
+
+	if p.unfurler != nil {
+		p.unfurler.Enqueue(messageWithId)
+	}
+	return docId, nil
+}
+
+// resolveAttachments will load the metadata of the attachments of the message,
+// only files uploaded by the sender to the same room can be attached
+func (p *poster) resolveAttachments(ctx context.Context, clientMsg mongodb.ClientMessage) ([]mongodb.Attachment, error) {
+	if len(clientMsg.Attachments) > maxAttachments {
+		return nil, fmt.Errorf("at most %v attachments allowed", maxAttachments)
+	}
+	var attachments []mongodb.Attachment
+	for _, id := range clientMsg.Attachments {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, fmt.Errorf("attachment %v: %w", id, mongodb.ErrAttachmentNotFound)
+		}
+		attachment, err := p.repo.GetAttachment(ctx, bson.M{"_id": objID})
+		if err != nil {
+			return nil, fmt.Errorf("attachment %v: %w", id, err)
+		}
+		if attachment.UserID != clientMsg.UserID || attachment.RoomID != clientMsg.RoomID {
+			return nil, fmt.Errorf("attachment %v: %w", id, mongodb.ErrAttachmentNotFound)
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, nil
+}
+
+// resolveMentions will turn @username, @here and @room of the message into ids of room members.
+// the sender is never mentioned
+func (p *poster) resolveMentions(ctx context.Context, clientMsg mongodb.ClientMessage) ([]string, error) {
+	parsed := msgformat.ParseMentions(clientMsg.Message)
+	if !parsed.Any() {
+		return nil, nil
+	}
+
+	members, err := p.repo.GetUsers(ctx, bson.M{"rooms": clientMsg.RoomID})
+	if err != nil {
+		return nil, err
+	}
+	usernames := make(map[string]bool)
+	for _, username := range parsed.Usernames {
+		usernames[username] = true
+	}
+	online := make(map[string]bool)
+	if parsed.Here {
+		for _, userId := range p.hub.onlineUsers(clientMsg.RoomID) {
+			online[userId] = true
+		}
+	}
+
+	var userIds []string
+	for _, member := range members {
+		if member.ID == clientMsg.UserID {
+			continue
+		}
+		if parsed.Room || usernames[member.Username] || online[member.ID] {
+			userIds = append(userIds, member.ID)
+		}
+	}
+	return userIds, nil
+}
+
+// Poster posts messages from outside a websocket connection, e.g. the message announcing a poll
+type Poster struct {
+	poster *poster
+}
+
+// NewPoster will initialize Poster object, messages are broadcast through hub.
+// policy and unfurler may be nil
+func NewPoster(hub *Hub, repo Store, policy *msgpolicy.Policy, unfurler Unfurler) *Poster {
+	return &Poster{poster: &poster{hub: hub, repo: repo, policy: policy, unfurler: unfurler}}
+}
+
+// PostMessage will store clientMsg and broadcast it to its room, like a message sent through a websocket.
+// the caller is responsible for checking that the user may post to the room
+func (p *Poster) PostMessage(ctx context.Context, clientMsg mongodb.ClientMessage) (string, error) {
+	return p.poster.post(ctx, clientMsg, nil)
+}
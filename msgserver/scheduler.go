@@ -0,0 +1,129 @@
+package msgserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/pranotobudi/myslack-happy-backend/clock"
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+)
+
+// Scheduler posts the scheduled messages once they are due, through the same path as the websocket messages
+type Scheduler struct {
+	scheduledRepo mongodb.ScheduledMessageRepository
+	poster        *poster
+	clock         clock.Clock
+	config        config.Scheduler
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewScheduler will initialize Scheduler object, the due messages are claimed from scheduledRepo and broadcast through hub.
+// policy and unfurler may be nil
+func NewScheduler(hub *Hub, repo Store, scheduledRepo mongodb.ScheduledMessageRepository, policy *msgpolicy.Policy, unfurler Unfurler, clk clock.Clock, schedulerConfig config.Scheduler) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		scheduledRepo: scheduledRepo,
+		poster:        &poster{hub: hub, repo: repo, policy: policy, unfurler: unfurler},
+		clock:         clk,
+		config:        schedulerConfig,
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+}
+
+// Run will post the due messages every interval until Shutdown
+func (s *Scheduler) Run() {
+	log.Println("scheduler running, interval: ", s.config.Interval)
+	defer close(s.done)
+	for {
+		s.postDue()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.clock.After(s.config.Interval):
+		}
+	}
+}
+
+// Shutdown will stop Run once the message being posted, if any, is done
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(s.cancel)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// postDue will post every message which is due, it returns how many were claimed
+func (s *Scheduler) postDue() int {
+	claimed := 0
+	for s.ctx.Err() == nil {
+		if !s.postNext() {
+			break
+		}
+		claimed++
+	}
+	return claimed
+}
+
+// postNext will claim and post the earliest due message, it returns false when none was claimed.
+// Shutdown does not cancel a message being posted, the lease bounds it instead:
+// past the lease another scheduler may claim the message again
+func (s *Scheduler) postNext() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Lease)
+	defer cancel()
+
+	now := s.clock.Now()
+	scheduled, err := s.scheduledRepo.ClaimScheduledMessage(ctx, now, now.Add(-s.config.Lease))
+	if err == mongodb.ErrScheduledMessageNotFound {
+		return false
+	}
+	if err != nil {
+		log.Println("scheduler - failed to claim scheduled message: ", err)
+		return false
+	}
+	s.post(ctx, *scheduled)
+	return true
+}
+
+// post will post the scheduled message and record the outcome.
+// a message which can not be posted, e.g. the user left the room, fails; on other errors it stays claimed
+// and is retried once the lease expired, the client_msg_id makes such a retry idempotent
+func (s *Scheduler) post(ctx context.Context, scheduled mongodb.ScheduledMessage) {
+	clientMsg := mongodb.ClientMessage{
+		Message:     scheduled.Message,
+		UserID:      scheduled.UserID,
+		Username:    scheduled.Username,
+		UserImage:   scheduled.UserImage,
+		RoomID:      scheduled.RoomID,
+		Timestamp:   scheduled.CreatedAt,
+		ClientMsgID: "scheduled-" + scheduled.ID,
+		Attachments: scheduled.Attachments,
+	}
+	messageId, err := s.poster.post(ctx, clientMsg, nil)
+
+	var rejected *rejectedError
+	failure := ""
+	switch {
+	case errors.As(err, &rejected):
+		log.Println("scheduler - scheduled message failed: ", scheduled.ID, " error: ", err)
+		failure = err.Error()
+	case err != nil:
+		log.Println("scheduler - failed to post scheduled message, retry after lease: ", scheduled.ID, " error: ", err)
+		return
+	}
+	if err := s.scheduledRepo.FinishScheduledMessage(ctx, scheduled.ID, messageId, failure); err != nil {
+		log.Println("scheduler - failed to finish scheduled message: ", scheduled.ID, " error: ", err)
+	}
+}
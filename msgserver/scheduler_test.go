@@ -0,0 +1,230 @@
+package msgserver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgpolicy"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	claimScheduledMessageRepoFunc  func(now time.Time, staleBefore time.Time) (*mongodb.ScheduledMessage, error)
+	finishScheduledMessageRepoFunc func(id string, messageId string, failure string) error
+)
+
+type mockSchedulerRepo struct {
+	mongodb.ScheduledMessageRepository
+}
+
+func (m *mockSchedulerRepo) ClaimScheduledMessage(ctx context.Context, now time.Time, staleBefore time.Time) (*mongodb.ScheduledMessage, error) {
+	return claimScheduledMessageRepoFunc(now, staleBefore)
+}
+func (m *mockSchedulerRepo) FinishScheduledMessage(ctx context.Context, id string, messageId string, failure string) error {
+	return finishScheduledMessageRepoFunc(id, messageId, failure)
+}
+
+// fakeClock only moves when Advance is called
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance will move the clock by d and fire the waiters which are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var waiting []fakeWaiter
+	for _, waiter := range c.waiters {
+		if waiter.at.After(c.now) {
+			waiting = append(waiting, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = waiting
+}
+
+// waitForWaiter will wait until someone called After
+func (c *fakeClock) waitForWaiter(t *testing.T) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		n := len(c.waiters)
+		c.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("nobody is waiting on the clock")
+}
+
+var testSchedulerConfig = config.Scheduler{Interval: 5 * time.Second, Lease: time.Minute, MaxAhead: time.Hour}
+
+func TestSchedulerPostDue(t *testing.T) {
+	due := mongodb.ScheduledMessage{
+		ID:        "61f61d94fc663b6f4c8f3199",
+		UserID:    "61f61d94fc663b6f4c8f3172",
+		Username:  "budi",
+		RoomID:    "room1",
+		Message:   "good morning",
+		PostAt:    time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC),
+		CreatedAt: time.Date(2022, 1, 31, 20, 0, 0, 0, time.UTC),
+		Status:    mongodb.ScheduledSending,
+	}
+	empty := due
+	empty.Message = "   "
+
+	tt := []struct {
+		Name          string
+		Scheduled     mongodb.ScheduledMessage
+		Rooms         []string
+		AddMessageErr error
+		Finished      bool
+		MessageIDWant string
+		FailureWant   string
+	}{
+		{
+			Name:          "Posted",
+			Scheduled:     due,
+			Rooms:         []string{"room1"},
+			Finished:      true,
+			MessageIDWant: "61f61d94fc663b6f4c8f3190",
+		},
+		{
+			Name:        "Failed user left the room",
+			Scheduled:   due,
+			Rooms:       []string{"room2"},
+			Finished:    true,
+			FailureWant: mongodb.ErrNotMember.Error(),
+		},
+		{
+			Name:        "Failed rejected by the policy",
+			Scheduled:   empty,
+			Rooms:       []string{"room1"},
+			Finished:    true,
+			FailureWant: msgpolicy.ErrEmptyMessage.Error(),
+		},
+		{
+			Name:          "Insert failed, retried after the lease",
+			Scheduled:     due,
+			Rooms:         []string{"room1"},
+			AddMessageErr: errors.New("insert failed"),
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			clk := &fakeClock{now: time.Date(2022, 2, 1, 8, 0, 1, 0, time.UTC)}
+			claimed := false
+			claimScheduledMessageRepoFunc = func(now time.Time, staleBefore time.Time) (*mongodb.ScheduledMessage, error) {
+				assert.Equal(t, clk.Now(), now)
+				assert.Equal(t, clk.Now().Add(-time.Minute), staleBefore)
+				if claimed {
+					return nil, mongodb.ErrScheduledMessageNotFound
+				}
+				claimed = true
+				scheduled := tc.Scheduled
+				return &scheduled, nil
+			}
+			getUserRepoFunc = func(filter interface{}) (*mongodb.User, error) {
+				return &mongodb.User{ID: due.UserID, Rooms: tc.Rooms}, nil
+			}
+			getUsersRepoFunc = func(filter interface{}) ([]mongodb.User, error) {
+				return nil, nil
+			}
+			nextMessageSeqRepoFunc = func(roomId string) (int64, error) {
+				return 7, nil
+			}
+			var added bson.D
+			addMessageRepoFunc = func(message interface{}) (string, error) {
+				added = message.(bson.D)
+				return "61f61d94fc663b6f4c8f3190", tc.AddMessageErr
+			}
+			getMessageRepoFunc = func(filter interface{}) (mongodb.Message, error) {
+				return mongodb.Message{ID: "61f61d94fc663b6f4c8f3190", RoomID: "room1", Message: "good morning"}, nil
+			}
+			finished := false
+			finishScheduledMessageRepoFunc = func(id string, messageId string, failure string) error {
+				finished = true
+				assert.Equal(t, due.ID, id)
+				assert.Equal(t, tc.MessageIDWant, messageId)
+				assert.Equal(t, tc.FailureWant, failure)
+				return nil
+			}
+
+			hub := NewHub()
+			go hub.Run()
+			defer hub.Shutdown(context.Background())
+			policy, err := msgpolicy.New(config.MessagePolicy{MaxLength: 100, Trim: true, Normalization: "none"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			scheduler := NewScheduler(hub, &mockRepo{}, &mockSchedulerRepo{}, policy, nil, clk, testSchedulerConfig)
+
+			assert.Equal(t, 1, scheduler.postDue())
+			assert.Equal(t, tc.Finished, finished)
+			if tc.MessageIDWant != "" {
+				stored := added.Map()
+				// the same client_msg_id on every attempt makes a retry idempotent
+				assert.Equal(t, "scheduled-"+due.ID, stored["client_msg_id"])
+				assert.Equal(t, due.CreatedAt, stored["client_timestamp"])
+				assert.Equal(t, "budi", stored["username"])
+			}
+		})
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	clk := &fakeClock{now: time.Date(2022, 2, 1, 8, 0, 0, 0, time.UTC)}
+	claims := make(chan time.Time, 10)
+	claimScheduledMessageRepoFunc = func(now time.Time, staleBefore time.Time) (*mongodb.ScheduledMessage, error) {
+		claims <- now
+		return nil, mongodb.ErrScheduledMessageNotFound
+	}
+
+	scheduler := NewScheduler(NewHub(), &mockRepo{}, &mockSchedulerRepo{}, nil, nil, clk, testSchedulerConfig)
+	go scheduler.Run()
+
+	// due messages are looked up right away, then every interval
+	assert.Equal(t, clk.Now(), <-claims)
+	clk.waitForWaiter(t)
+	clk.Advance(testSchedulerConfig.Interval)
+	assert.Equal(t, clk.Now(), <-claims)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, scheduler.Shutdown(ctx))
+	select {
+	case now := <-claims:
+		t.Error("claimed after Shutdown at: ", now)
+	default:
+	}
+}
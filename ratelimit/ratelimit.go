@@ -0,0 +1,246 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/common"
+)
+
+// Bucket is a token bucket: it holds up to burst tokens and refills rate tokens per second
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewBucket will initialize a full Bucket
+func NewBucket(rate float64, burst int) *Bucket {
+	return newBucket(rate, burst, time.Now)
+}
+
+func newBucket(rate float64, burst int, now func() time.Time) *Bucket {
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// Allow will take one token from the bucket, it returns false when the bucket is empty
+func (b *Bucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryAfter is how long until the next token is available
+func (b *Bucket) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens >= 1 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full tells whether the bucket has refilled completely, meaning it has been idle
+func (b *Bucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= b.burst
+}
+
+func (b *Bucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	if elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+}
+
+// Limiter is a set of token buckets, one per key (client ip, user and room, ...)
+type Limiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     int
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// sweepInterval is how often idle buckets are forgotten
+const sweepInterval = time.Minute
+
+// NewLimiter will initialize Limiter, every key gets rate tokens per second up to burst
+func NewLimiter(rate float64, burst int) *Limiter {
+	return newLimiter(rate, burst, time.Now)
+}
+
+func newLimiter(rate float64, burst int, now func() time.Time) *Limiter {
+	return &Limiter{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*Bucket),
+		lastSweep: now(),
+		now:       now,
+	}
+}
+
+// Allow will take one token from the bucket of key
+func (l *Limiter) Allow(key string) bool {
+	return l.bucket(key).Allow()
+}
+
+// RetryAfter is how long until key gets its next token
+func (l *Limiter) RetryAfter(key string) time.Duration {
+	return l.bucket(key).RetryAfter()
+}
+
+func (l *Limiter) bucket(key string) *Bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.now().Sub(l.lastSweep) >= sweepInterval {
+		// a full bucket behaves the same as a new one, so it can be dropped
+		for k, b := range l.buckets {
+			if b.full() {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = l.now()
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newBucket(l.rate, l.burst, l.now)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// ErrTooManyRequests is the error returned to rate limited clients
+var ErrTooManyRequests = errors.New("too many requests, slow down")
+
+// Middleware will reject requests above the limit of their key with 429 in common.Response format,
+// a request for which keyFunc returns an empty key is not limited
+func (l *Limiter) Middleware(keyFunc func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key != "" && !l.Allow(key) {
+				retryAfter := int(math.Ceil(l.RetryAfter(key).Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				response := common.ResponseErrorFormatter(http.StatusTooManyRequests, ErrTooManyRequests)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Keys are the Middleware key funcs of a server, the client address is taken from the proxies it trusts
+type Keys struct {
+	trusted []*net.IPNet
+}
+
+// NewKeys will initialize Keys, trustedProxies are the ip addresses or CIDR ranges of the proxies in front of the server
+func NewKeys(trustedProxies []string) (*Keys, error) {
+	keys := &Keys{}
+	for _, proxy := range trustedProxies {
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: not an ip address or CIDR range", proxy)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		keys.trusted = append(keys.trusted, ipNet)
+	}
+	return keys, nil
+}
+
+// ClientIP is a Middleware key func using the address of the client. the remote address of the connection is it,
+// unless it is a trusted proxy: then it is the last address of X-Forwarded-For which is not a trusted proxy, or X-Real-IP
+func (k *Keys) ClientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !k.isTrusted(remote) {
+		return remote
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		// every proxy appends the address it got the request from, the ones left of the first untrusted one could be forged
+		addresses := strings.Split(forwarded, ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+			if net.ParseIP(address) == nil {
+				break
+			}
+			if !k.isTrusted(address) || i == 0 {
+				return address
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remote
+}
+
+// User is a Middleware key func using the user_id query parameter, a request without one is not limited by it
+func (k *Keys) User(r *http.Request) string {
+	if userId := r.URL.Query().Get("user_id"); userId != "" {
+		return "user:" + userId
+	}
+	return ""
+}
+
+func (k *Keys) isTrusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range k.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limiter) String() string {
+	return fmt.Sprintf("rate:%v/s\n burst:%v\n", l.rate, l.burst)
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock moved by hand
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestBucket(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	bucket := newBucket(2, 3, clock.now)
+
+	// burst
+	assert.True(t, bucket.Allow())
+	assert.True(t, bucket.Allow())
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+	assert.Equal(t, 500*time.Millisecond, bucket.RetryAfter())
+
+	// 2 tokens per second
+	clock.advance(500 * time.Millisecond)
+	assert.True(t, bucket.Allow())
+	assert.False(t, bucket.Allow())
+
+	// never more than burst
+	clock.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.Allow())
+	}
+	assert.False(t, bucket.Allow())
+}
+
+func TestLimiter(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	limiter := newLimiter(1, 1, clock.now)
+
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("a"))
+	// keys do not share tokens
+	assert.True(t, limiter.Allow("b"))
+
+	// idle buckets are forgotten after a sweep
+	clock.advance(2 * sweepInterval)
+	assert.True(t, limiter.Allow("a"))
+	assert.Len(t, limiter.buckets, 1)
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := NewLimiter(0.001, 2)
+	keys, err := NewKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := limiter.Middleware(keys.ClientIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tt := []struct {
+		Name       string
+		RemoteAddr string
+		CodeWant   int
+	}{
+		{"First request", "10.0.0.1:1234", http.StatusOK},
+		{"Second request", "10.0.0.1:1235", http.StatusOK},
+		{"Third request limited", "10.0.0.1:1236", http.StatusTooManyRequests},
+		{"Other client", "10.0.0.2:1234", http.StatusOK},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			handler.ServeHTTP(rr, req)
+
+			assert.EqualValues(t, tc.CodeWant, rr.Code)
+			if tc.CodeWant != http.StatusTooManyRequests {
+				return
+			}
+			assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+			var response common.Response
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				assert.Errorf(t, err, "response format is not valid")
+			}
+			assert.EqualValues(t, http.StatusTooManyRequests, response.Meta.Code)
+		})
+	}
+}
+
+func TestMiddlewareEmptyKey(t *testing.T) {
+	limiter := NewLimiter(0.001, 1)
+	keys, err := NewKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := limiter.Middleware(keys.User)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := []int{}
+	for _, target := range []string{"/rooms", "/rooms", "/me/saved?user_id=u1", "/me/saved?user_id=u1", "/me/saved?user_id=u2"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		codes = append(codes, rr.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusOK}, codes,
+		"a request without user_id is not limited per user, each user has a bucket")
+}
+
+func TestClientIP(t *testing.T) {
+	keys, err := NewKeys([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		Name       string
+		RemoteAddr string
+		Forwarded  string
+		RealIP     string
+		IPWant     string
+	}{
+		{Name: "No proxy", RemoteAddr: "203.0.113.7:1234", IPWant: "203.0.113.7"},
+		{Name: "Untrusted remote can not set the client", RemoteAddr: "203.0.113.7:1234", Forwarded: "198.51.100.1", IPWant: "203.0.113.7"},
+		{Name: "Trusted proxy", RemoteAddr: "10.1.2.3:1234", Forwarded: "198.51.100.1", IPWant: "198.51.100.1"},
+		{Name: "Trusted proxy single address", RemoteAddr: "192.168.1.1:1234", Forwarded: "198.51.100.1", IPWant: "198.51.100.1"},
+		{Name: "Forged addresses before the client", RemoteAddr: "10.1.2.3:1234", Forwarded: "1.2.3.4, 198.51.100.1, 10.0.0.9", IPWant: "198.51.100.1"},
+		{Name: "Every address trusted", RemoteAddr: "10.1.2.3:1234", Forwarded: "10.0.0.8, 10.0.0.9", IPWant: "10.0.0.8"},
+		{Name: "Real ip header", RemoteAddr: "10.1.2.3:1234", RealIP: "198.51.100.2", IPWant: "198.51.100.2"},
+		{Name: "Trusted proxy without headers", RemoteAddr: "10.1.2.3:1234", IPWant: "10.1.2.3"},
+		{Name: "Invalid forwarded address", RemoteAddr: "10.1.2.3:1234", Forwarded: "unknown", IPWant: "10.1.2.3"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/rooms", nil)
+			req.RemoteAddr = tc.RemoteAddr
+			if tc.Forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.Forwarded)
+			}
+			if tc.RealIP != "" {
+				req.Header.Set("X-Real-IP", tc.RealIP)
+			}
+
+			assert.Equal(t, tc.IPWant, keys.ClientIP(req))
+		})
+	}
+}
+
+func TestNewKeysInvalidProxy(t *testing.T) {
+	_, err := NewKeys([]string{"ingress"})
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/seed"
+)
+
+// defaultFixtures are seeded when the seed command is given no file
+const defaultFixtures = "fixtures/dev.yaml"
+
+// seedDatabase will run the seed command: it loads a fixtures file into a development database,
+// migrated first. --reset drops the database before, otherwise it must have no rooms
+func seedDatabase(appConfig config.Config, args []string) error {
+	// the check comes before anything else, a production database is never touched
+	if appConfig.App.AppEnv == "production" {
+		return errors.New("seed refuses to run with APP_ENV=production")
+	}
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	reset := flags.Bool("reset", false, "drop the database before seeding it")
+	perRoom := flags.Int("messages", 0, "messages generated per room, overrides the fixtures file when set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// parsing stops at the fixtures file, a flag after it would be silently ignored
+	if flags.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments %q, usage: seed [--reset] [--messages n] [fixtures file]", flags.Args()[1:])
+	}
+	path := flags.Arg(0)
+	if path == "" {
+		path = defaultFixtures
+	}
+	fixtures, err := seed.Load(path)
+	if err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "messages" {
+			fixtures.Messages.PerRoom = *perRoom
+			err = fixtures.Validate()
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("invalid --messages: %v", err)
+	}
+
+	mongodbConn, err := mongodb.NewMongoDB(appConfig.MongoDb)
+	if err != nil {
+		return fmt.Errorf("failed to connect to mongoDB: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	defer func() {
+		if err := mongodbConn.Disconnect(context.Background()); err != nil {
+			log.Println("mongoDB disconnect failed: ", err)
+		}
+	}()
+
+	if *reset {
+		if err := mongodbConn.DropDatabase(ctx); err != nil {
+			return fmt.Errorf("failed to reset database: %v", err)
+		}
+	}
+	// the seeded documents go through the same indexes and validators as the application's
+	if _, err := mongodbConn.Migrator().Up(ctx); err != nil {
+		return err
+	}
+	result, err := seed.NewSeeder(mongodbConn, mongodbConn, mongodbConn).Seed(ctx, fixtures)
+	if errors.Is(err, seed.ErrNotEmpty) {
+		return fmt.Errorf("%v, run seed --reset to replace its data", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("seeded", path+":", result)
+	return nil
+}
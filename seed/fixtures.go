@@ -0,0 +1,138 @@
+package seed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reservedDomains can never receive an email, fixture users must use one of them.
+// the chat archive is mailed to the users of a room, a real looking address would get it
+var reservedDomains = []string{"example.com", "example.org", "example.net", ".test", ".example", ".invalid", ".localhost"}
+
+// Fixtures is a development data set: the rooms, the users with the rooms they are a member of,
+// and how much message history to generate in every room. the same fixtures always seed the same data
+type Fixtures struct {
+	// Seed makes the generated message history deterministic
+	Seed     int64          `yaml:"seed"`
+	Rooms    []RoomFixture  `yaml:"rooms"`
+	Users    []UserFixture  `yaml:"users"`
+	Messages MessageHistory `yaml:"messages"`
+}
+
+type RoomFixture struct {
+	Name string `yaml:"name"`
+}
+
+// UserFixture is a user, Rooms are the names of the rooms the user is a member of
+type UserFixture struct {
+	Email     string   `yaml:"email"`
+	Username  string   `yaml:"username"`
+	UserImage string   `yaml:"user_image"`
+	Rooms     []string `yaml:"rooms"`
+}
+
+// MessageHistory is the history generated in every room: PerRoom messages sent by the members of the room,
+// the first at Start and then about one every Interval, their text picked from Texts
+type MessageHistory struct {
+	PerRoom  int           `yaml:"per_room"`
+	Start    time.Time     `yaml:"start"`
+	Interval time.Duration `yaml:"interval"`
+	Texts    []string      `yaml:"texts"`
+}
+
+// Load will read the fixtures file at path, in yaml or json, an unknown key is an error so typos are not ignored.
+// every invalid value is listed in the error
+func Load(path string) (*Fixtures, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures file: %v", err)
+	}
+	// json is valid yaml, one decoder reads both
+	var fixtures Fixtures
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fixtures); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid fixtures file %v: %v", path, err)
+	}
+	if err := fixtures.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid fixtures file %v: %v", path, err)
+	}
+	return &fixtures, nil
+}
+
+// Validate will check the fixtures, every problem is listed in one error
+func (f *Fixtures) Validate() error {
+	var problems []string
+	if len(f.Rooms) == 0 {
+		problems = append(problems, "rooms must not be empty")
+	}
+	rooms := make(map[string]bool)
+	for i, room := range f.Rooms {
+		if strings.TrimSpace(room.Name) == "" {
+			problems = append(problems, fmt.Sprintf("rooms[%v] has no name", i))
+		}
+		if rooms[room.Name] {
+			problems = append(problems, fmt.Sprintf("room %q is listed twice", room.Name))
+		}
+		rooms[room.Name] = true
+	}
+	emails := make(map[string]bool)
+	for i, user := range f.Users {
+		email := strings.ToLower(user.Email)
+		if !isReservedEmail(email) {
+			problems = append(problems, fmt.Sprintf("users[%v] email must be at a reserved domain like example.com: %q", i, user.Email))
+		}
+		if emails[email] {
+			problems = append(problems, fmt.Sprintf("user %q is listed twice", user.Email))
+		}
+		emails[email] = true
+		if strings.TrimSpace(user.Username) == "" {
+			problems = append(problems, fmt.Sprintf("users[%v] has no username", i))
+		}
+		for _, room := range user.Rooms {
+			if !rooms[room] {
+				problems = append(problems, fmt.Sprintf("user %q is a member of unknown room %q", user.Email, room))
+			}
+		}
+	}
+	if f.Messages.PerRoom < 0 {
+		problems = append(problems, "messages.per_room must not be negative")
+	}
+	if f.Messages.PerRoom > 0 {
+		if f.Messages.Start.IsZero() {
+			problems = append(problems, "messages.start must be set")
+		}
+		if f.Messages.Interval <= 0 {
+			problems = append(problems, "messages.interval must be positive")
+		}
+		if len(f.Messages.Texts) == 0 {
+			problems = append(problems, "messages.texts must not be empty")
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// isReservedEmail will tell whether the domain of email is one of reservedDomains
+func isReservedEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, reserved := range reservedDomains {
+		if domain == reserved || strings.HasSuffix(domain, "."+strings.TrimPrefix(reserved, ".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package seed
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFile will write content to a file named name removed after the test, its path is returned
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDevFixtures(t *testing.T) {
+	fixtures, err := Load("../fixtures/dev.yaml")
+
+	if assert.Nil(t, err) {
+		assert.NotEmpty(t, fixtures.Rooms)
+		assert.NotEmpty(t, fixtures.Users)
+		assert.Equal(t, 7*time.Minute, fixtures.Messages.Interval)
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := writeFile(t, "fixtures.json", `{
+		"seed": 7,
+		"rooms": [{"name": "general"}],
+		"users": [{"email": "ocean@example.com", "username": "ocean", "rooms": ["general"]}],
+		"messages": {"per_room": 3, "start": "2024-01-08T09:00:00Z", "interval": "1m", "texts": ["hi"]}
+	}`)
+
+	fixtures, err := Load(path)
+
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(7), fixtures.Seed)
+		assert.Equal(t, []string{"general"}, fixtures.Users[0].Rooms)
+		assert.Equal(t, time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC), fixtures.Messages.Start)
+		assert.Equal(t, time.Minute, fixtures.Messages.Interval)
+	}
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	path := writeFile(t, "fixtures.yaml", "rooms:\n  - name: general\n    topic: chat\n")
+
+	_, err := Load(path)
+
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "topic")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Fixtures {
+		return &Fixtures{
+			Rooms: []RoomFixture{{Name: "general"}},
+			Users: []UserFixture{{Email: "ocean@example.com", Username: "ocean", Rooms: []string{"general"}}},
+			Messages: MessageHistory{
+				PerRoom:  10,
+				Start:    time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+				Interval: time.Minute,
+				Texts:    []string{"hi"},
+			},
+		}
+	}
+	tt := []struct {
+		Name     string
+		fixtures func(f *Fixtures)
+		ErrWant  string
+	}{
+		{Name: "Valid", fixtures: func(f *Fixtures) {}},
+		{Name: "Valid test domain", fixtures: func(f *Fixtures) { f.Users[0].Email = "ocean@myslack.test" }},
+		{Name: "Valid subdomain", fixtures: func(f *Fixtures) { f.Users[0].Email = "ocean@mail.example.org" }},
+		{Name: "Valid without history", fixtures: func(f *Fixtures) { f.Messages = MessageHistory{} }},
+		{Name: "No rooms", fixtures: func(f *Fixtures) { f.Rooms = nil; f.Users = nil }, ErrWant: "rooms must not be empty"},
+		{Name: "Room twice", fixtures: func(f *Fixtures) { f.Rooms = append(f.Rooms, RoomFixture{Name: "general"}) }, ErrWant: `room "general" is listed twice`},
+		{Name: "Real looking email", fixtures: func(f *Fixtures) { f.Users[0].Email = "ocean.king.digital@gmail.com" }, ErrWant: "reserved domain"},
+		{Name: "Lookalike domain", fixtures: func(f *Fixtures) { f.Users[0].Email = "ocean@notexample.com" }, ErrWant: "reserved domain"},
+		{Name: "User twice", fixtures: func(f *Fixtures) { f.Users = append(f.Users, UserFixture{Email: "Ocean@example.com", Username: "o"}) }, ErrWant: "listed twice"},
+		{Name: "No username", fixtures: func(f *Fixtures) { f.Users[0].Username = " " }, ErrWant: "has no username"},
+		{Name: "Unknown room", fixtures: func(f *Fixtures) { f.Users[0].Rooms = []string{"random"} }, ErrWant: `unknown room "random"`},
+		{Name: "Negative history", fixtures: func(f *Fixtures) { f.Messages.PerRoom = -1 }, ErrWant: "must not be negative"},
+		{Name: "No interval", fixtures: func(f *Fixtures) { f.Messages.Interval = 0 }, ErrWant: "interval must be positive"},
+		{Name: "No texts", fixtures: func(f *Fixtures) { f.Messages.Texts = nil }, ErrWant: "texts must not be empty"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			fixtures := valid()
+			tc.fixtures(fixtures)
+
+			err := fixtures.Validate()
+
+			if tc.ErrWant == "" {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tc.ErrWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgformat"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrNotEmpty is returned when the database already has rooms, the fixtures would be mixed with them
+var ErrNotEmpty = errors.New("database is not empty")
+
+// batchSize is how many messages are inserted at once
+const batchSize = 1000
+
+// Result counts what was seeded
+type Result struct {
+	Rooms    int
+	Users    int
+	Messages int
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("rooms:%v users:%v messages:%v", r.Rooms, r.Users, r.Messages)
+}
+
+// Seeder adds fixtures to a repository, through the same repository as the application
+type Seeder struct {
+	roomRepo    mongodb.RoomRepository
+	userRepo    mongodb.UserRepository
+	messageRepo mongodb.MessageRepository
+}
+
+// NewSeeder will initialize Seeder on the room, user and message repositories
+func NewSeeder(roomRepo mongodb.RoomRepository, userRepo mongodb.UserRepository, messageRepo mongodb.MessageRepository) *Seeder {
+	return &Seeder{roomRepo: roomRepo, userRepo: userRepo, messageRepo: messageRepo}
+}
+
+// member is a user of the fixtures once stored
+type member struct {
+	id   string
+	user UserFixture
+}
+
+// Seed will add the rooms, the users and the message history of fixtures to an empty database,
+// ErrNotEmpty when it already has rooms
+func (s *Seeder) Seed(ctx context.Context, fixtures *Fixtures) (Result, error) {
+	var result Result
+	existing, err := s.roomRepo.GetRooms(ctx)
+	if err != nil {
+		return result, err
+	}
+	if len(existing) > 0 {
+		return result, fmt.Errorf("%w: it has %v rooms", ErrNotEmpty, len(existing))
+	}
+
+	var rooms []interface{}
+	for _, room := range fixtures.Rooms {
+		rooms = append(rooms, bson.D{{Key: "name", Value: room.Name}})
+	}
+	roomIds, err := s.roomRepo.AddRooms(ctx, rooms)
+	if err != nil {
+		return result, fmt.Errorf("failed to add rooms: %w", err)
+	}
+	if len(roomIds) != len(rooms) {
+		return result, fmt.Errorf("failed to add rooms: %v of %v added", len(roomIds), len(rooms))
+	}
+	result.Rooms = len(roomIds)
+	roomIdByName := make(map[string]string)
+	for i, room := range fixtures.Rooms {
+		roomIdByName[room.Name] = roomIds[i]
+	}
+
+	var users []interface{}
+	for _, user := range fixtures.Users {
+		userRooms := bson.A{}
+		for _, room := range user.Rooms {
+			userRooms = append(userRooms, roomIdByName[room])
+		}
+		users = append(users, bson.D{
+			{Key: "email", Value: user.Email},
+			{Key: "username", Value: user.Username},
+			{Key: "user_image", Value: user.UserImage},
+			{Key: "rooms", Value: userRooms},
+		})
+	}
+	var userIds []string
+	if len(users) > 0 {
+		userIds, err = s.userRepo.AddUsers(ctx, users)
+		if err != nil {
+			return result, fmt.Errorf("failed to add users: %w", err)
+		}
+		if len(userIds) != len(users) {
+			return result, fmt.Errorf("failed to add users: %v of %v added", len(userIds), len(users))
+		}
+	}
+	result.Users = len(userIds)
+
+	membersByRoom := make(map[string][]member)
+	for i, user := range fixtures.Users {
+		for _, room := range user.Rooms {
+			membersByRoom[room] = append(membersByRoom[room], member{id: userIds[i], user: user})
+		}
+	}
+	// one source for every room, in the order of the fixtures, so the history is the same on every run
+	rnd := rand.New(rand.NewSource(fixtures.Seed))
+	for _, room := range fixtures.Rooms {
+		n, err := s.addHistory(ctx, rnd, fixtures.Messages, roomIdByName[room.Name], membersByRoom[room.Name])
+		result.Messages += n
+		if err != nil {
+			return result, fmt.Errorf("failed to add messages of room %v: %w", room.Name, err)
+		}
+	}
+	log.Println("database seeded: ", result)
+	return result, nil
+}
+
+// addHistory will add the message history of a room sent by its members, a room without members gets none.
+// it returns how many messages were added
+func (s *Seeder) addHistory(ctx context.Context, rnd *rand.Rand, history MessageHistory, roomId string, members []member) (int, error) {
+	if len(members) == 0 {
+		return 0, nil
+	}
+	added := 0
+	var batch []interface{}
+	for i := 0; i < history.PerRoom; i++ {
+		sender := members[rnd.Intn(len(members))]
+		text := history.Texts[rnd.Intn(len(history.Texts))]
+		// spread the messages unevenly, each stays before the next one
+		jitter := time.Duration(rnd.Int63n(int64(history.Interval))) / 2
+		timestamp := history.Start.Add(time.Duration(i)*history.Interval + jitter)
+		seq, err := s.messageRepo.NextMessageSeq(ctx, roomId)
+		if err != nil {
+			return added, err
+		}
+		batch = append(batch, bson.D{
+			{Key: "message", Value: text},
+			{Key: "message_html", Value: msgformat.Render(text)},
+			{Key: "user_id", Value: sender.id},
+			{Key: "room_id", Value: roomId},
+			{Key: "username", Value: sender.user.Username},
+			{Key: "user_image", Value: sender.user.UserImage},
+			{Key: "timestamp", Value: timestamp},
+			{Key: "client_timestamp", Value: timestamp},
+			{Key: "seq", Value: seq},
+		})
+		if len(batch) == batchSize || i == history.PerRoom-1 {
+			ids, err := s.messageRepo.AddMessages(ctx, batch)
+			added += len(ids)
+			if err != nil {
+				return added, err
+			}
+			batch = nil
+		}
+	}
+	return added, nil
+}
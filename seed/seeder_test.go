@@ -0,0 +1,115 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb/memdb"
+	"github.com/pranotobudi/myslack-happy-backend/msgformat"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func testFixtures() *Fixtures {
+	return &Fixtures{
+		Seed:  3,
+		Rooms: []RoomFixture{{Name: "general"}, {Name: "random"}, {Name: "empty"}},
+		Users: []UserFixture{
+			{Email: "ocean@example.com", Username: "ocean", Rooms: []string{"general", "random"}},
+			{Email: "river@example.com", Username: "river", Rooms: []string{"general"}},
+		},
+		Messages: MessageHistory{
+			PerRoom:  5,
+			Start:    time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+			Interval: time.Minute,
+			Texts:    []string{"hello", "*bold* news", "bye"},
+		},
+	}
+}
+
+// history will return the messages of the room named name, without their ids which differ between runs
+func history(t *testing.T, db *memdb.DB, name string) []mongodb.Message {
+	ctx := context.Background()
+	rooms, err := db.GetRooms(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, room := range rooms {
+		if room.Name != name {
+			continue
+		}
+		messages, err := db.GetMessages(ctx, bson.M{"room_id": room.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range messages {
+			messages[i].ID = ""
+			messages[i].RoomID = ""
+			messages[i].UserID = ""
+		}
+		return messages
+	}
+	t.Fatalf("room %v not found", name)
+	return nil
+}
+
+func TestSeed(t *testing.T) {
+	db := memdb.New()
+	ctx := context.Background()
+
+	result, err := NewSeeder(db, db, db).Seed(ctx, testFixtures())
+
+	assert.Nil(t, err)
+	assert.Equal(t, Result{Rooms: 3, Users: 2, Messages: 10}, result, "the room without members gets no history")
+
+	user, err := db.GetUser(ctx, bson.M{"email": "ocean@example.com"})
+	if assert.Nil(t, err) {
+		assert.Len(t, user.Rooms, 2)
+	}
+	messages := history(t, db, "general")
+	if assert.Len(t, messages, 5) {
+		for i, message := range messages {
+			assert.Equal(t, int64(i+1), message.Seq)
+			assert.Contains(t, []string{"ocean", "river"}, message.Username)
+			assert.Equal(t, msgformat.Render(message.Message), message.MessageHTML)
+			if i > 0 {
+				assert.True(t, message.Timestamp.After(messages[i-1].Timestamp), "the history is in order")
+			}
+		}
+	}
+	for _, message := range history(t, db, "random") {
+		assert.Equal(t, "ocean", message.Username, "only members send messages")
+	}
+	seq, err := db.NextMessageSeq(ctx, user.Rooms[0])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), seq, "new messages follow the seeded history")
+}
+
+func TestSeedDeterministic(t *testing.T) {
+	first := memdb.New()
+	second := memdb.New()
+
+	_, err := NewSeeder(first, first, first).Seed(context.Background(), testFixtures())
+	assert.Nil(t, err)
+	_, err = NewSeeder(second, second, second).Seed(context.Background(), testFixtures())
+	assert.Nil(t, err)
+
+	assert.Equal(t, history(t, first, "general"), history(t, second, "general"))
+	assert.Equal(t, history(t, first, "random"), history(t, second, "random"))
+}
+
+func TestSeedNotEmpty(t *testing.T) {
+	db := memdb.New()
+	seeder := NewSeeder(db, db, db)
+	_, err := seeder.Seed(context.Background(), testFixtures())
+	assert.Nil(t, err)
+
+	_, err = seeder.Seed(context.Background(), testFixtures())
+
+	assert.True(t, errors.Is(err, ErrNotEmpty))
+	rooms, _ := db.GetRooms(context.Background())
+	assert.Len(t, rooms, 3, "nothing is added")
+}
@@ -0,0 +1,289 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"golang.org/x/net/html"
+)
+
+var (
+	// ErrBlockedAddress is returned when a link resolves to an address the unfurler must not reach
+	ErrBlockedAddress = errors.New("address is not allowed")
+	// ErrNoPreview is returned when the page has no metadata worth showing
+	ErrNoPreview = errors.New("no preview available")
+)
+
+// maxRedirects is how many redirects a fetch follows, each target is checked again
+const maxRedirects = 5
+
+// blockedNetworks are private, loopback, link-local and otherwise special ranges.
+// a link posted in the chat must never make the server reach its own network
+var blockedNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// publicIP tells whether ip is outside every blocked network, IPv4-mapped IPv6 addresses are checked as IPv4
+func publicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetcher gets the metadata of a link. the address is checked when the connection is made,
+// after name resolution, so neither DNS answers nor redirects can point it to a blocked address
+type fetcher struct {
+	client    *http.Client
+	timeout   time.Duration
+	maxBytes  int64
+	userAgent string
+}
+
+func newFetcher(timeout time.Duration, maxBytes int64, userAgent string, allow func(ip net.IP) bool) *fetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !allow(ip) {
+				return fmt.Errorf("%v: %w", host, ErrBlockedAddress)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		// a proxy would make the dialer check the proxy instead of the target
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %v is not allowed", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return &fetcher{client: client, timeout: timeout, maxBytes: maxBytes, userAgent: userAgent}
+}
+
+// fetch will read the Open Graph metadata of the page, oEmbed fills what is missing
+func (f *fetcher) fetch(ctx context.Context, link string) (*mongodb.LinkPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	resp, err := f.get(ctx, link, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNoPreview
+	}
+
+	meta := parseMeta(io.LimitReader(resp.Body, f.maxBytes))
+	// relative urls are relative to the page after redirects
+	base := resp.Request.URL
+	preview := &mongodb.LinkPreview{
+		URL:         link,
+		Title:       firstOf(meta["og:title"], meta["twitter:title"], meta["title"]),
+		Description: firstOf(meta["og:description"], meta["twitter:description"], meta["description"]),
+		Image:       resolveURL(base, firstOf(meta["og:image"], meta["twitter:image"])),
+		SiteName:    meta["og:site_name"],
+	}
+
+	if oembedURL := resolveURL(base, meta["oembed"]); oembedURL != "" && (preview.Title == "" || preview.Image == "") {
+		// the Open Graph data is still good when oEmbed fails
+		if err := f.oembed(ctx, oembedURL, preview); err != nil {
+			log.Println("unfurl - oembed failed: ", err)
+		}
+	}
+
+	if preview.Title == "" && preview.Description == "" && preview.Image == "" {
+		return nil, ErrNoPreview
+	}
+	preview.SiteName = firstOf(preview.SiteName, base.Hostname())
+	return preview, nil
+}
+
+// oembed will fill the empty fields of preview from the oEmbed JSON endpoint of the page
+func (f *fetcher) oembed(ctx context.Context, oembedURL string, preview *mongodb.LinkPreview) error {
+	resp, err := f.get(ctx, oembedURL, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var oembed struct {
+		Title        string `json:"title"`
+		AuthorName   string `json:"author_name"`
+		ProviderName string `json:"provider_name"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, f.maxBytes)).Decode(&oembed); err != nil {
+		return err
+	}
+	preview.Title = firstOf(preview.Title, oembed.Title)
+	preview.Description = firstOf(preview.Description, oembed.AuthorName)
+	preview.Image = firstOf(preview.Image, resolveURL(resp.Request.URL, oembed.ThumbnailURL))
+	preview.SiteName = firstOf(preview.SiteName, oembed.ProviderName)
+	return nil
+}
+
+func (f *fetcher) get(ctx context.Context, link string, accept string) (*http.Response, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme %v is not allowed", u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", f.userAgent)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%v: %v", link, resp.Status)
+	}
+	return resp, nil
+}
+
+// parseMeta will collect <title>, the <meta> tags and the oEmbed <link> of the page head.
+// keys are the lower case property or name, "title" and "oembed"
+func parseMeta(r io.Reader) map[string]string {
+	meta := make(map[string]string)
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.TextToken:
+			if inTitle && meta["title"] == "" {
+				meta["title"] = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return meta
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, value []byte
+				key, value, hasAttr = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				return meta
+			case "meta":
+				key := strings.ToLower(firstOf(attrs["property"], attrs["name"]))
+				if key != "" && meta[key] == "" {
+					meta[key] = strings.TrimSpace(attrs["content"])
+				}
+			case "link":
+				if strings.EqualFold(attrs["rel"], "alternate") && strings.EqualFold(attrs["type"], "application/json+oembed") {
+					meta["oembed"] = attrs["href"]
+				}
+			}
+		}
+	}
+}
+
+// resolveURL will resolve ref against base, only http(s) results are kept
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func firstOf(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
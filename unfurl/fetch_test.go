@@ -0,0 +1,206 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// allowAll lets tests reach httptest servers, which listen on loopback
+func allowAll(ip net.IP) bool {
+	return true
+}
+
+func newTestFetcher(allow func(ip net.IP) bool) *fetcher {
+	return newFetcher(time.Second, 1<<20, "test", allow)
+}
+
+func TestPublicIP(t *testing.T) {
+	tt := []struct {
+		IP   string
+		Want bool
+	}{
+		{IP: "93.184.216.34", Want: true},
+		{IP: "2606:2800:220:1:248:1893:25c8:1946", Want: true},
+		{IP: "127.0.0.1", Want: false},
+		{IP: "10.1.2.3", Want: false},
+		{IP: "172.16.0.1", Want: false},
+		{IP: "192.168.1.1", Want: false},
+		{IP: "169.254.169.254", Want: false},
+		{IP: "100.64.0.1", Want: false},
+		{IP: "0.0.0.0", Want: false},
+		{IP: "::1", Want: false},
+		{IP: "::ffff:127.0.0.1", Want: false},
+		{IP: "fd00::1", Want: false},
+		{IP: "fe80::1", Want: false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.IP, func(t *testing.T) {
+			assert.Equal(t, tc.Want, publicIP(net.ParseIP(tc.IP)))
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<title>Fallback title</title>
+			<meta property="og:title" content="Open Graph title">
+			<meta property="og:description" content="About the page">
+			<meta property="og:image" content="/image.png">
+			<meta property="og:site_name" content="Example">
+			</head><body><meta property="og:title" content="not in head"></body></html>`)
+	})
+	mux.HandleFunc("/title", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title> Just a title </title><meta name="description" content="desc"></head></html>`)
+	})
+	mux.HandleFunc("/oembed-page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="alternate" type="application/json+oembed" href="/oembed.json"></head></html>`)
+	})
+	mux.HandleFunc("/oembed.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"title":"A video","author_name":"bud","provider_name":"Tube","thumbnail_url":"https://cdn.example/t.jpg"}`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/og", http.StatusFound)
+	})
+	mux.HandleFunc("/file.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write([]byte("PK"))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head></head><body>nothing</body></html>`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(3 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tt := []struct {
+		Name            string
+		Path            string
+		TitleWant       string
+		DescriptionWant string
+		ImageWant       string
+		SiteNameWant    string
+		ErrWant         error
+	}{
+		{
+			Name:            "Open Graph",
+			Path:            "/og",
+			TitleWant:       "Open Graph title",
+			DescriptionWant: "About the page",
+			ImageWant:       server.URL + "/image.png",
+			SiteNameWant:    "Example",
+		},
+		{
+			Name:            "Title and description",
+			Path:            "/title",
+			TitleWant:       "Just a title",
+			DescriptionWant: "desc",
+			SiteNameWant:    "127.0.0.1",
+		},
+		{
+			Name:            "oEmbed",
+			Path:            "/oembed-page",
+			TitleWant:       "A video",
+			DescriptionWant: "bud",
+			ImageWant:       "https://cdn.example/t.jpg",
+			SiteNameWant:    "Tube",
+		},
+		{
+			Name:            "Redirect",
+			Path:            "/redirect",
+			TitleWant:       "Open Graph title",
+			DescriptionWant: "About the page",
+			ImageWant:       server.URL + "/image.png",
+			SiteNameWant:    "Example",
+		},
+		{Name: "Not html", Path: "/file.zip", ErrWant: ErrNoPreview},
+		{Name: "No metadata", Path: "/empty", ErrWant: ErrNoPreview},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			preview, err := newTestFetcher(allowAll).fetch(context.Background(), server.URL+tc.Path)
+			if tc.ErrWant != nil {
+				assert.True(t, errors.Is(err, tc.ErrWant), "error: %v", err)
+				assert.Nil(t, preview)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, server.URL+tc.Path, preview.URL)
+			assert.Equal(t, tc.TitleWant, preview.Title)
+			assert.Equal(t, tc.DescriptionWant, preview.Description)
+			assert.Equal(t, tc.ImageWant, preview.Image)
+			assert.Equal(t, tc.SiteNameWant, preview.SiteName)
+		})
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := newTestFetcher(allowAll).fetch(context.Background(), server.URL+"/slow")
+		assert.NotNil(t, err)
+		assert.Less(t, int64(time.Since(start)), int64(2*time.Second))
+	})
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T) {
+	hits := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><title>internal</title></head></html>`)
+	}))
+	defer internal.Close()
+
+	// the default check, httptest listens on 127.0.0.1
+	_, err := newTestFetcher(publicIP).fetch(context.Background(), internal.URL)
+	assert.True(t, errors.Is(err, ErrBlockedAddress), "error: %v", err)
+
+	_, err = newTestFetcher(publicIP).fetch(context.Background(), "file:///etc/passwd")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, hits)
+}
+
+func TestFetchBlocksRedirectToPrivateAddress(t *testing.T) {
+	// 127.0.0.2 plays the public page, 127.0.0.1 the internal service it redirects to
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skip("127.0.0.2 is not available: ", err)
+	}
+	hits := 0
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer internal.Close()
+	public := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL, http.StatusFound)
+	}))
+	public.Listener.Close()
+	public.Listener = listener
+	public.Start()
+	defer public.Close()
+
+	onlyPublic := func(ip net.IP) bool {
+		return ip.Equal(net.ParseIP("127.0.0.2"))
+	}
+	_, err = newTestFetcher(onlyPublic).fetch(context.Background(), public.URL)
+	assert.True(t, errors.Is(err, ErrBlockedAddress), "error: %v", err)
+	assert.Equal(t, 0, hits)
+}
@@ -0,0 +1,156 @@
+package unfurl
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgformat"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+)
+
+// Broadcaster sends a frame to every participant of a room, *msgserver.Hub is one
+type Broadcaster interface {
+	BroadcastEvent(roomId string, frame interface{})
+}
+
+// Unfurler adds link previews to new messages in the background: the links of a message
+// are fetched (or taken from the cache), stored with the message and the room gets a message_updated event
+type Unfurler struct {
+	repo        mongodb.MessageRepository
+	broadcaster Broadcaster
+	fetcher     *fetcher
+	config      config.Unfurl
+	now         func() time.Time
+
+	queue chan mongodb.Message
+	// ctx is cancelled by Shutdown, it stops fetches and database work in flight
+	ctx      context.Context
+	cancel   context.CancelFunc
+	workers  sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewUnfurler will initialize Unfurler, links to private addresses are never fetched
+func NewUnfurler(repo mongodb.MessageRepository, broadcaster Broadcaster, unfurlConfig config.Unfurl) *Unfurler {
+	return newUnfurler(repo, broadcaster, unfurlConfig, publicIP)
+}
+
+func newUnfurler(repo mongodb.MessageRepository, broadcaster Broadcaster, unfurlConfig config.Unfurl, allow func(ip net.IP) bool) *Unfurler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Unfurler{
+		repo:        repo,
+		broadcaster: broadcaster,
+		fetcher:     newFetcher(unfurlConfig.Timeout, unfurlConfig.MaxBytes, unfurlConfig.UserAgent, allow),
+		config:      unfurlConfig,
+		now:         time.Now,
+		queue:       make(chan mongodb.Message, unfurlConfig.QueueSize),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Run will start the workers and wait until Shutdown
+func (u *Unfurler) Run() {
+	log.Println("unfurler running, workers: ", u.config.Workers)
+	for i := 0; i < u.config.Workers; i++ {
+		u.workers.Add(1)
+		go u.work()
+	}
+	<-u.ctx.Done()
+}
+
+// Shutdown will stop the workers, messages still queued are not unfurled
+func (u *Unfurler) Shutdown(ctx context.Context) error {
+	u.stopOnce.Do(u.cancel)
+
+	stopped := make(chan struct{})
+	go func() {
+		u.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue will queue the message if it has links, it never blocks: when the queue is full the message gets no preview
+func (u *Unfurler) Enqueue(msg mongodb.Message) {
+	if len(msgformat.ParseLinks(msg.Message)) == 0 {
+		return
+	}
+	select {
+	case <-u.ctx.Done():
+	case u.queue <- msg:
+	default:
+		log.Println("unfurler queue is full, no preview for message: ", msg.ID)
+	}
+}
+
+func (u *Unfurler) work() {
+	defer u.workers.Done()
+	for {
+		select {
+		case <-u.ctx.Done():
+			return
+		case msg := <-u.queue:
+			u.unfurl(msg)
+		}
+	}
+}
+
+// unfurl will add the previews of the links of msg and tell its room
+func (u *Unfurler) unfurl(msg mongodb.Message) {
+	links := msgformat.ParseLinks(msg.Message)
+	if len(links) > u.config.MaxLinks {
+		links = links[:u.config.MaxLinks]
+	}
+
+	var previews []mongodb.LinkPreview
+	for _, link := range links {
+		preview, err := u.preview(link)
+		if err != nil {
+			log.Println("unfurl - no preview for link: ", link, " error: ", err)
+			continue
+		}
+		previews = append(previews, *preview)
+	}
+	if len(previews) == 0 {
+		return
+	}
+
+	if err := u.repo.SetMessagePreviews(u.ctx, msg.ID, previews); err != nil {
+		log.Println("unfurl - failed to store previews of message: ", msg.ID, " error: ", err)
+		return
+	}
+	msg.Previews = previews
+	u.broadcaster.BroadcastEvent(msg.RoomID, msgserver.NewMessageUpdatedEvent(msg))
+}
+
+// preview will return the cached preview of the link, or fetch and cache it when missing or expired
+func (u *Unfurler) preview(link string) (*mongodb.LinkPreview, error) {
+	cached, err := u.repo.GetLinkPreview(u.ctx, link)
+	if err == nil && u.now().Sub(cached.FetchedAt) < u.config.CacheTTL {
+		return cached, nil
+	}
+	if err != nil && err != mongodb.ErrLinkPreviewNotFound {
+		log.Println("unfurl - failed to read preview cache: ", err)
+	}
+
+	preview, err := u.fetcher.fetch(u.ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	preview.FetchedAt = u.now()
+	if err := u.repo.SaveLinkPreview(u.ctx, *preview); err != nil {
+		log.Println("unfurl - failed to cache preview: ", err)
+	}
+	return preview, nil
+}
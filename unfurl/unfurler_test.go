@@ -0,0 +1,165 @@
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pranotobudi/myslack-happy-backend/config"
+	"github.com/pranotobudi/myslack-happy-backend/mongodb"
+	"github.com/pranotobudi/myslack-happy-backend/msgserver"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	getLinkPreviewRepoFunc     func(url string) (*mongodb.LinkPreview, error)
+	saveLinkPreviewRepoFunc    func(preview mongodb.LinkPreview) error
+	setMessagePreviewsRepoFunc func(messageId string, previews []mongodb.LinkPreview) error
+)
+
+type mockRepo struct {
+	mongodb.MessageRepository
+}
+
+func (m *mockRepo) GetLinkPreview(ctx context.Context, url string) (*mongodb.LinkPreview, error) {
+	return getLinkPreviewRepoFunc(url)
+}
+func (m *mockRepo) SaveLinkPreview(ctx context.Context, preview mongodb.LinkPreview) error {
+	return saveLinkPreviewRepoFunc(preview)
+}
+func (m *mockRepo) SetMessagePreviews(ctx context.Context, messageId string, previews []mongodb.LinkPreview) error {
+	return setMessagePreviewsRepoFunc(messageId, previews)
+}
+
+type roomEvent struct {
+	roomId string
+	frame  interface{}
+}
+
+// mockBroadcaster hands the events over to the test
+type mockBroadcaster chan roomEvent
+
+func (b mockBroadcaster) BroadcastEvent(roomId string, frame interface{}) {
+	b <- roomEvent{roomId: roomId, frame: frame}
+}
+
+var testConfig = config.Unfurl{Enabled: true, Workers: 2, QueueSize: 8, Timeout: time.Second, MaxBytes: 1 << 20, MaxLinks: 2, CacheTTL: time.Hour}
+
+func TestUnfurler(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><meta property="og:title" content="page %v"></head></html>`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	tt := []struct {
+		Name        string
+		Cached      *mongodb.LinkPreview
+		TitleWant   string
+		FetchesWant int32
+	}{
+		{
+			Name:        "Not cached",
+			TitleWant:   "page /a",
+			FetchesWant: 1,
+		},
+		{
+			Name:        "Cached",
+			Cached:      &mongodb.LinkPreview{URL: server.URL + "/a", Title: "cached", FetchedAt: time.Now()},
+			TitleWant:   "cached",
+			FetchesWant: 0,
+		},
+		{
+			Name:        "Cache expired",
+			Cached:      &mongodb.LinkPreview{URL: server.URL + "/a", Title: "cached", FetchedAt: time.Now().Add(-2 * time.Hour)},
+			TitleWant:   "page /a",
+			FetchesWant: 1,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			atomic.StoreInt32(&fetches, 0)
+			saved := make(chan mongodb.LinkPreview, 1)
+			var storedId string
+			getLinkPreviewRepoFunc = func(url string) (*mongodb.LinkPreview, error) {
+				if tc.Cached == nil {
+					return nil, mongodb.ErrLinkPreviewNotFound
+				}
+				cached := *tc.Cached
+				return &cached, nil
+			}
+			saveLinkPreviewRepoFunc = func(preview mongodb.LinkPreview) error {
+				saved <- preview
+				return nil
+			}
+			setMessagePreviewsRepoFunc = func(messageId string, previews []mongodb.LinkPreview) error {
+				storedId = messageId
+				return nil
+			}
+			broadcaster := make(mockBroadcaster, 1)
+			unfurler := newUnfurler(&mockRepo{}, broadcaster, testConfig, allowAll)
+			go unfurler.Run()
+			defer unfurler.Shutdown(context.Background())
+
+			unfurler.Enqueue(mongodb.Message{ID: "m1", RoomID: "room1", Message: "look " + server.URL + "/a"})
+
+			select {
+			case event := <-broadcaster:
+				assert.Equal(t, "room1", event.roomId)
+				updated := event.frame.(msgserver.MessageUpdatedEvent)
+				assert.Equal(t, "message_updated", updated.Type)
+				assert.Equal(t, "m1", updated.Message.ID)
+				assert.Equal(t, 1, len(updated.Message.Previews))
+				assert.Equal(t, tc.TitleWant, updated.Message.Previews[0].Title)
+			case <-time.After(5 * time.Second):
+				t.Fatal("no message_updated event")
+			}
+			assert.Equal(t, "m1", storedId)
+			assert.Equal(t, tc.FetchesWant, atomic.LoadInt32(&fetches))
+			if tc.FetchesWant > 0 {
+				assert.Equal(t, tc.TitleWant, (<-saved).Title)
+			}
+		})
+	}
+}
+
+func TestUnfurlerMaxLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>page %v</title></head></html>`, r.URL.Path)
+	}))
+	defer server.Close()
+
+	getLinkPreviewRepoFunc = func(url string) (*mongodb.LinkPreview, error) {
+		return nil, mongodb.ErrLinkPreviewNotFound
+	}
+	saveLinkPreviewRepoFunc = func(preview mongodb.LinkPreview) error {
+		return nil
+	}
+	previews := make(chan []mongodb.LinkPreview, 1)
+	setMessagePreviewsRepoFunc = func(messageId string, stored []mongodb.LinkPreview) error {
+		previews <- stored
+		return nil
+	}
+	unfurler := newUnfurler(&mockRepo{}, make(mockBroadcaster, 1), testConfig, allowAll)
+
+	text := fmt.Sprintf("%[1]v/a %[1]v/b %[1]v/c", server.URL)
+	unfurler.unfurl(mongodb.Message{ID: "m1", RoomID: "room1", Message: text})
+
+	stored := <-previews
+	assert.Equal(t, 2, len(stored))
+	assert.Equal(t, "page /a", stored[0].Title)
+	assert.Equal(t, "page /b", stored[1].Title)
+}
+
+func TestUnfurlerSkipsMessagesWithoutLinks(t *testing.T) {
+	unfurler := newUnfurler(&mockRepo{}, make(mockBroadcaster, 1), testConfig, allowAll)
+	unfurler.Enqueue(mongodb.Message{ID: "m1", RoomID: "room1", Message: "no links `https://example.com`"})
+	assert.Equal(t, 0, len(unfurler.queue))
+}